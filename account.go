@@ -0,0 +1,398 @@
+package main
+
+import (
+	"archive/zip"
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chirpy/internal/audit"
+	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// deleteAccount deletes the authenticated user after they re-enter their
+// password. Chirps and sessions go with the account through the foreign key
+// cascades. With a grace period configured, the account is only scheduled
+// for deletion and every session is revoked; logging in again within the
+// grace period cancels the deletion.
+func (cfg *apiConfig) deleteAccount(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Password string `json:"password"`
+	}
+
+	type response struct {
+		Error               string `json:"error,omitempty"`
+		DeletionScheduledAt string `json:"deletion_scheduled_at,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	reqData := requestData{}
+
+	err = decoder.Decode(&reqData)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), userUUID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	err = auth.CheckPasswordHash(user.HashedPassword, reqData.Password)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Incorrect password",
+		})
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(errResponse)
+		return
+	}
+
+	if cfg.accountDeletionGrace <= 0 {
+		var mediaIDs []uuid.UUID
+		err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+			var err error
+			mediaIDs, err = tx.DeleteMediaByUser(req.Context(), user.ID)
+			if err != nil {
+				return err
+			}
+			err = tx.DeleteUser(req.Context(), user.ID)
+			if err != nil {
+				return err
+			}
+			return audit.Record(req.Context(), tx, cfg.auditEvent(req, user.ID, audit.ActionAccountDelete, user.ID.String()))
+		})
+		if err != nil {
+			slog.ErrorContext(req.Context(), "delete user", "error", err)
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+		cfg.deleteMediaBlobs(req.Context(), mediaIDs)
+
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	deleteAt := time.Now().UTC().Add(cfg.accountDeletionGrace)
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		_, err := tx.ScheduleUserDeletion(req.Context(), database.ScheduleUserDeletionParams{
+			ID:                  user.ID,
+			DeletionScheduledAt: sql.NullTime{Time: deleteAt, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		err = tx.DeleteRefreshTokensByUser(req.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		return audit.Record(req.Context(), tx, cfg.auditEvent(req, user.ID, audit.ActionAccountDeleteScheduled, user.ID.String()))
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "schedule user deletion", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		DeletionScheduledAt: deleteAt.String(),
+	})
+	w.WriteHeader(http.StatusAccepted)
+	w.Write(successResponse)
+}
+
+type accountExport struct {
+	ExportedAt time.Time         `json:"exported_at"`
+	Profile    exportedProfile   `json:"profile"`
+	Chirps     []exportedChirp   `json:"chirps"`
+	Media      []exportedMedia   `json:"media"`
+	Messages   []exportedMessage `json:"messages"`
+	Drafts     []exportedDraft   `json:"drafts"`
+	Sessions   []exportedToken   `json:"sessions"`
+}
+
+type exportedProfile struct {
+	ID                  uuid.UUID  `json:"id"`
+	Email               string     `json:"email"`
+	Handle              string     `json:"handle,omitempty"`
+	DisplayName         string     `json:"display_name,omitempty"`
+	Bio                 string     `json:"bio,omitempty"`
+	AvatarURL           string     `json:"avatar_url,omitempty"`
+	IsChirpyRed         bool       `json:"is_chirpy_red"`
+	Role                string     `json:"role"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+	DeletionScheduledAt *time.Time `json:"deletion_scheduled_at,omitempty"`
+}
+
+type exportedChirp struct {
+	ID        uuid.UUID  `json:"id"`
+	Body      string     `json:"body"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+}
+
+// exportedMedia describes an upload, attached or not. The image itself can
+// be fetched from URL.
+type exportedMedia struct {
+	ID          uuid.UUID  `json:"id"`
+	ChirpID     *uuid.UUID `json:"chirp_id,omitempty"`
+	URL         string     `json:"url"`
+	ContentType string     `json:"content_type"`
+	Width       int32      `json:"width"`
+	Height      int32      `json:"height"`
+	SizeBytes   int64      `json:"size_bytes"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// exportedMessage is a direct message the user sent or received, decrypted.
+type exportedMessage struct {
+	ID             uuid.UUID  `json:"id"`
+	ConversationID uuid.UUID  `json:"conversation_id"`
+	SenderID       uuid.UUID  `json:"sender_id"`
+	Body           string     `json:"body"`
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
+
+type exportedDraft struct {
+	ID        uuid.UUID `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// exportedToken describes a session. The token itself is a bearer secret
+// and is left out.
+type exportedToken struct {
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// exportAccount streams everything stored about the authenticated user,
+// including soft-deleted chirps, as a JSON document or, with ?format=zip,
+// as a ZIP archive holding one JSON file per section.
+func (cfg *apiConfig) exportAccount(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	format := req.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "zip" {
+		errResponse, _ := json.Marshal(response{
+			Error: "Unsupported export format",
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	export, err := cfg.collectAccountExport(req, userUUID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "collect account export", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	if format == "zip" {
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+		w.WriteHeader(http.StatusOK)
+
+		archive := zip.NewWriter(w)
+		sections := []struct {
+			name string
+			data any
+		}{
+			{"profile.json", export.Profile},
+			{"chirps.json", export.Chirps},
+			{"media.json", export.Media},
+			{"messages.json", export.Messages},
+			{"drafts.json", export.Drafts},
+			{"sessions.json", export.Sessions},
+		}
+		for _, section := range sections {
+			f, err := archive.CreateHeader(&zip.FileHeader{
+				Name:     section.name,
+				Method:   zip.Deflate,
+				Modified: export.ExportedAt,
+			})
+			if err != nil {
+				slog.ErrorContext(req.Context(), "write account export", "error", err)
+				return
+			}
+			encoder := json.NewEncoder(f)
+			encoder.SetIndent("", "  ")
+			if err := encoder.Encode(section.data); err != nil {
+				slog.ErrorContext(req.Context(), "write account export", "error", err)
+				return
+			}
+		}
+		archive.Close()
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.json"`)
+	w.WriteHeader(http.StatusOK)
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	encoder.Encode(export)
+}
+
+func (cfg *apiConfig) collectAccountExport(req *http.Request, userUUID uuid.UUID) (accountExport, error) {
+	user, err := cfg.db.GetUserByID(req.Context(), userUUID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	chirps, err := cfg.db.ListAllChirpsByAuthor(req.Context(), userUUID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	media, err := cfg.db.ListMediaByUser(req.Context(), userUUID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	messages, err := cfg.db.ListMessagesByUser(req.Context(), userUUID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	drafts, err := cfg.db.ListDraftsByUser(req.Context(), userUUID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	tokens, err := cfg.db.ListRefreshTokensByUser(req.Context(), userUUID)
+	if err != nil {
+		return accountExport{}, err
+	}
+
+	export := accountExport{
+		ExportedAt: time.Now().UTC(),
+		Profile: exportedProfile{
+			ID:                  user.ID,
+			Email:               user.Email,
+			Handle:              user.Handle.String,
+			DisplayName:         user.DisplayName,
+			Bio:                 user.Bio,
+			AvatarURL:           user.AvatarUrl,
+			IsChirpyRed:         user.IsChirpyRed,
+			Role:                user.Role,
+			CreatedAt:           user.CreatedAt,
+			UpdatedAt:           user.UpdatedAt,
+			DeletionScheduledAt: nullTimePtr(user.DeletionScheduledAt),
+		},
+		Chirps:   []exportedChirp{},
+		Media:    []exportedMedia{},
+		Messages: []exportedMessage{},
+		Drafts:   []exportedDraft{},
+		Sessions: []exportedToken{},
+	}
+	for _, chirp := range chirps {
+		export.Chirps = append(export.Chirps, exportedChirp{
+			ID:        chirp.ID,
+			Body:      chirp.Body,
+			CreatedAt: chirp.CreatedAt,
+			UpdatedAt: chirp.UpdatedAt,
+			DeletedAt: nullTimePtr(chirp.DeletedAt),
+		})
+	}
+	for _, md := range media {
+		item := exportedMedia{
+			ID:          md.ID,
+			URL:         "/media/" + md.ID.String(),
+			ContentType: md.ContentType,
+			Width:       md.Width,
+			Height:      md.Height,
+			SizeBytes:   md.SizeBytes,
+			CreatedAt:   md.CreatedAt,
+		}
+		if md.ChirpID.Valid {
+			item.ChirpID = &md.ChirpID.UUID
+		}
+		export.Media = append(export.Media, item)
+	}
+	for _, msg := range messages {
+		body, err := cfg.messageBox.Open(msg.Body, messageAssociatedData(msg.ID, msg.ConversationID, msg.SenderID))
+		if err != nil {
+			return accountExport{}, err
+		}
+		export.Messages = append(export.Messages, exportedMessage{
+			ID:             msg.ID,
+			ConversationID: msg.ConversationID,
+			SenderID:       msg.SenderID,
+			Body:           string(body),
+			CreatedAt:      msg.CreatedAt,
+			ReadAt:         nullTimePtr(msg.ReadAt),
+		})
+	}
+	for _, draft := range drafts {
+		export.Drafts = append(export.Drafts, exportedDraft{
+			ID:        draft.ID,
+			Body:      draft.Body,
+			CreatedAt: draft.CreatedAt,
+			UpdatedAt: draft.UpdatedAt,
+		})
+	}
+	for _, token := range tokens {
+		export.Sessions = append(export.Sessions, exportedToken{
+			CreatedAt: token.CreatedAt,
+			ExpiresAt: token.ExpiresAt,
+			RevokedAt: nullTimePtr(token.RevokedAt),
+		})
+	}
+	return export, nil
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
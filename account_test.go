@@ -0,0 +1,166 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestDeleteAccount(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	chirp := api.chirp(user, "soon gone")
+	md := api.uploadImage(user, 10, 10)
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		wantCode      int
+	}{
+		{name: "Missing token", body: map[string]string{"password": user.Password}, wantCode: http.StatusUnauthorized},
+		{name: "Wrong password", authorization: user.bearer(), body: map[string]string{"password": "wrong"}, wantCode: http.StatusForbidden},
+		{name: "Malformed JSON", authorization: user.bearer(), body: "{", wantCode: http.StatusBadRequest},
+		{name: "Correct password", authorization: user.bearer(), body: map[string]string{"password": user.Password}, wantCode: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("DELETE", "/api/users/me", tt.authorization, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	if code, _ := api.do("POST", "/api/login", "", map[string]string{"email": user.Email, "password": user.Password}); code != http.StatusUnauthorized {
+		t.Errorf("login after deletion: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+chirp.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("chirp after deletion: status = %d, want %d", code, http.StatusNotFound)
+	}
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh after deletion: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if api.blobExists(md.ID) {
+		t.Error("media file kept after deletion")
+	}
+}
+
+func TestDeleteAccountGracePeriod(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.accountDeletionGrace = 24 * time.Hour
+	user := api.signUp("a@example.com")
+	userUUID := uuid.MustParse(user.ID)
+	md := api.uploadImage(user, 10, 10)
+
+	code, body := api.do("DELETE", "/api/users/me", user.bearer(), map[string]string{"password": user.Password})
+	if code != http.StatusAccepted {
+		t.Fatalf("delete with grace period: status = %d, want %d: %s", code, http.StatusAccepted, body)
+	}
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh after scheduling deletion: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+
+	if code, _ := api.do("POST", "/api/login", "", map[string]string{"email": user.Email, "password": user.Password}); code != http.StatusOK {
+		t.Fatalf("login during grace period: status = %d, want %d", code, http.StatusOK)
+	}
+	dbUser, _ := api.store.GetUserByID(context.Background(), userUUID)
+	if dbUser.DeletionScheduledAt.Valid {
+		t.Errorf("login did not cancel the scheduled deletion")
+	}
+
+	api.store.ScheduleUserDeletion(context.Background(), database.ScheduleUserDeletionParams{
+		ID:                  userUUID,
+		DeletionScheduledAt: sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+	})
+	if err := api.cfg.purgeScheduledAccounts(context.Background()); err != nil {
+		t.Fatalf("purgeScheduledAccounts() error = %v", err)
+	}
+	if _, err := api.store.GetUserByID(context.Background(), userUUID); err == nil {
+		t.Errorf("account still exists after its grace period")
+	}
+	if api.blobExists(md.ID) {
+		t.Error("media file kept after the grace period")
+	}
+}
+
+func TestExportAccount(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	other := api.signUp("b@example.com")
+	api.chirp(user, "kept")
+	deleted := api.chirp(user, "deleted")
+	api.do("DELETE", "/api/chirps/"+deleted.ID, user.bearer(), nil)
+	api.chirp(other, "not mine")
+	api.setHandle(user, "alice")
+	upload := api.uploadImage(user, 8, 8)
+	api.uploadImage(other, 8, 8)
+	api.draft(user, "half a thought")
+	_, conversation := api.startConversation(user, other)
+	api.sendMessage(user, conversation.ID, "hello")
+	api.sendMessage(other, conversation.ID, "hi back")
+
+	if code, _ := api.do("GET", "/api/users/me/export", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("export without token: status = %d, want %d", code, http.StatusUnauthorized)
+	}
+	if code, _ := api.do("GET", "/api/users/me/export?format=xml", user.bearer(), nil); code != http.StatusBadRequest {
+		t.Errorf("export as xml: status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	code, body := api.do("GET", "/api/users/me/export", user.bearer(), nil)
+	if code != http.StatusOK {
+		t.Fatalf("export: status = %d: %s", code, body)
+	}
+	var export accountExport
+	decode(t, body, &export)
+	if export.Profile.Email != user.Email {
+		t.Errorf("profile email = %q, want %q", export.Profile.Email, user.Email)
+	}
+	if len(export.Chirps) != 2 {
+		t.Errorf("exported %d chirps, want 2", len(export.Chirps))
+	}
+	if export.Profile.Handle != "alice" {
+		t.Errorf("profile handle = %q, want %q", export.Profile.Handle, "alice")
+	}
+	if len(export.Media) != 1 || export.Media[0].ID.String() != upload.ID {
+		t.Errorf("exported media = %+v, want only %s", export.Media, upload.ID)
+	}
+	if len(export.Messages) != 2 || export.Messages[0].Body != "hello" || export.Messages[1].Body != "hi back" {
+		t.Errorf("exported messages = %+v, want both sides of the conversation", export.Messages)
+	}
+	if len(export.Drafts) != 1 || export.Drafts[0].Body != "half a thought" {
+		t.Errorf("exported drafts = %+v", export.Drafts)
+	}
+	if len(export.Sessions) != 1 {
+		t.Errorf("exported %d sessions, want 1", len(export.Sessions))
+	}
+	if bytes.Contains(body, []byte(user.RefreshToken)) {
+		t.Errorf("export leaks the refresh token")
+	}
+
+	code, body = api.do("GET", "/api/users/me/export?format=zip", user.bearer(), nil)
+	if code != http.StatusOK {
+		t.Fatalf("zip export: status = %d: %s", code, body)
+	}
+	archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("invalid zip: %v", err)
+	}
+	names := map[string]bool{}
+	for _, f := range archive.File {
+		names[f.Name] = true
+	}
+	for _, want := range []string{"profile.json", "chirps.json", "media.json", "messages.json", "drafts.json", "sessions.json"} {
+		if !names[want] {
+			t.Errorf("zip is missing %s", want)
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+
+	"github.com/chirpy/internal/audit"
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// User roles, stored in users.role. Roles are granted directly in the
+// database.
+const (
+	roleUser      = "user"
+	roleModerator = "moderator"
+	roleAdmin     = "admin"
+)
+
+var errForbidden = errors.New("user lacks the required role")
+
+// errHiddenByReport is returned from restoreChirp's transaction when a
+// report on the chirp was resolved by hiding it.
+var errHiddenByReport = errors.New("chirp hidden by report")
+
+// authenticateStaff authenticates the request like authenticateUser and then
+// checks that the user holds one of roles. It returns errForbidden when the
+// user is authenticated but not allowed.
+func (cfg *apiConfig) authenticateStaff(req *http.Request, roles ...string) (database.User, error) {
+	user, err := cfg.authenticatedUser(req)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	if !slices.Contains(roles, user.Role) {
+		return database.User{}, errForbidden
+	}
+	return user, nil
+}
+
+// restoreChirp undoes a soft delete, as long as the chirp was deleted within
+// the restore window and hasn't been purged yet. Restores are recorded in the
+// moderation log.
+func (cfg *apiConfig) restoreChirp(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error     string `json:"error,omitempty"`
+		ID        string `json:"id,omitempty"`
+		Body      string `json:"body,omitempty"`
+		UserID    string `json:"user_id,omitempty"`
+		CreatedAt string `json:"created_at,omitempty"`
+		UpdatedAt string `json:"updated_at,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	staff, err := cfg.authenticateStaff(req, roleModerator, roleAdmin)
+	if errors.Is(err, errForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid chirp ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), chirpUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Chirp does not exist",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "get chirp", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	if !chirp.DeletedAt.Valid {
+		errResponse, _ := json.Marshal(response{
+			Error: "Chirp is not deleted",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+
+	cutoff := time.Now().UTC().Add(-cfg.chirpRestoreWindow)
+	if !chirp.DeletedAt.Time.After(cutoff) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Restore window has expired",
+		})
+		w.WriteHeader(http.StatusGone)
+		w.Write(errResponse)
+		return
+	}
+
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		// a chirp hidden by resolving a report stays hidden; bringing it
+		// back would quietly overturn the moderator's decision
+		hidden, err := tx.ChirpHiddenByReport(req.Context(), chirp.ID)
+		if err != nil {
+			return err
+		}
+		if hidden {
+			return errHiddenByReport
+		}
+		chirp, err = tx.RestoreChirp(req.Context(), database.RestoreChirpParams{
+			ID:        chirp.ID,
+			DeletedAt: sql.NullTime{Time: cutoff, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tx.CreateModerationAction(req.Context(), database.CreateModerationActionParams{
+			ModeratorID:  staff.ID,
+			Action:       moderationRestore,
+			ChirpID:      uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			TargetUserID: uuid.NullUUID{UUID: chirp.UserID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return audit.Record(req.Context(), tx, cfg.auditEvent(req, staff.ID, audit.ActionChirpRestore, chirp.ID.String()))
+	})
+	if errors.Is(err, errHiddenByReport) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Chirp was hidden by a moderator",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+	// the chirp was within the window, so if no row matched it has been
+	// restored by someone else meanwhile
+	if errors.Is(err, sql.ErrNoRows) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Chirp is not deleted",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "restore chirp", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		ID:        chirp.ID.String(),
+		Body:      chirp.Body,
+		UserID:    chirp.UserID.String(),
+		CreatedAt: chirp.CreatedAt.String(),
+		UpdatedAt: chirp.UpdatedAt.String(),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
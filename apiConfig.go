@@ -1,40 +1,84 @@
 package main
 
 import (
+	"context"
+	"database/sql"
 	"encoding/json"
-	"fmt"
+	"errors"
+	"log/slog"
 	"net/http"
 	"os"
 	"slices"
 	"sort"
-	"strings"
 	"sync/atomic"
 	"time"
 
+	"github.com/chirpy/internal/audit"
 	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/blob"
 	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/preview"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/chirpy/internal/ratelimit"
+	"github.com/chirpy/internal/sealed"
+	"github.com/chirpy/internal/store"
 	"github.com/google/uuid"
 )
 
 type apiConfig struct {
-	fileserverHits atomic.Int32
-	authSecret     string
-	polkaSecret    string
-	db             *database.Queries
+	authSecret      string
+	polkaSecret     string
+	db              store.Store
+	metrics         *metrics
+	readinessChecks []healthCheck
+	shuttingDown    atomic.Bool
+
+	rateLimiter    ratelimit.Store
+	trustedProxies int
+	mailer         mailer
+	blobs          blob.Store
+	fetcher        preview.HTTPFetcher
+	publicURL      string
+	chirpLimits    chirpLimits
+	hub            *pubsub.Hub
+	messageBox     *sealed.Box
+
+	chirpRestoreWindow   time.Duration
+	accountDeletionGrace time.Duration
+	// auditRetention is how long audit events are kept. It can't be less
+	// than minAuditRetention.
+	auditRetention time.Duration
+	// previewWake tells the link preview job that a chirp with links was
+	// published. It is nil in tests, which run the job directly.
+	previewWake chan struct{}
 }
 
-func (cfg *apiConfig) middlewareMetricsInc(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-		cfg.fileserverHits.Add(1)
-
-		next.ServeHTTP(w, req)
-	})
+// authenticateUser validates the bearer access token on req and returns the
+// user it was issued to. The user is also recorded for the access log.
+func (cfg *apiConfig) authenticateUser(req *http.Request) (uuid.UUID, error) {
+	user, err := cfg.authenticatedUser(req)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return user.ID, nil
 }
 
-func (cfg *apiConfig) getNumRequests(w http.ResponseWriter, req *http.Request) {
-	w.Header().Set("Content-Type", "text/html; charset=utf-8")
-	w.WriteHeader(http.StatusOK)
-	fmt.Fprintf(w, "<html><body><h1>Welcome, Chirpy Admin</h1><p>Chirpy has been visited %d times!</p></body></html>", cfg.fileserverHits.Load()) // Write HTML directly
+// authenticatedUser is authenticateUser returning the whole user. Tokens of
+// users who have since been suspended, banned or deleted are rejected even
+// though they haven't expired.
+func (cfg *apiConfig) authenticatedUser(req *http.Request) (database.User, error) {
+	bearerToken, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	userUUID, err := auth.ValidateJWT(bearerToken, cfg.authSecret)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	setRequestUserID(req.Context(), userUUID)
+	return cfg.activeUser(req.Context(), userUUID)
 }
 
 func (cfg *apiConfig) resetUsers(w http.ResponseWriter, req *http.Request) {
@@ -52,7 +96,7 @@ func (cfg *apiConfig) resetUsers(w http.ResponseWriter, req *http.Request) {
 	err := cfg.db.DeleteAllUsers(req.Context())
 
 	if err != nil {
-		fmt.Println(err)
+		slog.ErrorContext(req.Context(), "delete all users", "error", err)
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
 		})
@@ -60,6 +104,7 @@ func (cfg *apiConfig) resetUsers(w http.ResponseWriter, req *http.Request) {
 		w.Write(errResponse)
 		return
 	}
+	cfg.recordAudit(req, uuid.Nil, audit.ActionAdminReset, "users")
 
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("Successfully removed all records in users table"))
@@ -76,8 +121,15 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
 
 	userID := req.URL.Query().Get("author_id")
 
+	// the access token is optional here; signed-in users don't see chirps
+	// from accounts they've blocked or muted, or that have blocked them
+	viewerUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		viewerUUID = uuid.Nil
+	}
+
 	if userID == "" {
-		dbChirps, err := cfg.db.ListChirps(req.Context())
+		dbChirps, err := cfg.db.ListChirps(req.Context(), viewerUUID)
 		if err != nil {
 			errResponse, _ := json.Marshal(response{
 				Error: "Something went wrong",
@@ -91,7 +143,10 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
 
 	if userID != "" {
 		userUUID, _ := uuid.Parse(userID)
-		dbChirps, err := cfg.db.ListChirpsByAuthor(req.Context(), userUUID)
+		dbChirps, err := cfg.db.ListChirpsByAuthor(req.Context(), database.ListChirpsByAuthorParams{
+			UserID:   userUUID,
+			ViewerID: viewerUUID,
+		})
 		if err != nil {
 			errResponse, _ := json.Marshal(response{
 				Error: "Something went wrong",
@@ -109,11 +164,36 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
 	}
 
 	type Chirp struct {
-		ID        string `json:"id"`
-		Body      string `json:"body"`
-		UserID    string `json:"user_id"`
-		CreatedAt string `json:"created_at"`
-		UpdatedAt string `json:"updated_at"`
+		ID        string       `json:"id"`
+		Body      string       `json:"body"`
+		UserID    string       `json:"user_id"`
+		Media     []chirpMedia `json:"media,omitempty"`
+		Links     []chirpLink  `json:"links,omitempty"`
+		CreatedAt string       `json:"created_at"`
+		UpdatedAt string       `json:"updated_at"`
+	}
+
+	chirpIDs := make([]uuid.UUID, 0, len(chirpList))
+	for _, dbChirp := range chirpList {
+		chirpIDs = append(chirpIDs, dbChirp.ID)
+	}
+	media, err := cfg.mediaByChirp(req.Context(), chirpIDs)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+	links, err := cfg.linksByChirp(req.Context(), chirpIDs)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
 	}
 
 	chirps := []Chirp{}
@@ -122,6 +202,8 @@ func (cfg *apiConfig) getChirps(w http.ResponseWriter, req *http.Request) {
 			ID:        dbChirp.ID.String(),
 			Body:      dbChirp.Body,
 			UserID:    dbChirp.UserID.String(),
+			Media:     media[dbChirp.ID],
+			Links:     links[dbChirp.ID],
 			CreatedAt: dbChirp.CreatedAt.String(),
 			UpdatedAt: dbChirp.UpdatedAt.String(),
 		}
@@ -141,13 +223,7 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
 	// check access token
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	userUUID, err := auth.ValidateJWT(bearerToken, cfg.authSecret)
+	userUUID, err := cfg.authenticateUser(req)
 	if err != nil {
 		w.WriteHeader(http.StatusUnauthorized)
 		return
@@ -163,7 +239,7 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
 	}
 
 	chirp, err := cfg.db.GetChirp(req.Context(), chirpUUID)
-	if err != nil {
+	if err != nil || chirp.DeletedAt.Valid || chirp.Status == chirpScheduled {
 		errorResponse.Error = "Chirp does not exist"
 		errResponse, _ := json.Marshal(errorResponse)
 		w.WriteHeader(http.StatusNotFound)
@@ -179,7 +255,7 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	err = cfg.db.DeleteChirp(req.Context(), chirp.ID)
+	err = cfg.db.SoftDeleteChirp(req.Context(), chirp.ID)
 	if err != nil {
 		errorResponse.Error = "Something went wrong"
 		errResponse, _ := json.Marshal(errorResponse)
@@ -188,22 +264,26 @@ func (cfg *apiConfig) deleteChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	cfg.publishChirpEvent(eventChirpDeleted, chirp, map[string]string{
+		"id":      chirp.ID.String(),
+		"user_id": chirp.UserID.String(),
+	})
+
 	w.WriteHeader(http.StatusNoContent)
 }
 
+// createChirp posts a chirp, or with publish_at schedules it to be
+// published later by publishScheduledChirps.
 func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 	type requestData struct {
-		Body   string `json:"body"`
-		UserID string `json:"user_id"`
+		Body      string   `json:"body"`
+		UserID    string   `json:"user_id"`
+		MediaIDs  []string `json:"media_ids"`
+		PublishAt string   `json:"publish_at"`
 	}
 
 	type response struct {
-		Error     string `json:"error,omitempty"`
-		ID        string `json:"id,omitempty"`
-		Body      string `json:"body,omitempty"`
-		UserID    string `json:"user_id,omitempty"`
-		CreatedAt string `json:"created_at,omitempty"`
-		UpdatedAt string `json:"updated_at,omitempty"`
+		Error string `json:"error,omitempty"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -221,8 +301,7 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	// println("bearerToken", bearerToken)
+	userUUID, err := cfg.authenticateUser(req)
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "No authorization header",
@@ -232,7 +311,7 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	userUUID, err := auth.ValidateJWT(bearerToken, cfg.authSecret)
+	user, err := cfg.db.GetUserByID(req.Context(), userUUID)
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "No authorization header",
@@ -242,40 +321,32 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	if chirpData.Body == "" {
+	c, err := cfg.prepareChirp(user, chirpData.Body, chirpData.MediaIDs, chirpData.PublishAt)
+	if err != nil {
 		errResponse, _ := json.Marshal(response{
-			Error: "Chirp json request body is missing",
+			Error: err.Error(),
 		})
 		w.WriteHeader(400)
 		w.Write(errResponse)
 		return
 	}
 
-	if len(chirpData.Body) > 140 {
+	var chirp database.Chirp
+	var notes []database.Notification
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		chirp, notes, err = cfg.storeChirp(req.Context(), tx, userUUID, c)
+		return err
+	})
+
+	if errors.Is(err, errMediaUnavailable) {
 		errResponse, _ := json.Marshal(response{
-			Error: "Chirp is too long",
+			Error: "Media not found or already attached",
 		})
-		w.WriteHeader(400)
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write(errResponse)
 		return
 	}
 
-	// clean profanity
-	words := strings.Split(chirpData.Body, " ")
-	profanities := []string{"kerfuffle", "sharbert", "fornax"}
-	for i, word := range words {
-		if slices.Contains(profanities, strings.ToLower(word)) {
-			words[i] = "****"
-		}
-	}
-
-	chirp, err := cfg.db.CreateChirp(
-		req.Context(),
-		database.CreateChirpParams{
-			Body:   strings.Join(words, " "),
-			UserID: userUUID,
-		})
-
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
@@ -285,30 +356,160 @@ func (cfg *apiConfig) createChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	successResponse, _ := json.Marshal(response{
+	cfg.writeCreatedChirp(w, req, chirp, notes)
+}
+
+// newChirp is a chirp that has passed prepareChirp, ready to be stored.
+type newChirp struct {
+	body      string
+	links     []database.CreateLinkParams
+	mentions  []string
+	mediaIDs  []uuid.UUID
+	publishAt time.Time
+}
+
+// prepareChirp runs a chirp's body, media IDs and optional publish_at
+// through every check a new chirp must pass, and rewrites the body for
+// storage. The error is suitable for the client.
+func (cfg *apiConfig) prepareChirp(user database.User, body string, mediaIDs []string, publishAt string) (newChirp, error) {
+	cleaned, err := prepareChirpBody(body, cfg.chirpLimits.forUser(user))
+	if err != nil {
+		return newChirp{}, err
+	}
+
+	if len(mediaIDs) > maxChirpMedia {
+		return newChirp{}, errors.New("Too many media attachments")
+	}
+
+	c := newChirp{mediaIDs: []uuid.UUID{}}
+	for _, id := range mediaIDs {
+		mediaUUID, err := uuid.Parse(id)
+		if err != nil || slices.Contains(c.mediaIDs, mediaUUID) {
+			return newChirp{}, errors.New("Invalid media ID")
+		}
+		c.mediaIDs = append(c.mediaIDs, mediaUUID)
+	}
+
+	if publishAt != "" {
+		c.publishAt, err = parsePublishAt(publishAt, time.Now().UTC())
+		if err != nil {
+			return newChirp{}, err
+		}
+	}
+
+	c.body, c.links = shortenLinks(cleaned, cfg.publicURL)
+	c.mentions = findMentions(cleaned)
+	return c, nil
+}
+
+// storeChirp saves c for userID with its links and media, and notifies the
+// users it mentions unless it is scheduled. It runs inside the caller's
+// transaction.
+func (cfg *apiConfig) storeChirp(ctx context.Context, tx store.Store, userID uuid.UUID, c newChirp) (database.Chirp, []database.Notification, error) {
+	scheduled := !c.publishAt.IsZero()
+
+	var chirp database.Chirp
+	var err error
+	if scheduled {
+		chirp, err = tx.CreateScheduledChirp(ctx, database.CreateScheduledChirpParams{
+			Body:      c.body,
+			UserID:    userID,
+			PublishAt: sql.NullTime{Time: c.publishAt, Valid: true},
+		})
+	} else {
+		chirp, err = tx.CreateChirp(
+			ctx,
+			database.CreateChirpParams{
+				Body:   c.body,
+				UserID: userID,
+			})
+	}
+	if err != nil {
+		return chirp, nil, err
+	}
+	for _, link := range c.links {
+		link.ChirpID = chirp.ID
+		_, err = tx.CreateLink(ctx, link)
+		if err != nil {
+			return chirp, nil, err
+		}
+	}
+	err = attachMedia(ctx, tx, chirp, c.mediaIDs)
+	if err != nil || scheduled {
+		return chirp, nil, err
+	}
+	notes, err := notifyMentions(ctx, tx, chirp, c.mentions)
+	return chirp, notes, err
+}
+
+// writeCreatedChirp responds with a chirp storeChirp just committed and,
+// unless it is scheduled, announces it and its notifications.
+func (cfg *apiConfig) writeCreatedChirp(w http.ResponseWriter, req *http.Request, chirp database.Chirp, notes []database.Notification) {
+	type response struct {
+		ID        string       `json:"id,omitempty"`
+		Body      string       `json:"body,omitempty"`
+		UserID    string       `json:"user_id,omitempty"`
+		Status    string       `json:"status,omitempty"`
+		Media     []chirpMedia `json:"media,omitempty"`
+		Links     []chirpLink  `json:"links,omitempty"`
+		PublishAt string       `json:"publish_at,omitempty"`
+		CreatedAt string       `json:"created_at,omitempty"`
+		UpdatedAt string       `json:"updated_at,omitempty"`
+	}
+
+	cfg.metrics.chirpsCreated.Inc()
+
+	media, err := cfg.mediaByChirp(req.Context(), []uuid.UUID{chirp.ID})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list chirp media", "error", err)
+	}
+	chirpLinks, err := cfg.linksByChirp(req.Context(), []uuid.UUID{chirp.ID})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list chirp links", "error", err)
+	}
+
+	created := response{
 		ID:        chirp.ID.String(),
 		Body:      chirp.Body,
 		UserID:    chirp.UserID.String(),
+		Media:     media[chirp.ID],
+		Links:     chirpLinks[chirp.ID],
 		CreatedAt: chirp.CreatedAt.String(),
 		UpdatedAt: chirp.UpdatedAt.String(),
-	})
+	}
+	if chirp.Status == chirpScheduled {
+		// nobody else sees it until it's published
+		created.Status = chirp.Status
+		created.PublishAt = chirp.PublishAt.Time.Format(time.RFC3339)
+	} else {
+		cfg.publishChirpEvent(eventChirpCreated, chirp, created)
+		cfg.publishNotifications(req.Context(), notes)
+		if len(created.Links) > 0 {
+			cfg.wakePreviewFetcher()
+		}
+	}
+
+	successResponse, _ := json.Marshal(created)
 	w.WriteHeader(http.StatusCreated)
 	w.Write(successResponse)
 }
 
 func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
 	type response struct {
-		Error     string `json:"error,omitempty"`
-		ID        string `json:"id,omitempty"`
-		Body      string `json:"body,omitempty"`
-		UserID    string `json:"user_id,omitempty"`
-		CreatedAt string `json:"created_at,omitempty"`
-		UpdatedAt string `json:"updated_at,omitempty"`
+		Error     string       `json:"error,omitempty"`
+		ID        string       `json:"id,omitempty"`
+		Body      string       `json:"body,omitempty"`
+		UserID    string       `json:"user_id,omitempty"`
+		Media     []chirpMedia `json:"media,omitempty"`
+		Links     []chirpLink  `json:"links,omitempty"`
+		CreatedAt string       `json:"created_at,omitempty"`
+		UpdatedAt string       `json:"updated_at,omitempty"`
+		DeletedAt string       `json:"deleted_at,omitempty"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	uuid, err := uuid.Parse(req.PathValue("chirpID"))
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
 
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
@@ -319,9 +520,9 @@ func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	chirp, err := cfg.db.GetChirp(req.Context(), uuid)
+	chirp, err := cfg.db.GetChirp(req.Context(), chirpUUID)
 
-	if err != nil {
+	if err != nil || chirp.Status == chirpScheduled {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
 		})
@@ -330,82 +531,95 @@ func (cfg *apiConfig) getChirp(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	successResponse, _ := json.Marshal(response{
-		ID:        chirp.ID.String(),
-		Body:      chirp.Body,
-		UserID:    chirp.UserID.String(),
-		CreatedAt: chirp.CreatedAt.String(),
-		UpdatedAt: chirp.UpdatedAt.String(),
-	})
-	w.WriteHeader(http.StatusOK)
-	w.Write(successResponse)
-}
-
-func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
-	type requestData struct {
-		Email    string `json:"email"`
-		Password string `json:"password"`
+	// chirps by suspended or banned authors are hidden, as in the lists
+	author, err := cfg.db.GetUserByID(req.Context(), chirp.UserID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "get chirp author", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
 	}
-
-	type response struct {
-		Error       string `json:"error,omitempty"`
-		ID          string `json:"id,omitempty"`
-		Email       string `json:"email,omitempty"`
-		IsChirpyRed bool   `json:"is_chirpy_red"`
-		CreatedAt   string `json:"created_at,omitempty"`
-		UpdatedAt   string `json:"updated_at,omitempty"`
+	if isSuspended(author, time.Now()) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-
-	decoder := json.NewDecoder(req.Body)
-	userData := requestData{}
-
-	err := decoder.Decode(&userData)
+	// the access token is optional here too; a chirp is hidden from the
+	// signed-in viewer when either of them has blocked the other
+	if viewerUUID, err := cfg.authenticateUser(req); err == nil {
+		blocked, err := cfg.db.IsBlocked(req.Context(), database.IsBlockedParams{BlockerID: viewerUUID, BlockedID: chirp.UserID})
+		if err != nil {
+			slog.ErrorContext(req.Context(), "check block", "error", err)
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+		if blocked {
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(errResponse)
+			return
+		}
+	}
 
-	if err != nil {
+	// deleted chirps leave a tombstone so clients can tell them apart
+	// from chirps that never existed
+	if chirp.DeletedAt.Valid {
 		errResponse, _ := json.Marshal(response{
-			Error: "Something went wrong",
+			Error:     "Chirp has been deleted",
+			ID:        chirp.ID.String(),
+			DeletedAt: chirp.DeletedAt.Time.String(),
 		})
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusGone)
 		w.Write(errResponse)
 		return
 	}
 
-	hashedPassword, err := auth.HashPassword(userData.Password)
+	media, err := cfg.mediaByChirp(req.Context(), []uuid.UUID{chirp.ID})
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
 		})
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(errResponse)
 		return
 	}
-
-	user, err := cfg.db.CreateUser(req.Context(), database.CreateUserParams{Email: userData.Email, HashedPassword: hashedPassword})
+	links, err := cfg.linksByChirp(req.Context(), []uuid.UUID{chirp.ID})
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
 		})
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(errResponse)
 		return
 	}
 
-	println(user.IsChirpyRed)
-
 	successResponse, _ := json.Marshal(response{
-		ID:          user.ID.String(),
-		Email:       user.Email,
-		IsChirpyRed: user.IsChirpyRed,
-		CreatedAt:   user.CreatedAt.String(),
-		UpdatedAt:   user.UpdatedAt.String(),
+		ID:        chirp.ID.String(),
+		Body:      chirp.Body,
+		UserID:    chirp.UserID.String(),
+		Media:     media[chirp.ID],
+		Links:     links[chirp.ID],
+		CreatedAt: chirp.CreatedAt.String(),
+		UpdatedAt: chirp.UpdatedAt.String(),
 	})
-	w.WriteHeader(http.StatusCreated)
+	w.WriteHeader(http.StatusOK)
 	w.Write(successResponse)
 }
 
-func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
+func (cfg *apiConfig) createUser(w http.ResponseWriter, req *http.Request) {
 	type requestData struct {
 		Email    string `json:"email"`
 		Password string `json:"password"`
@@ -415,30 +629,18 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
 		Error       string `json:"error,omitempty"`
 		ID          string `json:"id,omitempty"`
 		Email       string `json:"email,omitempty"`
-		IsChirpyRed bool   `json:"is_chirpy_red,omitempty"`
+		IsChirpyRed bool   `json:"is_chirpy_red"`
+		CreatedAt   string `json:"created_at,omitempty"`
 		UpdatedAt   string `json:"updated_at,omitempty"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 
-	// check access token
-	bearerToken, err := auth.GetBearerToken(req.Header)
-	// println("bearerToken", bearerToken)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
-	userUUID, err := auth.ValidateJWT(bearerToken, cfg.authSecret)
-	if err != nil {
-		w.WriteHeader(http.StatusUnauthorized)
-		return
-	}
-
 	decoder := json.NewDecoder(req.Body)
 	userData := requestData{}
 
-	err = decoder.Decode(&userData)
+	err := decoder.Decode(&userData)
+
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
@@ -458,7 +660,7 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	user, err := cfg.db.UpdateUser(req.Context(), database.UpdateUserParams{ID: userUUID, Email: userData.Email, HashedPassword: hashedPassword})
+	user, err := cfg.db.CreateUser(req.Context(), database.CreateUserParams{Email: userData.Email, HashedPassword: hashedPassword})
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
@@ -472,9 +674,10 @@ func (cfg *apiConfig) updateUser(w http.ResponseWriter, req *http.Request) {
 		ID:          user.ID.String(),
 		Email:       user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		CreatedAt:   user.CreatedAt.String(),
 		UpdatedAt:   user.UpdatedAt.String(),
 	})
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusCreated)
 	w.Write(successResponse)
 }
 
@@ -493,6 +696,9 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, req *http.Request) {
 		RefreshToken string `json:"refresh_token,omitempty"`
 		CreatedAt    string `json:"created_at,omitempty"`
 		UpdatedAt    string `json:"updated_at,omitempty"`
+
+		SuspendedUntil string `json:"suspended_until,omitempty"`
+		Reason         string `json:"reason,omitempty"`
 	}
 
 	w.Header().Set("Content-Type", "application/json")
@@ -514,6 +720,8 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, req *http.Request) {
 	// fetch user by email
 	user, err := cfg.db.GetUserByEmail(req.Context(), reqData.Email)
 	if err != nil {
+		cfg.metrics.failedLogins.Inc()
+		cfg.recordAudit(req, uuid.Nil, audit.ActionLoginFailed, reqData.Email)
 		errResponse, _ := json.Marshal(response{
 			Error: "Incorrect email or password",
 		})
@@ -522,13 +730,10 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	// printF(user)
-	// fmt.Printf("%+v\n", user)
-	fmt.Printf("%+v\n", reqData.Password)
-	fmt.Printf("%+v\n", user.HashedPassword)
-
 	err = auth.CheckPasswordHash(user.HashedPassword, reqData.Password)
 	if err != nil {
+		cfg.metrics.failedLogins.Inc()
+		cfg.recordAudit(req, uuid.Nil, audit.ActionLoginFailed, reqData.Email)
 		errResponse, _ := json.Marshal(response{
 			Error: "Incorrect email or password",
 		})
@@ -537,29 +742,64 @@ func (cfg *apiConfig) loginUser(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	expiry, _ := time.ParseDuration("3600s")
-	token, err := auth.MakeJWT(user.ID, cfg.authSecret, expiry)
+	// only tell people with the right password why they can't sign in
+	if isSuspended(user, time.Now().UTC()) {
+		cfg.recordAudit(req, uuid.Nil, audit.ActionLoginFailed, reqData.Email)
+		resp := response{
+			Error:  "Account suspended",
+			Reason: user.BanReason,
+		}
+		if user.BannedAt.Valid {
+			resp.Error = "Account banned"
+		} else {
+			resp.SuspendedUntil = user.SuspendedUntil.Time.Format(time.RFC3339)
+		}
+		errResponse, _ := json.Marshal(resp)
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(errResponse)
+		return
+	}
+
+	// Logging in cancels a pending account deletion. That and the new
+	// session must land together, or the account could be deleted under a
+	// user who was told they signed in.
+	refreshTokenString, _ := auth.MakeRefreshToken()
+	var refresh database.RefreshToken
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		if user.DeletionScheduledAt.Valid {
+			err := tx.CancelUserDeletion(req.Context(), user.ID)
+			if err != nil {
+				return err
+			}
+		}
+		var err error
+		refresh, err = tx.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{Token: refreshTokenString, UserID: user.ID})
+		return err
+	})
 	if err != nil {
+		slog.ErrorContext(req.Context(), "create refresh token", "error", err)
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
 		})
-		w.WriteHeader(http.StatusBadRequest)
+		w.WriteHeader(http.StatusInternalServerError)
 		w.Write(errResponse)
 		return
 	}
 
-	refreshTokenString, _ := auth.MakeRefreshToken()
-
-	refresh, err := cfg.db.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{Token: refreshTokenString, UserID: user.ID})
+	expiry, _ := time.ParseDuration("3600s")
+	token, err := auth.MakeJWT(user.ID, cfg.authSecret, expiry)
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Something went wrong",
 		})
-		w.WriteHeader(http.StatusInternalServerError)
+		w.WriteHeader(http.StatusBadRequest)
 		w.Write(errResponse)
 		return
 	}
 
+	cfg.metrics.logins.Inc()
+	cfg.recordAudit(req, user.ID, audit.ActionLogin, user.ID.String())
+
 	successResponse, _ := json.Marshal(response{
 		ID:           user.ID.String(),
 		Email:        user.Email,
@@ -580,7 +820,6 @@ func (cfg *apiConfig) refreshAccessToken(w http.ResponseWriter, req *http.Reques
 	}
 
 	bearerRefreshToken, err := auth.GetBearerToken(req.Header)
-	println("refreshAccessToken() bearerRefreshToken", bearerRefreshToken)
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "No authorization header",
@@ -591,8 +830,6 @@ func (cfg *apiConfig) refreshAccessToken(w http.ResponseWriter, req *http.Reques
 	}
 
 	refreshTokenDB, err := cfg.db.GetUserFromRefreshToken(req.Context(), bearerRefreshToken)
-	println("refreshAccessToken() refreshTokenDB", refreshTokenDB.UserID.String(), refreshTokenDB.ExpiresAt.String())
-
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "Invalid token",
@@ -601,8 +838,10 @@ func (cfg *apiConfig) refreshAccessToken(w http.ResponseWriter, req *http.Reques
 		w.Write(errResponse)
 		return
 	}
+	setRequestUserID(req.Context(), refreshTokenDB.UserID)
+
 	if time.Now().After(refreshTokenDB.ExpiresAt) {
-		println("refreshAccessToken() refresh token expired", time.Now().String())
+		slog.InfoContext(req.Context(), "refresh token expired", "expires_at", refreshTokenDB.ExpiresAt)
 
 		errResponse, _ := json.Marshal(response{
 			Error: "Invalid token",
@@ -612,7 +851,7 @@ func (cfg *apiConfig) refreshAccessToken(w http.ResponseWriter, req *http.Reques
 		return
 	}
 	if refreshTokenDB.RevokedAt.Valid {
-		println("refreshAccessToken() refresh token revoked", time.Now().String())
+		slog.InfoContext(req.Context(), "refresh token revoked", "revoked_at", refreshTokenDB.RevokedAt.Time)
 
 		errResponse, _ := json.Marshal(response{
 			Error: "Invalid token",
@@ -621,9 +860,21 @@ func (cfg *apiConfig) refreshAccessToken(w http.ResponseWriter, req *http.Reques
 		w.Write(errResponse)
 		return
 	}
-
-	// println("refreshAccessToken() no errors", refreshTokenDB.ExpiresAt.String(), refreshTokenDB.UserID.String())
-	// return
+	if _, err := cfg.activeUser(req.Context(), refreshTokenDB.UserID); errors.Is(err, errSuspended) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Account suspended",
+		})
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(errResponse)
+		return
+	} else if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid token",
+		})
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write(errResponse)
+		return
+	}
 
 	expiry, _ := time.ParseDuration("3600s")
 	accessToken, err := auth.MakeJWT(refreshTokenDB.UserID, cfg.authSecret, expiry)
@@ -650,7 +901,6 @@ func (cfg *apiConfig) revokeAccessToken(w http.ResponseWriter, req *http.Request
 	}
 
 	bearerRefreshToken, err := auth.GetBearerToken(req.Header)
-	// println("bearerRefreshToken", bearerRefreshToken)
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
 			Error: "No authorization header",
@@ -660,6 +910,9 @@ func (cfg *apiConfig) revokeAccessToken(w http.ResponseWriter, req *http.Request
 		return
 	}
 
+	// look the token up first so the audit log can say whose it was
+	refreshTokenDB, lookupErr := cfg.db.GetUserFromRefreshToken(req.Context(), bearerRefreshToken)
+
 	err = cfg.db.RevokeRefreshToken(req.Context(), bearerRefreshToken)
 	if err != nil {
 		errResponse, _ := json.Marshal(response{
@@ -669,6 +922,9 @@ func (cfg *apiConfig) revokeAccessToken(w http.ResponseWriter, req *http.Request
 		w.Write(errResponse)
 		return
 	}
+	if lookupErr == nil && !refreshTokenDB.RevokedAt.Valid {
+		cfg.recordAudit(req, refreshTokenDB.UserID, audit.ActionTokenRevoke, refreshTokenDB.UserID.String())
+	}
 
 	successResponse, _ := json.Marshal(response{
 		Message: "Access token revoked!",
@@ -707,6 +963,8 @@ func (cfg *apiConfig) upgradeUser(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	cfg.metrics.webhooksProcessed.Inc()
+
 	if webHookData.Event != "user.upgraded" {
 		w.WriteHeader(http.StatusNoContent)
 		return
@@ -723,6 +981,7 @@ func (cfg *apiConfig) upgradeUser(w http.ResponseWriter, req *http.Request) {
 		w.WriteHeader(http.StatusNotFound)
 		return
 	}
+	cfg.recordAudit(req, uuid.Nil, audit.ActionWebhookUpgrade, userUUID.String())
 
 	w.WriteHeader(http.StatusNoContent)
 }
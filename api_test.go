@@ -0,0 +1,758 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/blob"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/chirpy/internal/sealed"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	testAuthSecret = "test-auth-secret"
+	testPolkaKey   = "test-polka-key"
+)
+
+// testAPI is a running server wired to an in-memory store.
+type testAPI struct {
+	t     *testing.T
+	cfg   *apiConfig
+	srv   *httptest.Server
+	store *store.Memory
+	mail  *testMailer
+}
+
+// testMailer keeps every email sent instead of delivering it.
+type testMailer struct {
+	mu   sync.Mutex
+	sent []testEmail
+}
+
+type testEmail struct {
+	To, Subject, Body string
+}
+
+func (m *testMailer) Send(ctx context.Context, to, subject, body string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, testEmail{To: to, Subject: subject, Body: body})
+	return nil
+}
+
+func (m *testMailer) last() (testEmail, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.sent) == 0 {
+		return testEmail{}, false
+	}
+	return m.sent[len(m.sent)-1], true
+}
+
+func newTestAPI(t *testing.T) *testAPI {
+	t.Helper()
+
+	mem := store.NewMemory()
+	mail := &testMailer{}
+	blobs, err := blob.NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	messageBox, err := sealed.NewBox(bytes.Repeat([]byte{1}, sealed.KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &apiConfig{
+		authSecret:  testAuthSecret,
+		polkaSecret: testPolkaKey,
+		db:          mem,
+		metrics:     newMetrics(nil),
+		mailer:      mail,
+		blobs:       blobs,
+		publicURL:   "http://chirpy.test",
+		chirpLimits: defaultChirpLimits,
+		hub:         pubsub.NewHub(streamHistorySize, streamBufferSize),
+		messageBox:  messageBox,
+
+		chirpRestoreWindow: time.Hour,
+	}
+	srv := httptest.NewServer(cfg.routes())
+	t.Cleanup(srv.Close)
+
+	return &testAPI{t: t, cfg: cfg, srv: srv, store: mem, mail: mail}
+}
+
+// do sends body as JSON (or verbatim if it is a string) and returns the
+// status code and raw response body.
+func (api *testAPI) do(method, path, authorization string, body any) (int, []byte) {
+	api.t.Helper()
+
+	var reqBody io.Reader
+	switch b := body.(type) {
+	case nil:
+	case string:
+		reqBody = strings.NewReader(b)
+	default:
+		data, err := json.Marshal(b)
+		if err != nil {
+			api.t.Fatal(err)
+		}
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequest(method, api.srv.URL+path, reqBody)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+
+	resp, err := api.srv.Client().Do(req)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	return resp.StatusCode, respBody
+}
+
+type testUser struct {
+	ID           string
+	Email        string
+	Password     string
+	Token        string
+	RefreshToken string
+}
+
+func (u testUser) bearer() string {
+	return "Bearer " + u.Token
+}
+
+// signUp creates a user and logs them in.
+func (api *testAPI) signUp(email string) testUser {
+	api.t.Helper()
+
+	user := testUser{Email: email, Password: "password-" + email}
+	code, body := api.do("POST", "/api/users", "", map[string]string{"email": user.Email, "password": user.Password})
+	if code != http.StatusCreated {
+		api.t.Fatalf("create user: status %d: %s", code, body)
+	}
+
+	var login struct {
+		ID           string `json:"id"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	code, body = api.do("POST", "/api/login", "", map[string]string{"email": user.Email, "password": user.Password})
+	if code != http.StatusOK {
+		api.t.Fatalf("login: status %d: %s", code, body)
+	}
+	decode(api.t, body, &login)
+
+	user.ID = login.ID
+	user.Token = login.Token
+	user.RefreshToken = login.RefreshToken
+	return user
+}
+
+type testChirp struct {
+	ID     string `json:"id"`
+	Body   string `json:"body"`
+	UserID string `json:"user_id"`
+	Error  string `json:"error"`
+}
+
+func (api *testAPI) chirp(user testUser, body string) testChirp {
+	api.t.Helper()
+
+	code, resp := api.do("POST", "/api/chirps", user.bearer(), map[string]string{"body": body})
+	if code != http.StatusCreated {
+		api.t.Fatalf("create chirp: status %d: %s", code, resp)
+	}
+	var chirp testChirp
+	decode(api.t, resp, &chirp)
+	return chirp
+}
+
+func decode(t *testing.T, body []byte, v any) {
+	t.Helper()
+	if err := json.Unmarshal(body, v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+}
+
+func TestCreateUser(t *testing.T) {
+	api := newTestAPI(t)
+	api.signUp("taken@example.com")
+
+	tests := []struct {
+		name     string
+		body     any
+		wantCode int
+	}{
+		{
+			name:     "Valid user",
+			body:     map[string]string{"email": "new@example.com", "password": "secret"},
+			wantCode: http.StatusCreated,
+		},
+		{
+			name:     "Email already registered",
+			body:     map[string]string{"email": "taken@example.com", "password": "secret"},
+			wantCode: http.StatusBadRequest,
+		},
+		{
+			name:     "Malformed JSON",
+			body:     "{",
+			wantCode: http.StatusBadRequest,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/api/users", "", tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+			if code != http.StatusCreated {
+				return
+			}
+
+			var user map[string]any
+			decode(t, body, &user)
+			if user["email"] != "new@example.com" {
+				t.Errorf("email = %v", user["email"])
+			}
+			if _, ok := user["password"]; ok {
+				t.Errorf("response leaks password")
+			}
+			if user["is_chirpy_red"] != false {
+				t.Errorf("is_chirpy_red = %v, want false", user["is_chirpy_red"])
+			}
+		})
+	}
+}
+
+func TestLoginUser(t *testing.T) {
+	api := newTestAPI(t)
+
+	code, _ := api.do("POST", "/api/users", "", map[string]string{"email": "a@example.com", "password": "right"})
+	if code != http.StatusCreated {
+		t.Fatalf("create user: status %d", code)
+	}
+
+	tests := []struct {
+		name     string
+		email    string
+		password string
+		wantCode int
+	}{
+		{name: "Wrong password", email: "a@example.com", password: "wrong", wantCode: http.StatusUnauthorized},
+		{name: "Unknown email", email: "b@example.com", password: "right", wantCode: http.StatusUnauthorized},
+		{name: "Correct credentials", email: "a@example.com", password: "right", wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/api/login", "", map[string]string{"email": tt.email, "password": tt.password})
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			var login struct {
+				ID           string `json:"id"`
+				Token        string `json:"token"`
+				RefreshToken string `json:"refresh_token"`
+			}
+			decode(t, body, &login)
+			userID, err := auth.ValidateJWT(login.Token, testAuthSecret)
+			if err != nil {
+				t.Fatalf("login returned invalid token: %v", err)
+			}
+			if userID.String() != login.ID {
+				t.Errorf("token subject = %v, want %v", userID, login.ID)
+			}
+			if login.RefreshToken == "" {
+				t.Errorf("login returned no refresh token")
+			}
+		})
+	}
+}
+
+// TestUpdateUser checks that the legacy PUT /api/users goes through the
+// same checks as PATCH /api/users/me.
+func TestUpdateUser(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("old@example.com")
+	api.signUp("other@example.com")
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		wantCode      int
+	}{
+		{
+			name:     "Missing token",
+			body:     map[string]string{"email": "new@example.com"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "Invalid token",
+			authorization: "Bearer not-a-jwt",
+			body:          map[string]string{"email": "new@example.com"},
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Password without current password",
+			authorization: user.bearer(),
+			body:          map[string]string{"password": "new"},
+			wantCode:      http.StatusForbidden,
+		},
+		{
+			name:          "Email taken by another user",
+			authorization: user.bearer(),
+			body:          map[string]string{"email": "other@example.com"},
+			wantCode:      http.StatusConflict,
+		},
+		{
+			name:          "Valid update",
+			authorization: user.bearer(),
+			body:          map[string]string{"email": "new@example.com", "password": "new", "current_password": user.Password},
+			wantCode:      http.StatusOK,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("PUT", "/api/users", tt.authorization, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	updated, err := api.store.GetUserByID(context.Background(), uuid.MustParse(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Email != user.Email || updated.PendingEmail.String != "new@example.com" {
+		t.Errorf("email = %q, pending %q: want the new address pending verification", updated.Email, updated.PendingEmail.String)
+	}
+	if err := auth.CheckPasswordHash(updated.HashedPassword, "new"); err != nil {
+		t.Errorf("password was not updated")
+	}
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil); code != http.StatusUnauthorized {
+		t.Errorf("refresh with a token from before the password change: status %d", code)
+	}
+}
+
+func TestCreateChirp(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		wantCode      int
+		wantBody      string
+	}{
+		{
+			name:     "Missing token",
+			body:     map[string]string{"body": "hello"},
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:          "Token signed with another secret",
+			authorization: "Bearer " + mustMakeJWT(t, uuid.MustParse(user.ID), "other-secret"),
+			body:          map[string]string{"body": "hello"},
+			wantCode:      http.StatusUnauthorized,
+		},
+		{
+			name:          "Empty body",
+			authorization: user.bearer(),
+			body:          map[string]string{"body": ""},
+			wantCode:      http.StatusBadRequest,
+		},
+		{
+			name:          "Exactly 140 characters",
+			authorization: user.bearer(),
+			body:          map[string]string{"body": strings.Repeat("a", 140)},
+			wantCode:      http.StatusCreated,
+			wantBody:      strings.Repeat("a", 140),
+		},
+		{
+			name:          "141 characters",
+			authorization: user.bearer(),
+			body:          map[string]string{"body": strings.Repeat("a", 141)},
+			wantCode:      http.StatusBadRequest,
+		},
+		{
+			name:          "Profanity is masked",
+			authorization: user.bearer(),
+			body:          map[string]string{"body": "What a Kerfuffle that sharbert made, fornax!"},
+			wantCode:      http.StatusCreated,
+			wantBody:      "What a **** that **** made, fornax!",
+		},
+		{
+			name:          "Malformed JSON",
+			authorization: user.bearer(),
+			body:          "{",
+			wantCode:      http.StatusInternalServerError,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/api/chirps", tt.authorization, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+			if code != http.StatusCreated {
+				return
+			}
+
+			var chirp testChirp
+			decode(t, body, &chirp)
+			if chirp.Body != tt.wantBody {
+				t.Errorf("body = %q, want %q", chirp.Body, tt.wantBody)
+			}
+			if chirp.UserID != user.ID {
+				t.Errorf("user_id = %q, want %q", chirp.UserID, user.ID)
+			}
+		})
+	}
+}
+
+func TestGetChirps(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	first := api.chirp(alice, "first")
+	second := api.chirp(bob, "second")
+	third := api.chirp(alice, "third")
+
+	tests := []struct {
+		name    string
+		query   string
+		wantIDs []string
+	}{
+		{name: "All chirps", query: "", wantIDs: []string{first.ID, second.ID, third.ID}},
+		{name: "Newest first", query: "?sort=desc", wantIDs: []string{third.ID, second.ID, first.ID}},
+		{name: "By author", query: "?author_id=" + alice.ID, wantIDs: []string{first.ID, third.ID}},
+		{name: "Author without chirps", query: "?author_id=" + uuid.NewString(), wantIDs: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("GET", "/api/chirps"+tt.query, "", nil)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d: %s", code, body)
+			}
+
+			var chirps []testChirp
+			decode(t, body, &chirps)
+			gotIDs := []string{}
+			for _, chirp := range chirps {
+				gotIDs = append(gotIDs, chirp.ID)
+			}
+			if strings.Join(gotIDs, ",") != strings.Join(tt.wantIDs, ",") {
+				t.Errorf("ids = %v, want %v", gotIDs, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestGetChirp(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	chirp := api.chirp(user, "hello")
+
+	tests := []struct {
+		name     string
+		chirpID  string
+		wantCode int
+	}{
+		{name: "Existing chirp", chirpID: chirp.ID, wantCode: http.StatusOK},
+		{name: "Unknown chirp", chirpID: uuid.NewString(), wantCode: http.StatusNotFound},
+		{name: "Invalid ID", chirpID: "not-a-uuid", wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("GET", "/api/chirps/"+tt.chirpID, "", nil)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+			if code == http.StatusOK {
+				var got testChirp
+				decode(t, body, &got)
+				if got != chirp {
+					t.Errorf("chirp = %+v, want %+v", got, chirp)
+				}
+			}
+		})
+	}
+}
+
+func TestDeleteChirp(t *testing.T) {
+	api := newTestAPI(t)
+	owner := api.signUp("owner@example.com")
+	other := api.signUp("other@example.com")
+	chirp := api.chirp(owner, "mine")
+
+	tests := []struct {
+		name          string
+		authorization string
+		chirpID       string
+		wantCode      int
+	}{
+		{name: "Missing token", chirpID: chirp.ID, wantCode: http.StatusUnauthorized},
+		{name: "Not the author", authorization: other.bearer(), chirpID: chirp.ID, wantCode: http.StatusForbidden},
+		{name: "Unknown chirp", authorization: owner.bearer(), chirpID: uuid.NewString(), wantCode: http.StatusNotFound},
+		{name: "Invalid ID", authorization: owner.bearer(), chirpID: "not-a-uuid", wantCode: http.StatusBadRequest},
+		{name: "Author deletes", authorization: owner.bearer(), chirpID: chirp.ID, wantCode: http.StatusNoContent},
+		{name: "Already deleted", authorization: owner.bearer(), chirpID: chirp.ID, wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("DELETE", "/api/chirps/"+tt.chirpID, tt.authorization, nil)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	code, body := api.do("GET", "/api/chirps/"+chirp.ID, "", nil)
+	if code != http.StatusGone {
+		t.Errorf("get deleted chirp: status = %d, want %d", code, http.StatusGone)
+	}
+	var tombstone map[string]any
+	decode(t, body, &tombstone)
+	if tombstone["body"] != nil || tombstone["deleted_at"] == nil {
+		t.Errorf("tombstone = %v, want deleted_at and no body", tombstone)
+	}
+
+	_, body = api.do("GET", "/api/chirps", "", nil)
+	if string(body) != "[]" {
+		t.Errorf("list after delete = %s, want []", body)
+	}
+}
+
+func TestRestoreChirp(t *testing.T) {
+	api := newTestAPI(t)
+	author := api.signUp("author@example.com")
+	moderator := api.signUp("mod@example.com")
+	api.store.SetUserRole(uuid.MustParse(moderator.ID), roleModerator)
+
+	deleted := api.chirp(author, "oops")
+	api.do("DELETE", "/api/chirps/"+deleted.ID, author.bearer(), nil)
+	live := api.chirp(author, "still here")
+
+	hidden := api.chirp(author, "against the rules")
+	_, r := api.report(api.signUp("reporter@example.com"), hidden.ID, "spam")
+	api.do("POST", "/admin/reports/"+r.ID+"/claim", moderator.bearer(), nil)
+	if code, body := api.do("POST", "/admin/reports/"+r.ID+"/resolve", moderator.bearer(), map[string]string{"action": resolutionHide}); code != http.StatusOK {
+		t.Fatalf("resolve: status %d: %s", code, body)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		chirpID       string
+		wantCode      int
+	}{
+		{name: "Missing token", chirpID: deleted.ID, wantCode: http.StatusUnauthorized},
+		{name: "Regular user", authorization: author.bearer(), chirpID: deleted.ID, wantCode: http.StatusForbidden},
+		{name: "Unknown chirp", authorization: moderator.bearer(), chirpID: uuid.NewString(), wantCode: http.StatusNotFound},
+		{name: "Chirp not deleted", authorization: moderator.bearer(), chirpID: live.ID, wantCode: http.StatusConflict},
+		{name: "Chirp hidden by a report", authorization: moderator.bearer(), chirpID: hidden.ID, wantCode: http.StatusConflict},
+		{name: "Moderator restores", authorization: moderator.bearer(), chirpID: deleted.ID, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/admin/chirps/"+tt.chirpID+"/restore", tt.authorization, nil)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	if code, _ := api.do("GET", "/api/chirps/"+deleted.ID, "", nil); code != http.StatusOK {
+		t.Errorf("get restored chirp: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestRestoreWindowAndPurge(t *testing.T) {
+	api := newTestAPI(t)
+	author := api.signUp("author@example.com")
+	admin := api.signUp("admin@example.com")
+	api.store.SetUserRole(uuid.MustParse(admin.ID), roleAdmin)
+
+	chirp := api.chirp(author, "gone for good")
+	api.do("DELETE", "/api/chirps/"+chirp.ID, author.bearer(), nil)
+
+	// a negative window puts the chirp's deletion outside of it
+	api.cfg.chirpRestoreWindow = -time.Minute
+
+	if code, _ := api.do("POST", "/admin/chirps/"+chirp.ID+"/restore", admin.bearer(), nil); code != http.StatusGone {
+		t.Errorf("restore after window: status = %d, want %d", code, http.StatusGone)
+	}
+
+	if err := api.cfg.purgeDeletedChirps(context.Background()); err != nil {
+		t.Fatalf("purgeDeletedChirps() error = %v", err)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+chirp.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("get purged chirp: status = %d, want %d", code, http.StatusNotFound)
+	}
+}
+
+func TestLoginKeepsOtherSessions(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	code, body := api.do("POST", "/api/login", "", map[string]string{"email": user.Email, "password": user.Password})
+	if code != http.StatusOK {
+		t.Fatalf("second login: status = %d: %s", code, body)
+	}
+
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil); code != http.StatusOK {
+		t.Errorf("refresh with the first session's token: status = %d, want %d", code, http.StatusOK)
+	}
+}
+
+func TestRefreshAndRevoke(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantCode      int
+	}{
+		{name: "Refresh without token", path: "/api/refresh", wantCode: http.StatusUnauthorized},
+		{name: "Refresh with unknown token", path: "/api/refresh", authorization: "Bearer unknown", wantCode: http.StatusUnauthorized},
+		{name: "Refresh with valid token", path: "/api/refresh", authorization: "Bearer " + user.RefreshToken, wantCode: http.StatusOK},
+		{name: "Revoke without token", path: "/api/revoke", wantCode: http.StatusUnauthorized},
+		{name: "Revoke", path: "/api/revoke", authorization: "Bearer " + user.RefreshToken, wantCode: http.StatusNoContent},
+		{name: "Refresh with revoked token", path: "/api/refresh", authorization: "Bearer " + user.RefreshToken, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", tt.path, tt.authorization, nil)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+			if tt.path == "/api/refresh" && code == http.StatusOK {
+				var resp struct {
+					Token string `json:"token"`
+				}
+				decode(t, body, &resp)
+				userID, err := auth.ValidateJWT(resp.Token, testAuthSecret)
+				if err != nil || userID.String() != user.ID {
+					t.Errorf("refreshed token for %v, %v; want %v", userID, err, user.ID)
+				}
+			}
+		})
+	}
+}
+
+func TestUpgradeUser(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	upgrade := map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": user.ID}}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		wantCode      int
+		wantRed       bool
+	}{
+		{name: "Missing API key", body: upgrade, wantCode: http.StatusUnauthorized},
+		{name: "Wrong API key", authorization: "ApiKey wrong", body: upgrade, wantCode: http.StatusUnauthorized},
+		{name: "Bearer instead of API key", authorization: "Bearer " + testPolkaKey, body: upgrade, wantCode: http.StatusUnauthorized},
+		{
+			name:          "Other event is ignored",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          map[string]any{"event": "user.payment_failed", "data": map[string]string{"user_id": user.ID}},
+			wantCode:      http.StatusNoContent,
+		},
+		{
+			name:          "Invalid user ID",
+			authorization: "ApiKey " + testPolkaKey,
+			body:          map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": "nope"}},
+			wantCode:      http.StatusBadRequest,
+		},
+		{name: "Upgrade", authorization: "ApiKey " + testPolkaKey, body: upgrade, wantCode: http.StatusNoContent, wantRed: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/api/polka/webhooks", tt.authorization, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+
+			dbUser, err := api.store.GetUserByEmail(context.Background(), user.Email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dbUser.IsChirpyRed != tt.wantRed {
+				t.Errorf("is_chirpy_red = %v, want %v", dbUser.IsChirpyRed, tt.wantRed)
+			}
+		})
+	}
+}
+
+func TestResetUsers(t *testing.T) {
+	api := newTestAPI(t)
+	api.signUp("a@example.com")
+
+	t.Setenv("PLATFORM", "prod")
+	if code, _ := api.do("POST", "/admin/reset", "", nil); code != http.StatusForbidden {
+		t.Errorf("reset outside dev: status = %d, want %d", code, http.StatusForbidden)
+	}
+
+	t.Setenv("PLATFORM", "dev")
+	if code, _ := api.do("POST", "/admin/reset", "", nil); code != http.StatusOK {
+		t.Errorf("reset in dev: status = %d, want %d", code, http.StatusOK)
+	}
+	if _, err := api.store.GetUserByEmail(context.Background(), "a@example.com"); err == nil {
+		t.Errorf("user still exists after reset")
+	}
+}
+
+func mustMakeJWT(t *testing.T, userID uuid.UUID, secret string) string {
+	t.Helper()
+	token, err := auth.MakeJWT(userID, secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
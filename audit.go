@@ -0,0 +1,174 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chirpy/internal/audit"
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	defaultAuditPage = 50
+	maxAuditPage     = 200
+
+	// minAuditRetention matches the audit_events trigger, which refuses to
+	// delete anything newer.
+	minAuditRetention = 30 * 24 * time.Hour
+)
+
+// auditEvent describes action on target, along with the client address and
+// user agent of req. Handlers that change state record it with audit.Record
+// in the same transaction, so the change never lands without its event.
+func (cfg *apiConfig) auditEvent(req *http.Request, actor uuid.UUID, action, target string) audit.Event {
+	return audit.Event{
+		Actor:     actor,
+		Action:    action,
+		Target:    target,
+		IP:        cfg.clientIP(req),
+		UserAgent: req.UserAgent(),
+	}
+}
+
+// recordAudit adds action on target to the audit log, for requests such as
+// logins that have no transaction to record it in. Failures are logged rather
+// than returned: the request being audited has already happened.
+func (cfg *apiConfig) recordAudit(req *http.Request, actor uuid.UUID, action, target string) {
+	err := audit.Record(req.Context(), cfg.db, cfg.auditEvent(req, actor, action, target))
+	if err != nil {
+		slog.ErrorContext(req.Context(), "record audit event", "action", action, "error", err)
+	}
+}
+
+// auditEventItem is an audit event as admins see it.
+type auditEventItem struct {
+	ID        string `json:"id"`
+	ActorID   string `json:"actor_id,omitempty"`
+	Action    string `json:"action"`
+	Target    string `json:"target,omitempty"`
+	IP        string `json:"ip"`
+	UserAgent string `json:"user_agent,omitempty"`
+	CreatedAt string `json:"created_at"`
+}
+
+func newAuditEventItem(e database.AuditEvent) auditEventItem {
+	item := auditEventItem{
+		ID:        e.ID.String(),
+		Action:    e.Action,
+		Target:    e.Target,
+		IP:        e.Ip,
+		UserAgent: e.UserAgent,
+		CreatedAt: e.CreatedAt.Format(time.RFC3339),
+	}
+	if e.ActorID.Valid {
+		item.ActorID = e.ActorID.UUID.String()
+	}
+	return item
+}
+
+// listAuditEvents shows admins the audit log, newest first. It can be
+// narrowed with the actor_id, action, target and ip parameters, and to a
+// time range with since and until in RFC 3339.
+func (cfg *apiConfig) listAuditEvents(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error      string           `json:"error,omitempty"`
+		Events     []auditEventItem `json:"events"`
+		NextCursor string           `json:"next_cursor,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := cfg.authenticateStaff(req, roleAdmin)
+	if errors.Is(err, errForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	query := req.URL.Query()
+	params := database.ListAuditEventsParams{
+		Action: optionalString(query.Get("action")),
+		Target: optionalString(query.Get("target")),
+		Ip:     optionalString(query.Get("ip")),
+	}
+	if actorID := query.Get("actor_id"); actorID != "" {
+		actorUUID, err := uuid.Parse(actorID)
+		if err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Invalid actor_id",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		params.ActorID = uuid.NullUUID{UUID: actorUUID, Valid: true}
+	}
+	for name, dst := range map[string]*sql.NullTime{"since": &params.Since, "until": &params.Until} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		at, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: name + " must be an RFC 3339 timestamp",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		*dst = sql.NullTime{Time: at.UTC(), Valid: true}
+	}
+
+	page, err := parsePage(req, defaultAuditPage, maxAuditPage)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	params.BeforeCreatedAt = page.beforeAt
+	params.BeforeID = page.beforeID
+	// fetch one extra row to learn whether there is another page
+	params.PageSize = page.size + 1
+
+	events, err := cfg.db.ListAuditEvents(req.Context(), params)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list audit events", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	resp := response{Events: []auditEventItem{}}
+	if len(events) > int(page.size) {
+		events = events[:page.size]
+		last := events[len(events)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, e := range events {
+		resp.Events = append(resp.Events, newAuditEventItem(e))
+	}
+
+	successResponse, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// optionalString turns an empty query parameter into a NULL filter.
+func optionalString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
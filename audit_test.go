@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/audit"
+	"github.com/google/uuid"
+)
+
+// auditEvents lists the audit log as admin sees it with the given filters.
+func (api *testAPI) auditEvents(admin testUser, filters url.Values) []auditEventItem {
+	api.t.Helper()
+
+	code, body := api.do("GET", "/admin/audit?"+filters.Encode(), admin.bearer(), nil)
+	if code != http.StatusOK {
+		api.t.Fatalf("list audit events: status %d: %s", code, body)
+	}
+	var page struct {
+		Events []auditEventItem `json:"events"`
+	}
+	decode(api.t, body, &page)
+	return page.Events
+}
+
+func TestAuditTrail(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+
+	api.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": "wrong"})
+	api.do("POST", "/api/login", "", map[string]string{"email": "nobody@example.com", "password": "wrong"})
+	api.do("PATCH", "/api/users/me", alice.bearer(), map[string]string{"password": "new", "current_password": alice.Password})
+	api.do("POST", "/api/revoke", "Bearer "+admin.RefreshToken, nil)
+	api.do("POST", "/api/polka/webhooks", "ApiKey "+testPolkaKey, map[string]any{"event": "user.upgraded", "data": map[string]string{"user_id": alice.ID}})
+
+	events := api.auditEvents(admin, url.Values{"actor_id": {alice.ID}})
+	if len(events) != 2 || events[0].Action != audit.ActionPasswordChange || events[1].Action != audit.ActionLogin {
+		t.Errorf("alice's events = %+v", events)
+	}
+	for _, e := range events {
+		if e.Target != alice.ID || e.IP != "127.0.0.1" || e.UserAgent == "" {
+			t.Errorf("event = %+v", e)
+		}
+	}
+
+	events = api.auditEvents(admin, url.Values{"action": {audit.ActionLoginFailed}})
+	if len(events) != 2 || events[0].Target != "nobody@example.com" || events[1].Target != alice.Email || events[0].ActorID != "" {
+		t.Errorf("failed logins = %+v", events)
+	}
+
+	tests := []struct {
+		action string
+		actor  string
+		target string
+	}{
+		{action: audit.ActionTokenRevoke, actor: admin.ID, target: admin.ID},
+		{action: audit.ActionWebhookUpgrade, target: alice.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			events := api.auditEvents(admin, url.Values{"action": {tt.action}})
+			if len(events) != 1 || events[0].ActorID != tt.actor || events[0].Target != tt.target {
+				t.Errorf("events = %+v", events)
+			}
+		})
+	}
+
+	// revoking a token that's already revoked changes nothing
+	api.do("POST", "/api/revoke", "Bearer "+admin.RefreshToken, nil)
+	if events := api.auditEvents(admin, url.Values{"action": {audit.ActionTokenRevoke}}); len(events) != 1 {
+		t.Errorf("revoked twice: %+v", events)
+	}
+}
+
+func TestAuditAccountAndAdminActions(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	carol := api.signUp("carol@example.com")
+	dave := api.signUp("dave@example.com")
+	erin := api.signUp("erin@example.com")
+
+	api.do("PATCH", "/api/users/me", alice.bearer(), map[string]string{"email": "alice@example.org"})
+	mail, _ := api.mail.last()
+	api.do("POST", "/api/users/verify-email", "", map[string]string{"token": mail.Body[strings.LastIndex(mail.Body, " ")+1:]})
+
+	api.do("POST", "/admin/users/"+bob.ID+"/suspend", admin.bearer(), map[string]any{"days": 1, "reason": "spam"})
+	api.do("POST", "/admin/users/"+bob.ID+"/unsuspend", admin.bearer(), nil)
+	api.do("POST", "/admin/users/"+carol.ID+"/ban", admin.bearer(), map[string]any{"reason": "spam"})
+
+	chirp := api.chirp(alice, "oops")
+	api.do("DELETE", "/api/chirps/"+chirp.ID, alice.bearer(), nil)
+	api.do("POST", "/admin/chirps/"+chirp.ID+"/restore", admin.bearer(), nil)
+
+	api.do("DELETE", "/api/users/me", dave.bearer(), map[string]string{"password": dave.Password})
+	api.cfg.accountDeletionGrace = 24 * time.Hour
+	api.do("DELETE", "/api/users/me", erin.bearer(), map[string]string{"password": erin.Password})
+
+	tests := []struct {
+		action string
+		actor  string
+		target string
+	}{
+		{action: audit.ActionEmailChangeRequest, actor: alice.ID, target: alice.ID},
+		{action: audit.ActionEmailChange, actor: alice.ID, target: alice.ID},
+		{action: audit.ActionUserSuspend, actor: admin.ID, target: bob.ID},
+		{action: audit.ActionUserUnsuspend, actor: admin.ID, target: bob.ID},
+		{action: audit.ActionUserBan, actor: admin.ID, target: carol.ID},
+		{action: audit.ActionChirpRestore, actor: admin.ID, target: chirp.ID},
+		{action: audit.ActionAccountDelete, actor: dave.ID, target: dave.ID},
+		{action: audit.ActionAccountDeleteScheduled, actor: erin.ID, target: erin.ID},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			events := api.auditEvents(admin, url.Values{"action": {tt.action}})
+			if len(events) != 1 || events[0].ActorID != tt.actor || events[0].Target != tt.target || events[0].IP != "127.0.0.1" {
+				t.Errorf("events = %+v", events)
+			}
+		})
+	}
+
+	// a sanction that fails leaves no event behind
+	api.do("POST", "/admin/users/"+uuid.NewString()+"/ban", admin.bearer(), map[string]any{"reason": "spam"})
+	if events := api.auditEvents(admin, url.Values{"action": {audit.ActionUserBan}}); len(events) != 1 {
+		t.Errorf("ban of unknown user recorded: %+v", events)
+	}
+}
+
+func TestAuditSurvivesReset(t *testing.T) {
+	api := newTestAPI(t)
+	api.signUp("alice@example.com")
+
+	t.Setenv("PLATFORM", "dev")
+	api.do("POST", "/admin/reset", "", nil)
+
+	admin := api.signUpAdmin("admin@example.com")
+	events := api.auditEvents(admin, url.Values{"action": {audit.ActionAdminReset}})
+	if len(events) != 1 {
+		t.Fatalf("reset events = %+v", events)
+	}
+	if events := api.auditEvents(admin, url.Values{"action": {audit.ActionLogin}}); len(events) != 2 {
+		t.Errorf("logins before and after the reset = %+v", events)
+	}
+}
+
+func TestListAuditEvents(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	mod := api.signUpModerator("mod@example.com")
+	api.signUp("alice@example.com")
+
+	code, body := api.do("GET", "/admin/audit?limit=2", admin.bearer(), nil)
+	var page struct {
+		Events     []auditEventItem `json:"events"`
+		NextCursor string           `json:"next_cursor"`
+	}
+	decode(t, body, &page)
+	if code != http.StatusOK || len(page.Events) != 2 || page.NextCursor == "" {
+		t.Fatalf("first page: status %d: %s", code, body)
+	}
+	code, body = api.do("GET", "/admin/audit?limit=2&cursor="+page.NextCursor, admin.bearer(), nil)
+	page.NextCursor = ""
+	decode(t, body, &page)
+	if code != http.StatusOK || len(page.Events) != 1 || page.NextCursor != "" {
+		t.Errorf("second page: status %d: %s", code, body)
+	}
+
+	if events := api.auditEvents(admin, url.Values{"until": {"2000-01-01T00:00:00Z"}}); len(events) != 0 {
+		t.Errorf("events before 2000 = %+v", events)
+	}
+
+	tests := []struct {
+		name          string
+		query         string
+		authorization string
+		want          int
+	}{
+		{name: "moderator", authorization: mod.bearer(), want: http.StatusForbidden},
+		{name: "anonymous", want: http.StatusUnauthorized},
+		{name: "invalid actor", query: "actor_id=nope", authorization: admin.bearer(), want: http.StatusBadRequest},
+		{name: "invalid since", query: "since=yesterday", authorization: admin.bearer(), want: http.StatusBadRequest},
+		{name: "invalid limit", query: "limit=1000", authorization: admin.bearer(), want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := api.do("GET", "/admin/audit?"+tt.query, tt.authorization, nil); code != tt.want {
+				t.Errorf("status %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// relationChange blocks, unblocks, mutes or unmutes to on behalf of from.
+//
+// A block hides each user's chirps from the other and stops them
+// interacting: no direct messages and no notifications either way. A mute
+// only hides the muted user's chirps and notifications from the muter, who
+// can still message them.
+type relationChange func(ctx context.Context, db store.Store, from, to uuid.UUID) error
+
+func blockUser(ctx context.Context, db store.Store, from, to uuid.UUID) error {
+	return db.BlockUser(ctx, database.BlockUserParams{BlockerID: from, BlockedID: to})
+}
+
+func unblockUser(ctx context.Context, db store.Store, from, to uuid.UUID) error {
+	return db.UnblockUser(ctx, database.UnblockUserParams{BlockerID: from, BlockedID: to})
+}
+
+func muteUser(ctx context.Context, db store.Store, from, to uuid.UUID) error {
+	return db.MuteUser(ctx, database.MuteUserParams{MuterID: from, MutedID: to})
+}
+
+func unmuteUser(ctx context.Context, db store.Store, from, to uuid.UUID) error {
+	return db.UnmuteUser(ctx, database.UnmuteUserParams{MuterID: from, MutedID: to})
+}
+
+// changeRelation returns a handler that applies change from the signed-in
+// user to the user in the path. Repeating a change is not an error.
+func (cfg *apiConfig) changeRelation(change relationChange) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		type response struct {
+			Error string `json:"error,omitempty"`
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		userUUID, err := cfg.authenticateUser(req)
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		otherUUID, err := uuid.Parse(req.PathValue("userID"))
+		if err != nil || otherUUID == userUUID {
+			errResponse, _ := json.Marshal(response{
+				Error: "Invalid user ID",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+
+		if _, err := cfg.db.GetUserByID(req.Context(), otherUUID); err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "User not found",
+			})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(errResponse)
+			return
+		}
+
+		err = change(req.Context(), cfg.db, userUUID, otherUUID)
+		if store.IsForeignKeyViolation(err) {
+			// the other user was deleted in the meantime
+			errResponse, _ := json.Marshal(response{
+				Error: "User not found",
+			})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(errResponse)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(req.Context(), "change user relation", "error", err)
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// hiddenTopics returns the user topics of everyone whose chirps userID
+// shouldn't see, so live sessions can drop their events.
+func (cfg *apiConfig) hiddenTopics(ctx context.Context, userID uuid.UUID) (map[string]bool, error) {
+	ids, err := cfg.db.ListHiddenAuthors(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	topics := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		topics[userTopic(id)] = true
+	}
+	return topics, nil
+}
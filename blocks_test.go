@@ -0,0 +1,213 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// chirpAuthors lists the authors of the chirps user sees at path, in order.
+func (api *testAPI) chirpAuthors(user testUser, path string) []string {
+	api.t.Helper()
+
+	authorization := ""
+	if user.Token != "" {
+		authorization = user.bearer()
+	}
+	code, body := api.do("GET", path, authorization, nil)
+	if code != http.StatusOK {
+		api.t.Fatalf("list chirps: status %d: %s", code, body)
+	}
+	var chirps []testChirp
+	decode(api.t, body, &chirps)
+	var authors []string
+	for _, c := range chirps {
+		authors = append(authors, c.UserID)
+	}
+	return authors
+}
+
+func TestBlockHidesChirps(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	carol := api.signUp("carol@example.com")
+	fromAlice := api.chirp(alice, "from alice")
+	fromBob := api.chirp(bob, "from bob")
+	api.chirp(carol, "from carol")
+
+	if code, body := api.do("POST", "/api/users/"+bob.ID+"/block", alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("block: status %d: %s", code, body)
+	}
+	// blocking twice is fine
+	if code, _ := api.do("POST", "/api/users/"+bob.ID+"/block", alice.bearer(), nil); code != http.StatusNoContent {
+		t.Errorf("block again: status %d", code)
+	}
+
+	tests := []struct {
+		name string
+		user testUser
+		path string
+		want int
+	}{
+		{name: "blocker", user: alice, path: "/api/chirps", want: 2},
+		{name: "blocked", user: bob, path: "/api/chirps", want: 2},
+		{name: "bystander", user: carol, path: "/api/chirps", want: 3},
+		{name: "anonymous", path: "/api/chirps", want: 3},
+		{name: "blocker by author", user: alice, path: "/api/chirps?author_id=" + bob.ID, want: 0},
+		{name: "blocked by author", user: bob, path: "/api/chirps?author_id=" + alice.ID, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := api.chirpAuthors(tt.user, tt.path); len(got) != tt.want {
+				t.Errorf("got chirps by %v, want %d", got, tt.want)
+			}
+		})
+	}
+
+	single := []struct {
+		name  string
+		user  testUser
+		chirp testChirp
+		want  int
+	}{
+		{name: "blocker", user: alice, chirp: fromBob, want: http.StatusNotFound},
+		{name: "blocked", user: bob, chirp: fromAlice, want: http.StatusNotFound},
+		{name: "bystander", user: carol, chirp: fromBob, want: http.StatusOK},
+		{name: "anonymous", chirp: fromBob, want: http.StatusOK},
+	}
+	for _, tt := range single {
+		if code, _ := api.do("GET", "/api/chirps/"+tt.chirp.ID, tt.user.bearer(), nil); code != tt.want {
+			t.Errorf("get single chirp as %s: status %d, want %d", tt.name, code, tt.want)
+		}
+	}
+
+	if code, _ := api.do("DELETE", "/api/users/"+bob.ID+"/block", alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("unblock: status %d", code)
+	}
+	if got := api.chirpAuthors(bob, "/api/chirps"); len(got) != 3 {
+		t.Errorf("after unblocking got chirps by %v", got)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+fromAlice.ID, bob.bearer(), nil); code != http.StatusOK {
+		t.Errorf("get single chirp after unblocking: status %d", code)
+	}
+}
+
+func TestMuteHidesChirps(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.chirp(alice, "from alice")
+	api.chirp(bob, "from bob")
+
+	if code, body := api.do("POST", "/api/users/"+bob.ID+"/mute", alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("mute: status %d: %s", code, body)
+	}
+	if got := api.chirpAuthors(alice, "/api/chirps"); len(got) != 1 || got[0] != alice.ID {
+		t.Errorf("muter sees chirps by %v", got)
+	}
+	// muting is one-sided and private
+	if got := api.chirpAuthors(bob, "/api/chirps"); len(got) != 2 {
+		t.Errorf("muted user sees chirps by %v", got)
+	}
+
+	if code, _ := api.do("DELETE", "/api/users/"+bob.ID+"/mute", alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("unmute: status %d", code)
+	}
+	if got := api.chirpAuthors(alice, "/api/chirps"); len(got) != 2 {
+		t.Errorf("after unmuting got chirps by %v", got)
+	}
+}
+
+func TestChangeRelationErrors(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{name: "anonymous", path: "/api/users/" + bob.ID + "/block", want: http.StatusUnauthorized},
+		{name: "self", path: "/api/users/" + alice.ID + "/block", authorization: alice.bearer(), want: http.StatusBadRequest},
+		{name: "invalid id", path: "/api/users/nope/mute", authorization: alice.bearer(), want: http.StatusBadRequest},
+		{name: "unknown user", path: "/api/users/" + uuid.NewString() + "/mute", authorization: alice.bearer(), want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := api.do("POST", tt.path, tt.authorization, nil); code != tt.want {
+				t.Errorf("status %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestBlockStopsInteractions(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(alice, "alice")
+	_, c := api.startConversation(alice, bob)
+
+	api.do("POST", "/api/users/"+alice.ID+"/block", bob.bearer(), nil)
+
+	if code, _ := api.sendMessage(alice, c.ID, "hello?"); code != http.StatusForbidden {
+		t.Errorf("message to blocker: status %d", code)
+	}
+	if code, _ := api.sendMessage(bob, c.ID, "bye"); code != http.StatusForbidden {
+		t.Errorf("message to blocked user: status %d", code)
+	}
+
+	api.chirp(bob, "hey @alice")
+	if page := api.notifications(alice, ""); len(page.Notifications) != 0 {
+		t.Errorf("mention across a block notified: %+v", page)
+	}
+}
+
+func TestMuteSilencesNotifications(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(alice, "alice")
+	api.setHandle(bob, "bob")
+
+	api.do("POST", "/api/users/"+bob.ID+"/mute", alice.bearer(), nil)
+
+	api.chirp(bob, "hey @alice")
+	if page := api.notifications(alice, ""); len(page.Notifications) != 0 {
+		t.Errorf("muted mention notified: %+v", page)
+	}
+	api.chirp(alice, "hey @bob")
+	if page := api.notifications(bob, ""); len(page.Notifications) != 1 {
+		t.Errorf("muted user wasn't notified: %+v", page)
+	}
+	// muting doesn't stop direct messages
+	if code, _ := api.startConversation(bob, alice); code != http.StatusCreated {
+		t.Errorf("conversation with muter: status %d", code)
+	}
+}
+
+func TestLiveHidesBlockedAuthors(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	carol := api.signUp("carol@example.com")
+	api.do("POST", "/api/users/"+alice.ID+"/block", bob.bearer(), nil)
+
+	client := api.openLive(alice, time.Now().Add(time.Hour))
+	client.send(liveRequest{Type: "subscribe", Channel: "timeline"})
+	client.expect("subscribed")
+
+	api.chirp(bob, "you can't see this")
+	api.chirp(carol, "but you can see this")
+	msg := client.expect("event")
+	var chirp testChirp
+	decode(t, msg.Data, &chirp)
+	if chirp.UserID != carol.ID {
+		t.Errorf("got event for chirp %+v", chirp)
+	}
+}
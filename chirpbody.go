@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/database"
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	errChirpEmpty   = errors.New("Chirp json request body is missing")
+	errChirpTooLong = errors.New("Chirp is too long")
+)
+
+var profanities = []string{"kerfuffle", "sharbert", "fornax"}
+
+// chirpLimits holds the maximum chirp length for each account tier.
+type chirpLimits struct {
+	Default   int `json:"default"`
+	ChirpyRed int `json:"chirpy_red"`
+}
+
+var defaultChirpLimits = chirpLimits{Default: 140, ChirpyRed: 140}
+
+func (l chirpLimits) forUser(user database.User) int {
+	if user.IsChirpyRed {
+		return l.ChirpyRed
+	}
+	return l.Default
+}
+
+// prepareChirpBody normalizes body to NFC, checks it against maxLength and
+// censors profanity. Whitespace is kept as written.
+func prepareChirpBody(body string, maxLength int) (string, error) {
+	body = norm.NFC.String(body)
+	if strings.TrimSpace(body) == "" {
+		return "", errChirpEmpty
+	}
+	if chirpLength(body) > maxLength {
+		return "", errChirpTooLong
+	}
+	return censorProfanity(body), nil
+}
+
+// chirpLength counts the Unicode code points in an NFC-normalized body,
+// with every URL counted as shortLinkLength. Clients must count the same way
+// to show an accurate counter; see getLimits.
+func chirpLength(body string) int {
+	length := utf8.RuneCountInString(body)
+	for _, link := range findLinks(body) {
+		length += shortLinkLength - utf8.RuneCountInString(body[link[0]:link[1]])
+	}
+	return length
+}
+
+// censorProfanity masks every whitespace-separated word that is on the
+// profanity list, ignoring case.
+func censorProfanity(body string) string {
+	var b strings.Builder
+	for len(body) > 0 {
+		end := strings.IndexFunc(body, unicode.IsSpace)
+		if end < 0 {
+			end = len(body)
+		}
+		if slices.Contains(profanities, strings.ToLower(body[:end])) {
+			b.WriteString("****")
+		} else {
+			b.WriteString(body[:end])
+		}
+
+		space := strings.IndexFunc(body[end:], func(r rune) bool { return !unicode.IsSpace(r) })
+		if space < 0 {
+			space = len(body) - end
+		}
+		b.WriteString(body[end : end+space])
+		body = body[end+space:]
+	}
+	return b.String()
+}
+
+// getLimits publishes the rules createChirp enforces, so clients can count
+// characters the same way. With an access token, max_length is the limit
+// for the caller's tier.
+func (cfg *apiConfig) getLimits(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		ChirpLength    chirpLimits `json:"chirp_length"`
+		MaxLength      int         `json:"max_length"`
+		LinkLength     int         `json:"link_length"`
+		Counting       string      `json:"counting"`
+		MaxMedia       int         `json:"max_media"`
+		MaxUploadBytes int         `json:"max_upload_bytes"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	maxLength := cfg.chirpLimits.Default
+	if userUUID, err := cfg.authenticateUser(req); err == nil {
+		if user, err := cfg.db.GetUserByID(req.Context(), userUUID); err == nil {
+			maxLength = cfg.chirpLimits.forUser(user)
+		}
+	}
+
+	successResponse, _ := json.Marshal(response{
+		ChirpLength:    cfg.chirpLimits,
+		MaxLength:      maxLength,
+		LinkLength:     shortLinkLength,
+		Counting:       "nfc_code_points",
+		MaxMedia:       maxChirpMedia,
+		MaxUploadBytes: maxUploadBytes,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestPrepareChirpBody(t *testing.T) {
+	tests := []struct {
+		name     string
+		body     string
+		wantBody string
+		wantErr  error
+	}{
+		{name: "Japanese", body: strings.Repeat("日本語", 46), wantBody: strings.Repeat("日本語", 46)},
+		{name: "Emoji at the limit", body: strings.Repeat("🐦", 140), wantBody: strings.Repeat("🐦", 140)},
+		{name: "Emoji over the limit", body: strings.Repeat("🐦", 141), wantErr: errChirpTooLong},
+		{name: "Decomposed accents are normalized", body: strings.Repeat("e\u0301", 140), wantBody: strings.Repeat("\u00e9", 140)},
+		{name: "Whitespace is kept", body: "kerfuffle\tok\n\nFornax  end", wantBody: "****\tok\n\n****  end"},
+		{name: "Punctuation is not a word boundary", body: "Sharbert!", wantBody: "Sharbert!"},
+		{name: "Only whitespace", body: " \n\t", wantErr: errChirpEmpty},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := prepareChirpBody(tt.body, 140)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.wantBody {
+				t.Errorf("body = %q, want %q", got, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestChirpLimitsPerTier(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.chirpLimits = chirpLimits{Default: 10, ChirpyRed: 20}
+	user := api.signUp("a@example.com")
+	red := api.signUp("red@example.com")
+	if err := api.store.UpgradeUserToChirpyRed(context.Background(), uuid.MustParse(red.ID)); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          string
+		wantCode      int
+		wantMax       int
+	}{
+		{name: "Default tier", authorization: user.bearer(), body: strings.Repeat("a", 11), wantCode: http.StatusBadRequest, wantMax: 10},
+		{name: "Chirpy Red tier", authorization: red.bearer(), body: strings.Repeat("a", 11), wantCode: http.StatusCreated, wantMax: 20},
+		{name: "Chirpy Red over its limit", authorization: red.bearer(), body: strings.Repeat("a", 21), wantCode: http.StatusBadRequest, wantMax: 20},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/api/chirps", tt.authorization, map[string]string{"body": tt.body})
+			if code != tt.wantCode {
+				t.Errorf("create chirp: status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+
+			var limits struct {
+				ChirpLength chirpLimits `json:"chirp_length"`
+				MaxLength   int         `json:"max_length"`
+				LinkLength  int         `json:"link_length"`
+			}
+			_, body = api.do("GET", "/api/config/limits", tt.authorization, nil)
+			decode(t, body, &limits)
+			if limits.MaxLength != tt.wantMax || limits.ChirpLength != api.cfg.chirpLimits || limits.LinkLength != shortLinkLength {
+				t.Errorf("limits = %+v, want max_length %d", limits, tt.wantMax)
+			}
+		})
+	}
+
+	code, body := api.do("GET", "/api/config/limits", "", nil)
+	var anonymous struct {
+		MaxLength int `json:"max_length"`
+	}
+	decode(t, body, &anonymous)
+	if code != http.StatusOK || anonymous.MaxLength != 10 {
+		t.Errorf("anonymous limits: status %d, max_length %d; want 200, 10", code, anonymous.MaxLength)
+	}
+}
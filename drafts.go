@@ -0,0 +1,448 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	// maxDraftLength bounds what a draft can hold. It's well over any chirp
+	// limit so work in progress can be trimmed down before it's published.
+	maxDraftLength = 5000
+	// maxDrafts is how many drafts one user can keep.
+	maxDrafts = 100
+)
+
+var (
+	errDraftNotFound = errors.New("draft not found")
+	errTooManyDrafts = errors.New("too many drafts")
+)
+
+// draftItem is a draft as its author sees it. The body is stored as written:
+// it's only normalized and censored when the draft is published.
+type draftItem struct {
+	ID        string `json:"id"`
+	Body      string `json:"body"`
+	CreatedAt string `json:"created_at"`
+	UpdatedAt string `json:"updated_at"`
+}
+
+func newDraftItem(d database.Draft) draftItem {
+	return draftItem{
+		ID:        d.ID.String(),
+		Body:      d.Body,
+		CreatedAt: d.CreatedAt.Format(time.RFC3339),
+		UpdatedAt: d.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// createDraft saves a new draft for the caller.
+func (cfg *apiConfig) createDraft(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Body string `json:"body"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		draftItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if utf8.RuneCountInString(data.Body) > maxDraftLength {
+		errResponse, _ := json.Marshal(response{
+			Error: "Draft is too long",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	var draft database.Draft
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		count, err := tx.CountDraftsByUser(req.Context(), userUUID)
+		if err != nil {
+			return err
+		}
+		if count >= maxDrafts {
+			return errTooManyDrafts
+		}
+		draft, err = tx.CreateDraft(req.Context(), database.CreateDraftParams{
+			UserID: userUUID,
+			Body:   data.Body,
+		})
+		return err
+	})
+	if errors.Is(err, errTooManyDrafts) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Too many drafts",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "create draft", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		draftItem: newDraftItem(draft),
+	})
+	w.WriteHeader(http.StatusCreated)
+	w.Write(successResponse)
+}
+
+// listDrafts returns the caller's drafts, most recently edited first.
+func (cfg *apiConfig) listDrafts(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	drafts, err := cfg.db.ListDraftsByUser(req.Context(), userUUID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list drafts", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	items := []draftItem{}
+	for _, d := range drafts {
+		items = append(items, newDraftItem(d))
+	}
+	successResponse, _ := json.Marshal(items)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// getDraft returns one of the caller's drafts. Other users' drafts are
+// reported as not found.
+func (cfg *apiConfig) getDraft(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+		draftItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	draftUUID, err := uuid.Parse(req.PathValue("draftID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid draft ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	draft, err := cfg.db.GetDraft(req.Context(), database.GetDraftParams{
+		ID:     draftUUID,
+		UserID: userUUID,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Draft not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "get draft", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		draftItem: newDraftItem(draft),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// updateDraft replaces the body of one of the caller's drafts.
+func (cfg *apiConfig) updateDraft(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Body string `json:"body"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		draftItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	draftUUID, err := uuid.Parse(req.PathValue("draftID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid draft ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if utf8.RuneCountInString(data.Body) > maxDraftLength {
+		errResponse, _ := json.Marshal(response{
+			Error: "Draft is too long",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	draft, err := cfg.db.UpdateDraft(req.Context(), database.UpdateDraftParams{
+		ID:     draftUUID,
+		UserID: userUUID,
+		Body:   data.Body,
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Draft not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "update draft", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		draftItem: newDraftItem(draft),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// deleteDraft discards one of the caller's drafts.
+func (cfg *apiConfig) deleteDraft(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	draftUUID, err := uuid.Parse(req.PathValue("draftID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid draft ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	deleted, err := cfg.db.DeleteDraft(req.Context(), database.DeleteDraftParams{
+		ID:     draftUUID,
+		UserID: userUUID,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "delete draft", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+	if deleted == 0 {
+		errResponse, _ := json.Marshal(response{
+			Error: "Draft not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishDraft turns one of the caller's drafts into a chirp, or with
+// publish_at into a scheduled chirp, attaching any media_ids as createChirp
+// does. The draft is deleted and its body read in the same transaction that
+// creates the chirp, so it's published at most once and an edit made
+// meanwhile is never lost. If the body or media are rejected the draft is
+// left as it was.
+func (cfg *apiConfig) publishDraft(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		MediaIDs  []string `json:"media_ids"`
+		PublishAt string   `json:"publish_at"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	user, err := cfg.authenticatedUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	draftUUID, err := uuid.Parse(req.PathValue("draftID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid draft ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	// the request body is optional
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil && !errors.Is(err, io.EOF) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	var chirp database.Chirp
+	var notes []database.Notification
+	// invalid is the client-facing reason the draft was rejected; returning
+	// it rolls back the delete so the draft is kept
+	var invalid error
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		draft, err := tx.TakeDraft(req.Context(), database.TakeDraftParams{
+			ID:     draftUUID,
+			UserID: user.ID,
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			return errDraftNotFound
+		}
+		if err != nil {
+			return err
+		}
+		c, err := cfg.prepareChirp(user, draft.Body, data.MediaIDs, data.PublishAt)
+		if err != nil {
+			invalid = err
+			return err
+		}
+		chirp, notes, err = cfg.storeChirp(req.Context(), tx, user.ID, c)
+		return err
+	})
+	if invalid != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: invalid.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if errors.Is(err, errDraftNotFound) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Draft not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	if errors.Is(err, errMediaUnavailable) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Media not found or already attached",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "publish draft", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	cfg.writeCreatedChirp(w, req, chirp, notes)
+}
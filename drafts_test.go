@@ -0,0 +1,195 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// draft saves body as a new draft of user's.
+func (api *testAPI) draft(user testUser, body string) draftItem {
+	api.t.Helper()
+
+	code, resp := api.do("POST", "/api/drafts", user.bearer(), map[string]string{"body": body})
+	if code != http.StatusCreated {
+		api.t.Fatalf("create draft: status %d: %s", code, resp)
+	}
+	var draft draftItem
+	decode(api.t, resp, &draft)
+	return draft
+}
+
+func TestDrafts(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	// drafts keep what was written, profanity included
+	first := api.draft(alice, "what a kerfuffle")
+	second := api.draft(alice, "")
+	if first.Body != "what a kerfuffle" {
+		t.Errorf("draft body = %q", first.Body)
+	}
+
+	code, body := api.do("PUT", "/api/drafts/"+first.ID, alice.bearer(), map[string]string{"body": "what a sharbert"})
+	var updated draftItem
+	decode(t, body, &updated)
+	if code != http.StatusOK || updated.Body != "what a sharbert" {
+		t.Fatalf("update: status %d: %s", code, body)
+	}
+
+	code, body = api.do("GET", "/api/drafts/"+first.ID, alice.bearer(), nil)
+	var got draftItem
+	decode(t, body, &got)
+	if code != http.StatusOK || got.Body != "what a sharbert" {
+		t.Errorf("get: status %d: %s", code, body)
+	}
+
+	code, body = api.do("GET", "/api/drafts", alice.bearer(), nil)
+	var drafts []draftItem
+	decode(t, body, &drafts)
+	if code != http.StatusOK || len(drafts) != 2 {
+		t.Fatalf("list: status %d: %s", code, body)
+	}
+	code, body = api.do("GET", "/api/drafts", bob.bearer(), nil)
+	if code != http.StatusOK || string(body) != "[]" {
+		t.Errorf("someone else's drafts: status %d: %s", code, body)
+	}
+
+	if code, body := api.do("DELETE", "/api/drafts/"+second.ID, alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", code, body)
+	}
+	if code, _ := api.do("GET", "/api/drafts/"+second.ID, alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("get deleted: status %d", code)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		user   testUser
+		body   any
+		want   int
+	}{
+		{name: "get someone else's", method: "GET", path: "/api/drafts/" + first.ID, user: bob, want: http.StatusNotFound},
+		{name: "update someone else's", method: "PUT", path: "/api/drafts/" + first.ID, user: bob, body: map[string]string{"body": "mine"}, want: http.StatusNotFound},
+		{name: "delete someone else's", method: "DELETE", path: "/api/drafts/" + first.ID, user: bob, want: http.StatusNotFound},
+		{name: "publish someone else's", method: "POST", path: "/api/drafts/" + first.ID + "/publish", user: bob, want: http.StatusNotFound},
+		{name: "delete twice", method: "DELETE", path: "/api/drafts/" + second.ID, user: alice, want: http.StatusNotFound},
+		{name: "invalid ID", method: "GET", path: "/api/drafts/nope", user: alice, want: http.StatusBadRequest},
+		{name: "too long", method: "POST", path: "/api/drafts", user: alice, body: map[string]string{"body": strings.Repeat("a", maxDraftLength+1)}, want: http.StatusBadRequest},
+		{name: "anonymous", method: "GET", path: "/api/drafts", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := api.do(tt.method, tt.path, tt.user.bearer(), tt.body); code != tt.want {
+				t.Errorf("status %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestPublishDraft(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(bob, "bob")
+	draft := api.draft(alice, "what a kerfuffle @bob")
+
+	code, body := api.do("POST", "/api/drafts/"+draft.ID+"/publish", alice.bearer(), nil)
+	var chirp testChirp
+	decode(t, body, &chirp)
+	if code != http.StatusCreated || chirp.Body != "what a **** @bob" || chirp.UserID != alice.ID {
+		t.Fatalf("publish: status %d: %s", code, body)
+	}
+
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 1 {
+		t.Errorf("chirps listed after publishing: %v", got)
+	}
+	if page := api.notifications(bob, ""); len(page.Notifications) != 1 || page.Notifications[0].ChirpID != chirp.ID {
+		t.Errorf("mention notifications: %+v", page)
+	}
+	if code, _ := api.do("GET", "/api/drafts/"+draft.ID, alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("draft kept after publishing: status %d", code)
+	}
+	if code, _ := api.do("POST", "/api/drafts/"+draft.ID+"/publish", alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("publish twice: status %d", code)
+	}
+}
+
+func TestPublishDraftScheduled(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	draft := api.draft(alice, "later")
+
+	publishAt := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	code, body := api.do("POST", "/api/drafts/"+draft.ID+"/publish", alice.bearer(), map[string]string{"publish_at": publishAt})
+	var chirp chirpItem
+	decode(t, body, &chirp)
+	if code != http.StatusCreated || chirp.Status != chirpScheduled || chirp.PublishAt != publishAt {
+		t.Fatalf("publish scheduled: status %d: %s", code, body)
+	}
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 0 {
+		t.Errorf("scheduled chirp listed: %v", got)
+	}
+}
+
+func TestPublishDraftValidation(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+
+	tests := []struct {
+		name      string
+		body      string
+		publishAt string
+	}{
+		{name: "empty", body: "  "},
+		{name: "too long", body: strings.Repeat("a", defaultChirpLimits.Default+1)},
+		{name: "publish_at in the past", body: "hi", publishAt: "2020-01-01T00:00:00Z"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			draft := api.draft(alice, tt.body)
+			code, body := api.do("POST", "/api/drafts/"+draft.ID+"/publish", alice.bearer(), map[string]string{"publish_at": tt.publishAt})
+			if code != http.StatusBadRequest {
+				t.Errorf("status %d: %s", code, body)
+			}
+			// a rejected draft is left for the author to fix
+			if _, err := api.store.GetDraft(context.Background(), database.GetDraftParams{ID: uuid.MustParse(draft.ID), UserID: uuid.MustParse(alice.ID)}); err != nil {
+				t.Errorf("draft gone after a rejected publish: %v", err)
+			}
+		})
+	}
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 0 {
+		t.Errorf("rejected drafts published: %v", got)
+	}
+}
+
+func TestPublishDraftMedia(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	mine := api.uploadImage(alice, 8, 8)
+	theirs := api.uploadImage(bob, 8, 8)
+
+	draft := api.draft(alice, "look")
+	code, body := api.do("POST", "/api/drafts/"+draft.ID+"/publish", alice.bearer(), map[string]any{"media_ids": []string{theirs.ID}})
+	if code != http.StatusBadRequest {
+		t.Errorf("publish with someone else's media: status %d: %s", code, body)
+	}
+	if code, _ := api.do("GET", "/api/drafts/"+draft.ID, alice.bearer(), nil); code != http.StatusOK {
+		t.Errorf("draft gone after a rejected publish: status %d", code)
+	}
+
+	code, body = api.do("POST", "/api/drafts/"+draft.ID+"/publish", alice.bearer(), map[string]any{"media_ids": []string{mine.ID}})
+	var chirp chirpItem
+	decode(t, body, &chirp)
+	if code != http.StatusCreated || len(chirp.Media) != 1 || chirp.Media[0].ID != mine.ID {
+		t.Fatalf("publish with media: status %d: %s", code, body)
+	}
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//go:embed sql/schema/*.sql
+var schemaFiles embed.FS
+
+const healthCheckTimeout = 2 * time.Second
+
+// healthCheck is a single dependency probed by GET /readyz.
+type healthCheck struct {
+	Name  string
+	Check func(ctx context.Context) error
+}
+
+// checkResult is a check's outcome as /readyz reports it. The endpoint is
+// unauthenticated, so why a check failed only goes to the log.
+type checkResult struct {
+	Status string `json:"status"`
+}
+
+type healthResponse struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// databaseCheck pings the database.
+func databaseCheck(db *sql.DB) healthCheck {
+	return healthCheck{
+		Name: "database",
+		Check: func(ctx context.Context) error {
+			return db.PingContext(ctx)
+		},
+	}
+}
+
+// migrationsCheck fails until goose has applied every migration embedded in
+// this binary, so a replica never serves traffic against an older schema.
+func migrationsCheck(db *sql.DB) healthCheck {
+	return healthCheck{
+		Name: "migrations",
+		Check: func(ctx context.Context) error {
+			want, err := latestMigrationVersion()
+			if err != nil {
+				return err
+			}
+
+			var got int64
+			err = db.QueryRowContext(ctx, "SELECT version_id FROM goose_db_version WHERE is_applied ORDER BY id DESC LIMIT 1").Scan(&got)
+			if err != nil {
+				return fmt.Errorf("read migration version: %w", err)
+			}
+			if got < want {
+				return fmt.Errorf("database is at migration %d, want %d", got, want)
+			}
+			return nil
+		},
+	}
+}
+
+// latestMigrationVersion returns the version of the newest file in sql/schema,
+// taken from its numeric prefix (e.g. 5 for 005_users_add_is_chirpy_red.sql).
+func latestMigrationVersion() (int64, error) {
+	entries, err := schemaFiles.ReadDir("sql/schema")
+	if err != nil {
+		return 0, err
+	}
+
+	var latest int64
+	for _, entry := range entries {
+		prefix, _, _ := strings.Cut(path.Base(entry.Name()), "_")
+		version, err := strconv.ParseInt(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s has no version prefix", entry.Name())
+		}
+		latest = max(latest, version)
+	}
+	return latest, nil
+}
+
+// livez reports that the process is up and serving HTTP. It deliberately
+// checks no dependencies, so an orchestrator only restarts us when we are
+// wedged, not when Postgres is down.
+func (cfg *apiConfig) livez(w http.ResponseWriter, req *http.Request) {
+	writeHealth(w, healthResponse{
+		Status: "ok",
+		Checks: map[string]checkResult{},
+	})
+}
+
+// readyz runs every readiness check concurrently, each with its own timeout,
+// and answers 503 if any of them fails or the server is shutting down.
+func (cfg *apiConfig) readyz(w http.ResponseWriter, req *http.Request) {
+	resp := healthResponse{
+		Status: "ok",
+		Checks: map[string]checkResult{},
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range cfg.readinessChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(req.Context(), healthCheckTimeout)
+			defer cancel()
+
+			result := checkResult{Status: "ok"}
+			if err := check.Check(ctx); err != nil {
+				slog.ErrorContext(req.Context(), "readiness check failed", "check", check.Name, "error", err)
+				result = checkResult{Status: "error"}
+			}
+
+			mu.Lock()
+			resp.Checks[check.Name] = result
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if cfg.shuttingDown.Load() {
+		resp.Checks["shutdown"] = checkResult{Status: "error"}
+	} else {
+		resp.Checks["shutdown"] = checkResult{Status: "ok"}
+	}
+
+	for _, result := range resp.Checks {
+		if result.Status != "ok" {
+			resp.Status = "unavailable"
+		}
+	}
+
+	writeHealth(w, resp)
+}
+
+func writeHealth(w http.ResponseWriter, resp healthResponse) {
+	body, _ := json.Marshal(resp)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+	w.Write(body)
+}
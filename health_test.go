@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestReadyz(t *testing.T) {
+	ok := healthCheck{Name: "database", Check: func(context.Context) error { return nil }}
+	failing := healthCheck{Name: "migrations", Check: func(context.Context) error { return errors.New("behind") }}
+
+	tests := []struct {
+		name         string
+		checks       []healthCheck
+		shuttingDown bool
+		wantCode     int
+		wantFailed   string
+	}{
+		{
+			name:     "All checks pass",
+			checks:   []healthCheck{ok},
+			wantCode: http.StatusOK,
+		},
+		{
+			name:       "Failing check",
+			checks:     []healthCheck{ok, failing},
+			wantCode:   http.StatusServiceUnavailable,
+			wantFailed: "migrations",
+		},
+		{
+			name:         "Shutting down",
+			checks:       []healthCheck{ok},
+			shuttingDown: true,
+			wantCode:     http.StatusServiceUnavailable,
+			wantFailed:   "shutdown",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{readinessChecks: tt.checks}
+			cfg.shuttingDown.Store(tt.shuttingDown)
+
+			rec := httptest.NewRecorder()
+			cfg.readyz(rec, httptest.NewRequest("GET", "/readyz", nil))
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+
+			if strings.Contains(rec.Body.String(), "behind") {
+				t.Errorf("body %q reveals the check's error", rec.Body.String())
+			}
+			var resp healthResponse
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Fatalf("invalid body %q: %v", rec.Body.String(), err)
+			}
+			for name, result := range resp.Checks {
+				failed := result.Status != "ok"
+				if failed != (name == tt.wantFailed) {
+					t.Errorf("check %s status = %s", name, result.Status)
+				}
+			}
+		})
+	}
+}
+
+func TestLatestMigrationVersion(t *testing.T) {
+	version, err := latestMigrationVersion()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version < 5 {
+		t.Errorf("latestMigrationVersion() = %d, want at least 5", version)
+	}
+}
@@ -0,0 +1,74 @@
+// Package audit records security-relevant events, such as sign-ins,
+// credential changes and administrative actions, in an append-only log.
+package audit
+
+import (
+	"context"
+	"strings"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Actions recorded in the audit log.
+const (
+	ActionLogin              = "login"
+	ActionLoginFailed        = "login_failed"
+	ActionPasswordChange     = "password_change"
+	ActionEmailChangeRequest = "email_change_request"
+	ActionEmailChange        = "email_change"
+	ActionTokenRevoke        = "token_revoke"
+	ActionAccountDelete      = "account_delete"
+	// ActionAccountDeleteScheduled is recorded when deletion waits out a
+	// grace period, which signing in again cancels.
+	ActionAccountDeleteScheduled = "account_delete_scheduled"
+	ActionWebhookUpgrade         = "webhook_upgrade"
+	ActionAdminReset             = "admin_reset"
+	ActionUserSuspend            = "user_suspend"
+	ActionUserUnsuspend          = "user_unsuspend"
+	ActionUserBan                = "user_ban"
+	ActionChirpRestore           = "chirp_restore"
+)
+
+// maxFieldLength caps the target and user agent, which both come from the
+// client.
+const maxFieldLength = 512
+
+// Event describes something that happened, and where the request came from.
+type Event struct {
+	// Actor is the user who acted, or uuid.Nil for anonymous requests and
+	// webhooks.
+	Actor  uuid.UUID
+	Action string
+	// Target is what the action applied to, such as a user ID, or the
+	// email address a failed login tried.
+	Target    string
+	IP        string
+	UserAgent string
+}
+
+// Writer stores audit events. store.Store implements it.
+type Writer interface {
+	CreateAuditEvent(ctx context.Context, arg database.CreateAuditEventParams) (database.AuditEvent, error)
+}
+
+// Record writes e to w.
+func Record(ctx context.Context, w Writer, e Event) error {
+	_, err := w.CreateAuditEvent(ctx, database.CreateAuditEventParams{
+		ActorID:   uuid.NullUUID{UUID: e.Actor, Valid: e.Actor != uuid.Nil},
+		Action:    e.Action,
+		Target:    truncate(e.Target),
+		Ip:        e.IP,
+		UserAgent: truncate(e.UserAgent),
+	})
+	return err
+}
+
+// truncate shortens s to at most maxFieldLength bytes, dropping a rune cut
+// in half at the end.
+func truncate(s string) string {
+	if len(s) <= maxFieldLength {
+		return s
+	}
+	return strings.ToValidUTF8(s[:maxFieldLength], "")
+}
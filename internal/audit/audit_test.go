@@ -0,0 +1,65 @@
+package audit
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+type fakeWriter struct {
+	got []database.CreateAuditEventParams
+}
+
+func (f *fakeWriter) CreateAuditEvent(ctx context.Context, arg database.CreateAuditEventParams) (database.AuditEvent, error) {
+	f.got = append(f.got, arg)
+	return database.AuditEvent{}, nil
+}
+
+func TestRecord(t *testing.T) {
+	actor := uuid.New()
+
+	tests := []struct {
+		name      string
+		event     Event
+		wantActor uuid.NullUUID
+		wantAgent string
+	}{
+		{
+			name:      "Signed in",
+			event:     Event{Actor: actor, Action: ActionLogin, UserAgent: "curl/8.0"},
+			wantActor: uuid.NullUUID{UUID: actor, Valid: true},
+			wantAgent: "curl/8.0",
+		},
+		{
+			name:      "Anonymous",
+			event:     Event{Action: ActionLoginFailed, UserAgent: "curl/8.0"},
+			wantActor: uuid.NullUUID{},
+			wantAgent: "curl/8.0",
+		},
+		{
+			name:      "Long user agent",
+			event:     Event{Action: ActionLogin, UserAgent: "a" + strings.Repeat("é", maxFieldLength)},
+			wantAgent: "a" + strings.Repeat("é", maxFieldLength/2-1),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := &fakeWriter{}
+			if err := Record(context.Background(), w, tt.event); err != nil {
+				t.Fatalf("Record() error = %v", err)
+			}
+			got := w.got[0]
+			if got.ActorID != tt.wantActor {
+				t.Errorf("ActorID = %v, want %v", got.ActorID, tt.wantActor)
+			}
+			if got.UserAgent != tt.wantAgent || !utf8.ValidString(got.UserAgent) {
+				t.Errorf("UserAgent = %q (%d bytes), want %d bytes", got.UserAgent, len(got.UserAgent), len(tt.wantAgent))
+			}
+		})
+	}
+}
@@ -109,3 +109,34 @@ func TestValidateJWT(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token, _ := MakeRefreshToken()
+	if HashToken(token) != HashToken(token) {
+		t.Errorf("HashToken is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Errorf("HashToken returned the token unchanged")
+	}
+	other, _ := MakeRefreshToken()
+	if HashToken(token) == HashToken(other) {
+		t.Errorf("different tokens hash to the same value")
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	userID := uuid.New()
+	token, _ := MakeJWT(userID, "secret", time.Hour)
+
+	expiry, err := TokenExpiry(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Until(expiry); d < 59*time.Minute || d > time.Hour {
+		t.Errorf("expiry in %v, want about an hour", d)
+	}
+
+	if _, err := TokenExpiry("not-a-jwt"); err == nil {
+		t.Errorf("TokenExpiry() of garbage succeeded")
+	}
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
@@ -81,6 +82,20 @@ func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, error) {
 	return id, nil
 }
 
+// TokenExpiry returns when a token accepted by ValidateJWT stops being
+// valid, so long-lived connections can end when it does.
+func TokenExpiry(tokenString string) (time.Time, error) {
+	claimsStruct := jwt.RegisteredClaims{}
+	_, _, err := jwt.NewParser().ParseUnverified(tokenString, &claimsStruct)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if claimsStruct.ExpiresAt == nil {
+		return time.Time{}, errors.New("token has no expiry")
+	}
+	return claimsStruct.ExpiresAt.Time, nil
+}
+
 func GetBearerToken(headers http.Header) (string, error) {
 	token := headers.Get("Authorization")
 
@@ -103,6 +118,13 @@ func MakeRefreshToken() (string, error) {
 	return hex.EncodeToString(randData), nil
 }
 
+// HashToken returns the hex SHA-256 digest of a random token, so that
+// single-use tokens can be looked up without storing them in plain text.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func GetAPIKey(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 
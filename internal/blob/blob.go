@@ -0,0 +1,19 @@
+// Package blob stores opaque binary objects, such as uploaded images, by key.
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrNotFound is returned when no object is stored under a key.
+var ErrNotFound = errors.New("blob not found")
+
+// Store saves and retrieves objects. Keys are made of letters, digits,
+// dashes, underscores and dots; implementations reject anything else.
+type Store interface {
+	Put(ctx context.Context, key string, r io.Reader) error
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
@@ -0,0 +1,58 @@
+package blob
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFS(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Put(ctx, "photo.jpg", strings.NewReader("first")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put(ctx, "photo.jpg", strings.NewReader("second")); err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := s.Open(ctx, "photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "second" {
+		t.Errorf("Open = %q, want the last Put", data)
+	}
+
+	if err := s.Delete(ctx, "photo.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.Open(ctx, "photo.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Open after Delete: err = %v, want ErrNotFound", err)
+	}
+	if err := s.Delete(ctx, "photo.jpg"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete twice: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFSRejectsInvalidKeys(t *testing.T) {
+	ctx := context.Background()
+	s, err := NewFS(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{"", "../escape", "a/b", ".hidden", "/abs"} {
+		if err := s.Put(ctx, key, strings.NewReader("x")); err == nil {
+			t.Errorf("Put(%q) succeeded, want an error", key)
+		}
+	}
+}
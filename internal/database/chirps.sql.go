@@ -7,10 +7,29 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const cancelScheduledChirp = `-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+`
+
+type CancelScheduledChirpParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) CancelScheduledChirp(ctx context.Context, arg CancelScheduledChirpParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, cancelScheduledChirp, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const createChirp = `-- name: CreateChirp :one
 INSERT INTO chirps (id, body, user_id, created_at, updated_at)
 VALUES (
@@ -20,7 +39,7 @@ VALUES (
     NOW(),
     NOW()
 )
-RETURNING id, body, user_id, created_at, updated_at
+RETURNING id, body, user_id, created_at, updated_at, deleted_at, status, publish_at
 `
 
 type CreateChirpParams struct {
@@ -37,21 +56,51 @@ func (q *Queries) CreateChirp(ctx context.Context, arg CreateChirpParams) (Chirp
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
-const deleteChirp = `-- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1
+const createScheduledChirp = `-- name: CreateScheduledChirp :one
+INSERT INTO chirps (id, body, user_id, created_at, updated_at, status, publish_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW(),
+    NOW(),
+    'scheduled',
+    $3
+)
+RETURNING id, body, user_id, created_at, updated_at, deleted_at, status, publish_at
 `
 
-func (q *Queries) DeleteChirp(ctx context.Context, id uuid.UUID) error {
-	_, err := q.db.ExecContext(ctx, deleteChirp, id)
-	return err
+type CreateScheduledChirpParams struct {
+	Body      string
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
+}
+
+func (q *Queries) CreateScheduledChirp(ctx context.Context, arg CreateScheduledChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, createScheduledChirp, arg.Body, arg.UserID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+	)
+	return i, err
 }
 
 const getChirp = `-- name: GetChirp :one
-SELECT id, body, user_id, created_at, updated_at FROM chirps WHERE id = $1
+SELECT id, body, user_id, created_at, updated_at, deleted_at, status, publish_at FROM chirps WHERE id = $1
 `
 
 func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
@@ -63,16 +112,71 @@ func (q *Queries) GetChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
 		&i.UserID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
 	)
 	return i, err
 }
 
+const listAllChirpsByAuthor = `-- name: ListAllChirpsByAuthor :many
+SELECT id, body, user_id, created_at, updated_at, deleted_at, status, publish_at FROM chirps WHERE user_id = $1 ORDER BY created_at
+`
+
+func (q *Queries) ListAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listAllChirpsByAuthor, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const listChirps = `-- name: ListChirps :many
-SELECT id, body, user_id, created_at, updated_at FROM chirps ORDER BY created_at
+SELECT id, body, user_id, created_at, updated_at, deleted_at, status, publish_at FROM chirps
+WHERE deleted_at IS NULL AND status = 'published'
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = $1 AND blocked_id = chirps.user_id)
+       OR (blocker_id = chirps.user_id AND blocked_id = $1)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE muter_id = $1 AND muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+      AND (users.banned_at IS NOT NULL OR users.suspended_until > NOW())
+)
+ORDER BY created_at
 `
 
-func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, listChirps)
+func (q *Queries) ListChirps(ctx context.Context, viewerID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirps, viewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +190,9 @@ func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -101,11 +208,32 @@ func (q *Queries) ListChirps(ctx context.Context) ([]Chirp, error) {
 }
 
 const listChirpsByAuthor = `-- name: ListChirpsByAuthor :many
-SELECT id, body, user_id, created_at, updated_at FROM chirps WHERE user_id = $1 ORDER BY created_at
+SELECT id, body, user_id, created_at, updated_at, deleted_at, status, publish_at FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND status = 'published'
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = $2 AND blocked_id = chirps.user_id)
+       OR (blocker_id = chirps.user_id AND blocked_id = $2)
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE muter_id = $2 AND muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+      AND (users.banned_at IS NOT NULL OR users.suspended_until > NOW())
+)
+ORDER BY created_at
 `
 
-func (q *Queries) ListChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
-	rows, err := q.db.QueryContext(ctx, listChirpsByAuthor, userID)
+type ListChirpsByAuthorParams struct {
+	UserID   uuid.UUID
+	ViewerID uuid.UUID
+}
+
+func (q *Queries) ListChirpsByAuthor(ctx context.Context, arg ListChirpsByAuthorParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listChirpsByAuthor, arg.UserID, arg.ViewerID)
 	if err != nil {
 		return nil, err
 	}
@@ -119,6 +247,9 @@ func (q *Queries) ListChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]C
 			&i.UserID,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
 		); err != nil {
 			return nil, err
 		}
@@ -132,3 +263,199 @@ func (q *Queries) ListChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]C
 	}
 	return items, nil
 }
+
+const listDueChirps = `-- name: ListDueChirps :many
+SELECT id, body, user_id, created_at, updated_at, deleted_at, status, publish_at FROM chirps
+WHERE status = 'scheduled' AND publish_at <= $1
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+      AND (users.banned_at IS NOT NULL OR users.suspended_until > NOW())
+)
+ORDER BY publish_at, id
+LIMIT $2
+FOR UPDATE SKIP LOCKED
+`
+
+type ListDueChirpsParams struct {
+	PublishAt sql.NullTime
+	Limit     int32
+}
+
+func (q *Queries) ListDueChirps(ctx context.Context, arg ListDueChirpsParams) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listDueChirps, arg.PublishAt, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listScheduledChirpsByAuthor = `-- name: ListScheduledChirpsByAuthor :many
+SELECT id, body, user_id, created_at, updated_at, deleted_at, status, publish_at FROM chirps
+WHERE user_id = $1 AND status = 'scheduled'
+ORDER BY publish_at, id
+`
+
+func (q *Queries) ListScheduledChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]Chirp, error) {
+	rows, err := q.db.QueryContext(ctx, listScheduledChirpsByAuthor, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []Chirp
+	for rows.Next() {
+		var i Chirp
+		if err := rows.Scan(
+			&i.ID,
+			&i.Body,
+			&i.UserID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.DeletedAt,
+			&i.Status,
+			&i.PublishAt,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const publishChirp = `-- name: PublishChirp :one
+UPDATE chirps
+SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'scheduled'
+RETURNING id, body, user_id, created_at, updated_at, deleted_at, status, publish_at
+`
+
+func (q *Queries) PublishChirp(ctx context.Context, id uuid.UUID) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, publishChirp, id)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const purgeDeletedChirps = `-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+AND NOT EXISTS (
+    SELECT 1 FROM reports
+    WHERE reports.chirp_id = chirps.id AND reports.resolution = 'hide'
+)
+`
+
+func (q *Queries) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, purgeDeletedChirps, deletedAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+const rescheduleChirp = `-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+RETURNING id, body, user_id, created_at, updated_at, deleted_at, status, publish_at
+`
+
+type RescheduleChirpParams struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	PublishAt sql.NullTime
+}
+
+func (q *Queries) RescheduleChirp(ctx context.Context, arg RescheduleChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, rescheduleChirp, arg.ID, arg.UserID, arg.PublishAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const restoreChirp = `-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at > $2
+RETURNING id, body, user_id, created_at, updated_at, deleted_at, status, publish_at
+`
+
+type RestoreChirpParams struct {
+	ID        uuid.UUID
+	DeletedAt sql.NullTime
+}
+
+func (q *Queries) RestoreChirp(ctx context.Context, arg RestoreChirpParams) (Chirp, error) {
+	row := q.db.QueryRowContext(ctx, restoreChirp, arg.ID, arg.DeletedAt)
+	var i Chirp
+	err := row.Scan(
+		&i.ID,
+		&i.Body,
+		&i.UserID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.DeletedAt,
+		&i.Status,
+		&i.PublishAt,
+	)
+	return i, err
+}
+
+const softDeleteChirp = `-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL
+`
+
+func (q *Queries) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, softDeleteChirp, id)
+	return err
+}
@@ -11,12 +11,117 @@ import (
 	"github.com/google/uuid"
 )
 
+type AuditEvent struct {
+	ID        uuid.UUID
+	ActorID   uuid.NullUUID
+	Action    string
+	Target    string
+	Ip        string
+	UserAgent string
+	CreatedAt time.Time
+}
+
+type Block struct {
+	BlockerID uuid.UUID
+	BlockedID uuid.UUID
+	CreatedAt time.Time
+}
+
 type Chirp struct {
 	ID        uuid.UUID
 	Body      string
 	UserID    uuid.UUID
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	DeletedAt sql.NullTime
+	Status    string
+	PublishAt sql.NullTime
+}
+
+type Conversation struct {
+	ID        uuid.UUID
+	UserA     uuid.UUID
+	UserB     uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Draft struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Body      string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+type Link struct {
+	ID                 uuid.UUID
+	Code               string
+	Url                string
+	ChirpID            uuid.UUID
+	Position           int32
+	Clicks             int64
+	CreatedAt          time.Time
+	PreviewTitle       string
+	PreviewDescription string
+	PreviewImageUrl    string
+	PreviewFetchedAt   sql.NullTime
+}
+
+type Medium struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	ChirpID     uuid.NullUUID
+	Position    sql.NullInt32
+	ContentType string
+	Width       int32
+	Height      int32
+	SizeBytes   int64
+	CreatedAt   time.Time
+}
+
+type Message struct {
+	ID             uuid.UUID
+	ConversationID uuid.UUID
+	SenderID       uuid.UUID
+	Body           []byte
+	CreatedAt      time.Time
+	ReadAt         sql.NullTime
+}
+
+type ModerationLog struct {
+	ID           uuid.UUID
+	ModeratorID  uuid.UUID
+	Action       string
+	ReportID     uuid.NullUUID
+	ChirpID      uuid.NullUUID
+	TargetUserID uuid.NullUUID
+	Note         string
+	CreatedAt    time.Time
+}
+
+type Mute struct {
+	MuterID   uuid.UUID
+	MutedID   uuid.UUID
+	CreatedAt time.Time
+}
+
+type Notification struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	Type      string
+	GroupKey  string
+	ChirpID   uuid.NullUUID
+	ActorIds  []uuid.UUID
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ReadAt    sql.NullTime
+}
+
+type NotificationPreference struct {
+	UserID  uuid.UUID
+	Type    string
+	Enabled bool
 }
 
 type RefreshToken struct {
@@ -28,11 +133,38 @@ type RefreshToken struct {
 	UpdatedAt time.Time
 }
 
+type Report struct {
+	ID         uuid.UUID
+	ChirpID    uuid.UUID
+	ReporterID uuid.UUID
+	Reason     string
+	Details    string
+	Status     string
+	ClaimedBy  uuid.NullUUID
+	Resolution sql.NullString
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+	ResolvedAt sql.NullTime
+}
+
 type User struct {
-	ID             uuid.UUID
-	Email          string
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	HashedPassword string
-	IsChirpyRed    bool
+	ID                         uuid.UUID
+	Email                      string
+	CreatedAt                  time.Time
+	UpdatedAt                  time.Time
+	HashedPassword             string
+	IsChirpyRed                bool
+	Role                       string
+	DeletionScheduledAt        sql.NullTime
+	Handle                     sql.NullString
+	DisplayName                string
+	Bio                        string
+	AvatarUrl                  string
+	PendingEmail               sql.NullString
+	EmailVerificationToken     sql.NullString
+	EmailVerificationExpiresAt sql.NullTime
+	DmPrivacy                  string
+	SuspendedUntil             sql.NullTime
+	BannedAt                   sql.NullTime
+	BanReason                  string
 }
@@ -0,0 +1,71 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeDB struct {
+	DBTX
+	err error
+}
+
+func (f fakeDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, f.err
+}
+
+func TestTracedRecordsSpans(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() { provider.Shutdown(context.Background()) })
+
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus codes.Code
+	}{
+		{
+			name:       "Successful query",
+			err:        nil,
+			wantStatus: codes.Unset,
+		},
+		{
+			name:       "Failed query",
+			err:        errors.New("connection refused"),
+			wantStatus: codes.Error,
+		},
+		{
+			name:       "No rows is not an error",
+			err:        sql.ErrNoRows,
+			wantStatus: codes.Unset,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+
+			q := New(Traced(fakeDB{err: tt.err}))
+			q.SoftDeleteChirp(context.Background(), [16]byte{})
+
+			spans := recorder.Ended()
+			if len(spans) != 1 {
+				t.Fatalf("got %d spans, want 1", len(spans))
+			}
+			if spans[0].Name() != "SoftDeleteChirp" {
+				t.Errorf("span name = %q, want SoftDeleteChirp", spans[0].Name())
+			}
+			if spans[0].Status().Code != tt.wantStatus {
+				t.Errorf("span status = %v, want %v", spans[0].Status().Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -7,10 +7,100 @@ package database
 
 import (
 	"context"
+	"database/sql"
 
 	"github.com/google/uuid"
 )
 
+const banUser = `-- name: BanUser :one
+UPDATE users
+SET banned_at = NOW(), ban_reason = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+type BanUserParams struct {
+	ID        uuid.UUID
+	BanReason string
+}
+
+func (q *Queries) BanUser(ctx context.Context, arg BanUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, banUser, arg.ID, arg.BanReason)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const cancelUserDeletion = `-- name: CancelUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = NULL,
+    updated_at = NOW()
+WHERE id = $1
+`
+
+func (q *Queries) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, cancelUserDeletion, id)
+	return err
+}
+
+const confirmPendingEmail = `-- name: ConfirmPendingEmail :one
+UPDATE users
+SET email = pending_email,
+    pending_email = NULL,
+    email_verification_token = NULL,
+    email_verification_expires_at = NULL,
+    updated_at = NOW()
+WHERE id = $1 AND pending_email IS NOT NULL
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+func (q *Queries) ConfirmPendingEmail(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, confirmPendingEmail, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
 const createUser = `-- name: CreateUser :one
 INSERT INTO users (id, created_at, updated_at, email, hashed_password)
 VALUES (
@@ -20,7 +110,7 @@ VALUES (
     $1,
     $2
 )
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
 `
 
 type CreateUserParams struct {
@@ -38,6 +128,19 @@ func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
 	)
 	return i, err
 }
@@ -51,8 +154,29 @@ func (q *Queries) DeleteAllUsers(ctx context.Context) error {
 	return err
 }
 
+const deleteUser = `-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1
+`
+
+func (q *Queries) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	_, err := q.db.ExecContext(ctx, deleteUser, id)
+	return err
+}
+
+const deleteUsersScheduledBefore = `-- name: DeleteUsersScheduledBefore :execrows
+DELETE FROM users WHERE deletion_scheduled_at <= $1
+`
+
+func (q *Queries) DeleteUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteUsersScheduledBefore, deletionScheduledAt)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
 const getUserByEmail = `-- name: GetUserByEmail :one
-SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red FROM users WHERE email = $1
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason FROM users WHERE email = $1
 `
 
 func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error) {
@@ -65,6 +189,309 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const getUserByEmailVerificationToken = `-- name: GetUserByEmailVerificationToken :one
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason FROM users WHERE email_verification_token = $1
+`
+
+func (q *Queries) GetUserByEmailVerificationToken(ctx context.Context, emailVerificationToken sql.NullString) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByEmailVerificationToken, emailVerificationToken)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const getUserByHandle = `-- name: GetUserByHandle :one
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason FROM users WHERE LOWER(handle) = LOWER($1)
+`
+
+func (q *Queries) GetUserByHandle(ctx context.Context, handle string) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByHandle, handle)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const getUserByID = `-- name: GetUserByID :one
+SELECT id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason FROM users WHERE id = $1
+`
+
+func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, getUserByID, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const scheduleUserDeletion = `-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+type ScheduleUserDeletionParams struct {
+	ID                  uuid.UUID
+	DeletionScheduledAt sql.NullTime
+}
+
+func (q *Queries) ScheduleUserDeletion(ctx context.Context, arg ScheduleUserDeletionParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, scheduleUserDeletion, arg.ID, arg.DeletionScheduledAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const setDMPrivacy = `-- name: SetDMPrivacy :one
+UPDATE users
+SET dm_privacy = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+type SetDMPrivacyParams struct {
+	ID        uuid.UUID
+	DmPrivacy string
+}
+
+func (q *Queries) SetDMPrivacy(ctx context.Context, arg SetDMPrivacyParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setDMPrivacy, arg.ID, arg.DmPrivacy)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const setPendingEmail = `-- name: SetPendingEmail :one
+UPDATE users
+SET pending_email = $2,
+    email_verification_token = $3,
+    email_verification_expires_at = $4,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+type SetPendingEmailParams struct {
+	ID                         uuid.UUID
+	PendingEmail               sql.NullString
+	EmailVerificationToken     sql.NullString
+	EmailVerificationExpiresAt sql.NullTime
+}
+
+func (q *Queries) SetPendingEmail(ctx context.Context, arg SetPendingEmailParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setPendingEmail, arg.ID, arg.PendingEmail, arg.EmailVerificationToken, arg.EmailVerificationExpiresAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const suspendUser = `-- name: SuspendUser :one
+UPDATE users
+SET suspended_until = $2, ban_reason = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+type SuspendUserParams struct {
+	ID             uuid.UUID
+	SuspendedUntil sql.NullTime
+	BanReason      string
+}
+
+func (q *Queries) SuspendUser(ctx context.Context, arg SuspendUserParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, suspendUser, arg.ID, arg.SuspendedUntil, arg.BanReason)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
+	)
+	return i, err
+}
+
+const unsuspendUser = `-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_until = NULL, banned_at = NULL, ban_reason = '', updated_at = NOW()
+WHERE id = $1
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
+`
+
+func (q *Queries) UnsuspendUser(ctx context.Context, id uuid.UUID) (User, error) {
+	row := q.db.QueryRowContext(ctx, unsuspendUser, id)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.Email,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.HashedPassword,
+		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
 	)
 	return i, err
 }
@@ -72,19 +499,28 @@ func (q *Queries) GetUserByEmail(ctx context.Context, email string) (User, error
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
 SET email = $2,
-    hashed_password = $3
+    hashed_password = $3,
+    handle = $4,
+    display_name = $5,
+    bio = $6,
+    avatar_url = $7,
+    updated_at = NOW()
 WHERE id = $1
-RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red
+RETURNING id, email, created_at, updated_at, hashed_password, is_chirpy_red, role, deletion_scheduled_at, handle, display_name, bio, avatar_url, pending_email, email_verification_token, email_verification_expires_at, dm_privacy, suspended_until, banned_at, ban_reason
 `
 
 type UpdateUserParams struct {
 	ID             uuid.UUID
 	Email          string
 	HashedPassword string
+	Handle         sql.NullString
+	DisplayName    string
+	Bio            string
+	AvatarUrl      string
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, error) {
-	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword)
+	row := q.db.QueryRowContext(ctx, updateUser, arg.ID, arg.Email, arg.HashedPassword, arg.Handle, arg.DisplayName, arg.Bio, arg.AvatarUrl)
 	var i User
 	err := row.Scan(
 		&i.ID,
@@ -93,6 +529,19 @@ func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (User, e
 		&i.UpdatedAt,
 		&i.HashedPassword,
 		&i.IsChirpyRed,
+		&i.Role,
+		&i.DeletionScheduledAt,
+		&i.Handle,
+		&i.DisplayName,
+		&i.Bio,
+		&i.AvatarUrl,
+		&i.PendingEmail,
+		&i.EmailVerificationToken,
+		&i.EmailVerificationExpiresAt,
+		&i.DmPrivacy,
+		&i.SuspendedUntil,
+		&i.BannedAt,
+		&i.BanReason,
 	)
 	return i, err
 }
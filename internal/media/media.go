@@ -0,0 +1,126 @@
+// Package media validates uploaded images and prepares them for serving.
+//
+// Every upload is decoded and re-encoded, which drops EXIF and any other
+// metadata the original file carried. JPEG orientation is applied to the
+// pixels first so photos don't turn sideways once the tag is gone.
+package media
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxPixels bounds width*height so a small file can't decode into a
+	// huge bitmap.
+	MaxPixels = 40_000_000
+	// ThumbnailSize is the longest side of a thumbnail, in pixels.
+	ThumbnailSize = 320
+
+	jpegQuality = 85
+)
+
+var (
+	ErrUnsupportedType = errors.New("unsupported image type")
+	ErrTooManyPixels   = errors.New("image dimensions are too large")
+)
+
+// Image is a processed upload ready to be stored.
+type Image struct {
+	ContentType string
+	Width       int
+	Height      int
+	Data        []byte
+	Thumbnail   []byte
+}
+
+// Process sniffs the type of data, rejecting anything but JPEG, PNG, GIF
+// and WebP, and returns it re-encoded along with a thumbnail. JPEGs stay
+// JPEG; everything else becomes PNG, so only the first frame of an
+// animated GIF survives.
+func Process(data []byte) (Image, error) {
+	contentType := http.DetectContentType(data)
+	switch contentType {
+	case "image/jpeg", "image/png", "image/gif", "image/webp":
+	default:
+		return Image{}, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedType
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return Image{}, ErrTooManyPixels
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return Image{}, ErrUnsupportedType
+	}
+
+	if contentType == "image/jpeg" {
+		img = orient(img, jpegOrientation(data))
+	} else {
+		contentType = "image/png"
+	}
+
+	encoded, err := encode(img, contentType)
+	if err != nil {
+		return Image{}, err
+	}
+	thumbnail, err := encode(thumbnail(img), contentType)
+	if err != nil {
+		return Image{}, err
+	}
+
+	bounds := img.Bounds()
+	return Image{
+		ContentType: contentType,
+		Width:       bounds.Dx(),
+		Height:      bounds.Dy(),
+		Data:        encoded,
+		Thumbnail:   thumbnail,
+	}, nil
+}
+
+func encode(img image.Image, contentType string) ([]byte, error) {
+	var buf bytes.Buffer
+	var err error
+	if contentType == "image/jpeg" {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	} else {
+		err = png.Encode(&buf, img)
+	}
+	return buf.Bytes(), err
+}
+
+// thumbnail scales img to fit in a ThumbnailSize square, keeping its aspect
+// ratio. Images that already fit are returned unchanged.
+func thumbnail(img image.Image) image.Image {
+	bounds := img.Bounds()
+	w, h := bounds.Dx(), bounds.Dy()
+	if w <= ThumbnailSize && h <= ThumbnailSize {
+		return img
+	}
+
+	if w >= h {
+		h = max(1, h*ThumbnailSize/w)
+		w = ThumbnailSize
+	} else {
+		w = max(1, w*ThumbnailSize/h)
+		h = ThumbnailSize
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, bounds, draw.Src, nil)
+	return dst
+}
@@ -0,0 +1,58 @@
+package preview
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/netip"
+	"syscall"
+	"time"
+)
+
+// errForbiddenAddress is returned when a preview would be fetched from a
+// loopback, private or otherwise internal address.
+var errForbiddenAddress = errors.New("refusing to fetch from a non-public address")
+
+// NewClient returns an HTTPFetcher for untrusted, user-supplied URLs. It
+// only connects to public unicast addresses, so chirps can't be used to
+// probe the internal network, and it gives up on slow servers.
+func NewClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: 5 * time.Second,
+		Control: func(network, address string, _ syscall.RawConn) error {
+			return checkAddress(address)
+		},
+	}
+
+	return &http.Client{
+		Timeout: 10 * time.Second,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: 5 * time.Second,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			return nil
+		},
+	}
+}
+
+// checkAddress is called with the resolved IP of every connection, which
+// also covers redirects and DNS names that point inside the network.
+func checkAddress(address string) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil {
+		return err
+	}
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() || ip.IsLoopback() || ip.IsLinkLocalUnicast() {
+		return errForbiddenAddress
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+// Package preview builds link preview cards from a page's OpenGraph tags.
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// maxPageBytes is how much of a page is read looking for metadata; the tags
+// live in <head>, so there is no need for the rest.
+const maxPageBytes = 512 << 10
+
+// ErrNotHTML is returned for pages that aren't HTML documents.
+var ErrNotHTML = errors.New("not an HTML page")
+
+// HTTPFetcher sends requests for page metadata. *http.Client implements it;
+// tests substitute a stub.
+type HTTPFetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// Card is the metadata shown under a link.
+type Card struct {
+	Title       string
+	Description string
+	ImageURL    string
+}
+
+// Fetch downloads pageURL and extracts its preview card. og:title falls
+// back to <title> and og:description to the description meta tag. Relative
+// image URLs are resolved against the page.
+func Fetch(ctx context.Context, f HTTPFetcher, pageURL string) (Card, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageURL, nil)
+	if err != nil {
+		return Card{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", "ChirpyBot/1.0 (+link previews)")
+
+	resp, err := f.Do(req)
+	if err != nil {
+		return Card{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Card{}, fmt.Errorf("fetch %s: status %d", pageURL, resp.StatusCode)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return Card{}, ErrNotHTML
+	}
+
+	card := Parse(io.LimitReader(resp.Body, maxPageBytes))
+	if card.ImageURL != "" {
+		card.ImageURL = resolve(resp.Request.URL, card.ImageURL)
+	}
+	return card, nil
+}
+
+// Parse reads the preview card from an HTML document.
+func Parse(r io.Reader) Card {
+	var card, fallback Card
+	z := html.NewTokenizer(r)
+	inTitle := false
+
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			return merge(card, fallback)
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tok := z.Token()
+			switch tok.Data {
+			case "title":
+				inTitle = true
+			case "meta":
+				key, content := metaAttrs(tok)
+				switch key {
+				case "og:title":
+					card.Title = content
+				case "og:description":
+					card.Description = content
+				case "og:image", "og:image:url":
+					if card.ImageURL == "" {
+						card.ImageURL = content
+					}
+				case "description":
+					fallback.Description = content
+				}
+			case "body":
+				// metadata belongs in <head>
+				return merge(card, fallback)
+			}
+		case html.TextToken:
+			if inTitle && fallback.Title == "" {
+				fallback.Title = strings.TrimSpace(string(z.Text()))
+			}
+		case html.EndTagToken:
+			if tok := z.Token(); tok.Data == "title" {
+				inTitle = false
+			} else if tok.Data == "head" {
+				return merge(card, fallback)
+			}
+		}
+	}
+}
+
+func metaAttrs(tok html.Token) (key, content string) {
+	for _, attr := range tok.Attr {
+		switch attr.Key {
+		case "property", "name":
+			if key == "" {
+				key = strings.ToLower(attr.Val)
+			}
+		case "content":
+			content = strings.TrimSpace(attr.Val)
+		}
+	}
+	return key, content
+}
+
+func merge(card, fallback Card) Card {
+	if card.Title == "" {
+		card.Title = fallback.Title
+	}
+	if card.Description == "" {
+		card.Description = fallback.Description
+	}
+	return card
+}
+
+func resolve(base *url.URL, ref string) string {
+	u, err := url.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	u = base.ResolveReference(u)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return ""
+	}
+	return u.String()
+}
@@ -0,0 +1,106 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+type stubFetcher struct {
+	contentType string
+	body        string
+}
+
+func (f stubFetcher) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {f.contentType}},
+		Body:       io.NopCloser(strings.NewReader(f.body)),
+		Request:    req,
+	}, nil
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name string
+		html string
+		want Card
+	}{
+		{
+			name: "OpenGraph",
+			html: `<html><head><title>Page</title>
+				<meta property="og:title" content="OG title">
+				<meta property="og:description" content=" OG description ">
+				<meta property="og:image" content="https://example.com/a.png">
+				</head><body></body></html>`,
+			want: Card{Title: "OG title", Description: "OG description", ImageURL: "https://example.com/a.png"},
+		},
+		{
+			name: "Fallbacks",
+			html: `<html><head><title> Plain page </title><meta name="description" content="About it"></head></html>`,
+			want: Card{Title: "Plain page", Description: "About it"},
+		},
+		{
+			name: "Tags after head are ignored",
+			html: `<html><head></head><body><meta property="og:title" content="late"></body></html>`,
+			want: Card{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Parse(strings.NewReader(tt.html)); got != tt.want {
+				t.Errorf("Parse() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFetch(t *testing.T) {
+	ctx := context.Background()
+
+	card, err := Fetch(ctx, stubFetcher{
+		contentType: "text/html; charset=utf-8",
+		body:        `<meta property="og:title" content="Hi"><meta property="og:image" content="/img.png">`,
+	}, "https://example.com/post/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Title != "Hi" || card.ImageURL != "https://example.com/img.png" {
+		t.Errorf("Fetch() = %+v", card)
+	}
+
+	_, err = Fetch(ctx, stubFetcher{contentType: "application/pdf"}, "https://example.com/doc.pdf")
+	if !errors.Is(err, ErrNotHTML) {
+		t.Errorf("Fetch() of a PDF error = %v, want ErrNotHTML", err)
+	}
+}
+
+func TestCheckAddress(t *testing.T) {
+	tests := []struct {
+		address string
+		wantErr bool
+	}{
+		{address: "93.184.216.34:443"},
+		{address: "[2606:2800:220:1::]:443"},
+		{address: "127.0.0.1:80", wantErr: true},
+		{address: "10.0.0.5:80", wantErr: true},
+		{address: "192.168.1.1:80", wantErr: true},
+		{address: "169.254.169.254:80", wantErr: true},
+		{address: "[::1]:80", wantErr: true},
+		{address: "[::ffff:127.0.0.1]:80", wantErr: true},
+		{address: "0.0.0.0:80", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.address, func(t *testing.T) {
+			err := checkAddress(tt.address)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkAddress(%q) error = %v, wantErr %v", tt.address, err, tt.wantErr)
+			}
+		})
+	}
+}
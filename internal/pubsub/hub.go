@@ -0,0 +1,190 @@
+// Package pubsub fans events out to in-process subscribers, keeping a
+// bounded history so reconnecting clients can catch up.
+package pubsub
+
+import (
+	"encoding/json"
+	"errors"
+	"slices"
+	"sync"
+)
+
+var (
+	// ErrSlowConsumer ends a subscription whose buffer filled up. The
+	// subscriber can resubscribe from the last event it handled.
+	ErrSlowConsumer = errors.New("subscriber fell behind")
+	// ErrClosed ends every subscription when the hub shuts down.
+	ErrClosed = errors.New("hub closed")
+)
+
+// Event is a message published to one or more topics. IDs increase by one
+// for every event published on a hub.
+type Event struct {
+	ID     uint64
+	Type   string
+	Topics []string
+	Data   json.RawMessage
+}
+
+// Hub delivers published events to the subscriptions interested in any of
+// their topics.
+type Hub struct {
+	mu      sync.Mutex
+	nextID  uint64
+	history []Event
+	size    int
+	subs    map[*Subscription]struct{}
+	closed  bool
+	buffer  int
+}
+
+// NewHub returns a Hub that remembers the last historySize events and
+// gives each subscriber a buffer of bufferSize events.
+func NewHub(historySize, bufferSize int) *Hub {
+	return &Hub{
+		nextID: 1,
+		size:   historySize,
+		subs:   map[*Subscription]struct{}{},
+		buffer: bufferSize,
+	}
+}
+
+// Publish assigns ev the next ID and delivers it without blocking.
+// Subscribers whose buffer is full are dropped with ErrSlowConsumer rather
+// than holding up everyone else.
+func (h *Hub) Publish(ev Event) Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	ev.ID = h.nextID
+	h.nextID++
+	if h.closed {
+		return ev
+	}
+
+	h.history = append(h.history, ev)
+	if len(h.history) > h.size {
+		h.history = slices.Delete(h.history, 0, len(h.history)-h.size)
+	}
+
+	for sub := range h.subs {
+		if !sub.wants(ev) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			h.drop(sub, ErrSlowConsumer)
+		}
+	}
+	return ev
+}
+
+// Subscribe starts a subscription to topics. When lastID is non-zero, the
+// events after it that are still in the history are returned for replay;
+// complete is false if some of them have already been forgotten, or if
+// lastID comes from before a restart, and the caller should resynchronize
+// some other way.
+func (h *Hub) Subscribe(topics []string, lastID uint64) (sub *Subscription, replay []Event, complete bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{
+		hub:    h,
+		topics: slices.Clone(topics),
+		events: make(chan Event, h.buffer),
+		done:   make(chan struct{}),
+	}
+	if h.closed {
+		sub.err = ErrClosed
+		close(sub.done)
+		return sub, nil, true
+	}
+	h.subs[sub] = struct{}{}
+
+	complete = true
+	if lastID > 0 {
+		oldest := h.nextID
+		if len(h.history) > 0 {
+			oldest = h.history[0].ID
+		}
+		complete = lastID+1 >= oldest && lastID < h.nextID
+		for _, ev := range h.history {
+			if ev.ID > lastID && sub.wants(ev) {
+				replay = append(replay, ev)
+			}
+		}
+	}
+	return sub, replay, complete
+}
+
+// Close ends every subscription with ErrClosed.
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.closed = true
+	for sub := range h.subs {
+		h.drop(sub, ErrClosed)
+	}
+}
+
+// drop must be called with h.mu held.
+func (h *Hub) drop(sub *Subscription, err error) {
+	if _, ok := h.subs[sub]; !ok {
+		return
+	}
+	delete(h.subs, sub)
+	sub.err = err
+	close(sub.done)
+}
+
+// Subscription receives the events published to its topics.
+type Subscription struct {
+	hub    *Hub
+	topics []string
+	events chan Event
+	done   chan struct{}
+	err    error
+}
+
+// Events delivers events in publish order.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Done is closed when the subscription ends; Err then says why.
+func (s *Subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err is nil until Done is closed.
+func (s *Subscription) Err() error {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	return s.err
+}
+
+// SetTopics replaces the topics the subscription receives.
+func (s *Subscription) SetTopics(topics []string) {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.topics = slices.Clone(topics)
+}
+
+// Close ends the subscription. It is safe to call more than once.
+func (s *Subscription) Close() {
+	s.hub.mu.Lock()
+	defer s.hub.mu.Unlock()
+	s.hub.drop(s, nil)
+}
+
+// wants must be called with the hub's mutex held.
+func (s *Subscription) wants(ev Event) bool {
+	for _, topic := range ev.Topics {
+		if slices.Contains(s.topics, topic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,120 @@
+package pubsub
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestHubDelivery(t *testing.T) {
+	h := NewHub(10, 10)
+	all, _, _ := h.Subscribe([]string{"chirps"}, 0)
+	alice, _, _ := h.Subscribe([]string{"user:alice"}, 0)
+
+	h.Publish(Event{Type: "created", Topics: []string{"chirps", "user:alice"}})
+	h.Publish(Event{Type: "created", Topics: []string{"chirps", "user:bob"}})
+
+	if got := len(all.Events()); got != 2 {
+		t.Errorf("chirps subscriber got %d events, want 2", got)
+	}
+	if got := len(alice.Events()); got != 1 {
+		t.Errorf("alice subscriber got %d events, want 1", got)
+	}
+	if ev := <-all.Events(); ev.ID != 1 {
+		t.Errorf("first event ID = %d, want 1", ev.ID)
+	}
+
+	alice.SetTopics([]string{"user:bob"})
+	h.Publish(Event{Type: "created", Topics: []string{"user:bob"}})
+	if got := len(alice.Events()); got != 2 {
+		t.Errorf("after SetTopics got %d events, want 2", got)
+	}
+}
+
+func TestHubReplay(t *testing.T) {
+	h := NewHub(3, 10)
+	for range 5 {
+		h.Publish(Event{Type: "created", Topics: []string{"chirps"}})
+	}
+
+	tests := []struct {
+		name         string
+		lastID       uint64
+		wantReplay   []uint64
+		wantComplete bool
+	}{
+		{name: "New subscriber", lastID: 0, wantComplete: true},
+		{name: "Within history", lastID: 3, wantReplay: []uint64{4, 5}, wantComplete: true},
+		{name: "Just before history", lastID: 2, wantReplay: []uint64{3, 4, 5}, wantComplete: true},
+		{name: "Up to date", lastID: 5, wantComplete: true},
+		{name: "Too old", lastID: 1, wantReplay: []uint64{3, 4, 5}, wantComplete: false},
+		{name: "From before a restart", lastID: 99, wantComplete: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sub, replay, complete := h.Subscribe([]string{"chirps"}, tt.lastID)
+			defer sub.Close()
+
+			var ids []uint64
+			for _, ev := range replay {
+				ids = append(ids, ev.ID)
+			}
+			if len(ids) != len(tt.wantReplay) {
+				t.Fatalf("replay = %v, want %v", ids, tt.wantReplay)
+			}
+			for i := range ids {
+				if ids[i] != tt.wantReplay[i] {
+					t.Fatalf("replay = %v, want %v", ids, tt.wantReplay)
+				}
+			}
+			if complete != tt.wantComplete {
+				t.Errorf("complete = %v, want %v", complete, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestHubSlowConsumer(t *testing.T) {
+	h := NewHub(10, 2)
+	slow, _, _ := h.Subscribe([]string{"chirps"}, 0)
+	fast, _, _ := h.Subscribe([]string{"chirps"}, 0)
+
+	for range 3 {
+		h.Publish(Event{Topics: []string{"chirps"}})
+		// the fast subscriber keeps up
+		<-fast.Events()
+	}
+
+	select {
+	case <-slow.Done():
+	default:
+		t.Fatal("slow subscriber was not dropped")
+	}
+	if !errors.Is(slow.Err(), ErrSlowConsumer) {
+		t.Errorf("slow.Err() = %v, want ErrSlowConsumer", slow.Err())
+	}
+	if fast.Err() != nil {
+		t.Errorf("fast.Err() = %v, want nil", fast.Err())
+	}
+
+	// catching up from the last event the slow subscriber handled
+	_, replay, complete := h.Subscribe([]string{"chirps"}, 2)
+	if !complete || len(replay) != 1 || replay[0].ID != 3 {
+		t.Errorf("resubscribe replay = %+v, complete = %v", replay, complete)
+	}
+}
+
+func TestHubClose(t *testing.T) {
+	h := NewHub(10, 10)
+	sub, _, _ := h.Subscribe([]string{"chirps"}, 0)
+	h.Close()
+
+	<-sub.Done()
+	if !errors.Is(sub.Err(), ErrClosed) {
+		t.Errorf("Err() = %v, want ErrClosed", sub.Err())
+	}
+
+	late, _, _ := h.Subscribe([]string{"chirps"}, 0)
+	<-late.Done()
+	sub.Close()
+}
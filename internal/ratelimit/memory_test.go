@@ -0,0 +1,72 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestMemoryStoreTake(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 3, Window: 3 * time.Second}
+
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	tests := []struct {
+		name          string
+		key           string
+		advance       time.Duration
+		wantAllowed   bool
+		wantRemaining int
+		wantRetry     time.Duration
+	}{
+		{name: "First request", key: "a", wantAllowed: true, wantRemaining: 2},
+		{name: "Second request", key: "a", wantAllowed: true, wantRemaining: 1},
+		{name: "Third request", key: "a", wantAllowed: true, wantRemaining: 0},
+		{name: "Bucket empty", key: "a", wantAllowed: false, wantRemaining: 0, wantRetry: time.Second},
+		{name: "Other key has its own bucket", key: "b", wantAllowed: true, wantRemaining: 2},
+		{name: "Partial refill", key: "a", advance: 500 * time.Millisecond, wantAllowed: false, wantRemaining: 0, wantRetry: 500 * time.Millisecond},
+		{name: "One token refilled", key: "a", advance: 500 * time.Millisecond, wantAllowed: true, wantRemaining: 0},
+		{name: "Refill is capped at limit", key: "a", advance: time.Hour, wantAllowed: true, wantRemaining: 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now = now.Add(tt.advance)
+
+			got, err := store.Take(context.Background(), tt.key, policy)
+			if err != nil {
+				t.Fatalf("Take() error = %v", err)
+			}
+			if got.Allowed != tt.wantAllowed {
+				t.Errorf("Take() Allowed = %v, want %v", got.Allowed, tt.wantAllowed)
+			}
+			if got.Remaining != tt.wantRemaining {
+				t.Errorf("Take() Remaining = %v, want %v", got.Remaining, tt.wantRemaining)
+			}
+			if got.RetryAfter != tt.wantRetry {
+				t.Errorf("Take() RetryAfter = %v, want %v", got.RetryAfter, tt.wantRetry)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreSweep(t *testing.T) {
+	policy := Policy{Name: "test", Limit: 1, Window: time.Second}
+
+	now := time.Unix(0, 0)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+
+	store.Take(context.Background(), "a", policy)
+	now = now.Add(2 * sweepInterval)
+	store.Take(context.Background(), "b", policy)
+
+	if _, ok := store.buckets["a"]; ok {
+		t.Errorf("full bucket was not swept")
+	}
+	if _, ok := store.buckets["b"]; !ok {
+		t.Errorf("active bucket was swept")
+	}
+}
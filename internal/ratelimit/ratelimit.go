@@ -0,0 +1,39 @@
+// Package ratelimit implements token bucket rate limiting behind a pluggable
+// Store, so buckets can live in process memory or in a backend shared by
+// several replicas.
+package ratelimit
+
+import (
+	"context"
+	"time"
+)
+
+// Policy describes a token bucket that holds at most Limit tokens and refills
+// completely over Window. Each request takes one token.
+type Policy struct {
+	Name   string
+	Limit  int
+	Window time.Duration
+}
+
+// refillInterval is the time it takes to earn back a single token.
+func (p Policy) refillInterval() time.Duration {
+	return p.Window / time.Duration(p.Limit)
+}
+
+// Result is the outcome of taking a token from a bucket.
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until a token is available. It is zero when
+	// the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Store keeps bucket state. Take must be atomic per key.
+type Store interface {
+	Take(ctx context.Context, key string, policy Policy) (Result, error)
+}
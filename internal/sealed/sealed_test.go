@@ -0,0 +1,61 @@
+package sealed
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func TestSealOpen(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, KeySize)
+	box, err := NewBox(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed := box.Seal([]byte("hello"), []byte("row-1"))
+	if bytes.Contains(sealed, []byte("hello")) {
+		t.Error("sealed value contains the plaintext")
+	}
+	if again := box.Seal([]byte("hello"), []byte("row-1")); bytes.Equal(again, sealed) {
+		t.Error("sealing twice gave the same output")
+	}
+
+	got, err := box.Open(sealed, []byte("row-1"))
+	if err != nil || string(got) != "hello" {
+		t.Fatalf("Open() = %q, %v", got, err)
+	}
+
+	if _, err := box.Open(sealed, []byte("row-2")); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Open() with other associated data error = %v, want ErrInvalid", err)
+	}
+	tampered := bytes.Clone(sealed)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := box.Open(tampered, []byte("row-1")); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Open() tampered error = %v, want ErrInvalid", err)
+	}
+	if _, err := box.Open([]byte("short"), nil); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Open() short error = %v, want ErrInvalid", err)
+	}
+
+	other, _ := NewBox(bytes.Repeat([]byte{8}, KeySize))
+	if _, err := other.Open(sealed, []byte("row-1")); !errors.Is(err, ErrInvalid) {
+		t.Errorf("Open() with another key error = %v, want ErrInvalid", err)
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	valid := base64.StdEncoding.EncodeToString(bytes.Repeat([]byte{1}, KeySize))
+	if key, err := ParseKey(valid); err != nil || len(key) != KeySize {
+		t.Errorf("ParseKey(valid) = %v, %v", key, err)
+	}
+	for _, s := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("too short"))} {
+		if _, err := ParseKey(s); err == nil {
+			t.Errorf("ParseKey(%q) succeeded", s)
+		}
+	}
+	if _, err := NewBox([]byte("short")); err == nil {
+		t.Error("NewBox() accepted a short key")
+	}
+}
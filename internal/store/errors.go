@@ -0,0 +1,36 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// Errors returned by Memory in place of the corresponding Postgres errors.
+var (
+	ErrUniqueViolation     = errors.New("store: unique constraint violation")
+	ErrForeignKeyViolation = errors.New("store: foreign key violation")
+	ErrCheckViolation      = errors.New("store: check constraint violation")
+)
+
+// IsUniqueViolation reports whether err was caused by a unique constraint,
+// such as an email address that is already registered.
+func IsUniqueViolation(err error) bool {
+	return errors.Is(err, ErrUniqueViolation) || hasCode(err, "23505")
+}
+
+// IsForeignKeyViolation reports whether err was caused by a reference to a
+// row that does not exist.
+func IsForeignKeyViolation(err error) bool {
+	return errors.Is(err, ErrForeignKeyViolation) || hasCode(err, "23503")
+}
+
+// IsCheckViolation reports whether err was caused by a CHECK constraint.
+func IsCheckViolation(err error) bool {
+	return errors.Is(err, ErrCheckViolation) || hasCode(err, "23514")
+}
+
+func hasCode(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
@@ -0,0 +1,1774 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const refreshTokenLifetime = 60 * 24 * time.Hour
+
+// Memory is a thread-safe, in-process Store. It mirrors the constraints in
+// sql/schema: emails and (case-insensitively) handles are unique; chirps,
+// drafts, media, notifications, conversations, blocks, mutes, reports and
+// refresh tokens must reference an existing user and are removed with it; a
+// pair of users has at most one conversation; a user reports a chirp at most
+// once; the moderation log is never changed or cleared, and the audit log
+// only loses events to PurgeAuditEvents; and soft-deleted and scheduled
+// chirps are left out of listings, as are chirps hidden from the viewer by a
+// block or mute or whose author is suspended or banned. Missing rows are
+// reported as sql.ErrNoRows, like the sqlc queries.
+type Memory struct {
+	mu   sync.Mutex
+	txMu sync.Mutex
+	data memoryData
+
+	now func() time.Time
+}
+
+// memoryData holds the tables of a Memory store.
+type memoryData struct {
+	users         map[uuid.UUID]database.User
+	chirps        []database.Chirp
+	drafts        map[uuid.UUID]database.Draft
+	refreshTokens map[string]database.RefreshToken
+	media         map[uuid.UUID]database.Medium
+	links         map[uuid.UUID]database.Link
+	notifications map[uuid.UUID]database.Notification
+	preferences   map[preferenceKey]database.NotificationPreference
+	conversations map[uuid.UUID]database.Conversation
+	messages      map[uuid.UUID]database.Message
+	blocks        map[userPair]database.Block
+	mutes         map[userPair]database.Mute
+	reports       map[uuid.UUID]database.Report
+	moderationLog []database.ModerationLog
+	auditEvents   []database.AuditEvent
+}
+
+type preferenceKey struct {
+	userID uuid.UUID
+	typ    string
+}
+
+// userPair keys the blocks and mutes tables: from blocked or muted to.
+type userPair struct {
+	from, to uuid.UUID
+}
+
+func (d memoryData) clone() memoryData {
+	return memoryData{
+		users:         maps.Clone(d.users),
+		chirps:        slices.Clone(d.chirps),
+		drafts:        maps.Clone(d.drafts),
+		refreshTokens: maps.Clone(d.refreshTokens),
+		media:         maps.Clone(d.media),
+		links:         maps.Clone(d.links),
+		notifications: maps.Clone(d.notifications),
+		preferences:   maps.Clone(d.preferences),
+		conversations: maps.Clone(d.conversations),
+		messages:      maps.Clone(d.messages),
+		blocks:        maps.Clone(d.blocks),
+		mutes:         maps.Clone(d.mutes),
+		reports:       maps.Clone(d.reports),
+		moderationLog: slices.Clone(d.moderationLog),
+		auditEvents:   slices.Clone(d.auditEvents),
+	}
+}
+
+var _ Store = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		data: memoryData{
+			users:         map[uuid.UUID]database.User{},
+			drafts:        map[uuid.UUID]database.Draft{},
+			refreshTokens: map[string]database.RefreshToken{},
+			media:         map[uuid.UUID]database.Medium{},
+			links:         map[uuid.UUID]database.Link{},
+			notifications: map[uuid.UUID]database.Notification{},
+			preferences:   map[preferenceKey]database.NotificationPreference{},
+			conversations: map[uuid.UUID]database.Conversation{},
+			messages:      map[uuid.UUID]database.Message{},
+			blocks:        map[userPair]database.Block{},
+			mutes:         map[userPair]database.Mute{},
+			reports:       map[uuid.UUID]database.Report{},
+		},
+		now: func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// InTx runs transactions one at a time and restores a snapshot of every
+// table if fn fails. Writes made outside InTx while a transaction is running
+// are lost if it rolls back, which is fine for tests.
+func (m *Memory) InTx(ctx context.Context, fn func(Store) error) error {
+	m.txMu.Lock()
+	defer m.txMu.Unlock()
+
+	m.mu.Lock()
+	snapshot := m.data.clone()
+	m.mu.Unlock()
+
+	if err := fn(m); err != nil {
+		m.mu.Lock()
+		m.data = snapshot
+		m.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (m *Memory) CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.emailTaken(arg.Email, uuid.Nil) {
+		return database.User{}, ErrUniqueViolation
+	}
+
+	now := m.now()
+	user := database.User{
+		ID:             uuid.New(),
+		Email:          arg.Email,
+		CreatedAt:      now,
+		UpdatedAt:      now,
+		HashedPassword: arg.HashedPassword,
+		Role:           "user",
+		DmPrivacy:      "everyone",
+	}
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) DeleteAllUsers(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	clear(m.data.users)
+	m.data.chirps = nil
+	clear(m.data.drafts)
+	clear(m.data.refreshTokens)
+	clear(m.data.media)
+	clear(m.data.links)
+	clear(m.data.notifications)
+	clear(m.data.preferences)
+	clear(m.data.conversations)
+	clear(m.data.messages)
+	clear(m.data.blocks)
+	clear(m.data.mutes)
+	clear(m.data.reports)
+	return nil
+}
+
+func (m *Memory) GetUserByEmail(ctx context.Context, email string) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.data.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+// SetUserRole changes a user's role. Roles are granted directly in the
+// database, so there is no query for this; tests use it to seed staff.
+func (m *Memory) SetUserRole(id uuid.UUID, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.data.users[id]; ok {
+		user.Role = role
+		m.data.users[id] = user
+	}
+}
+
+func (m *Memory) GetUserByHandle(ctx context.Context, handle string) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.data.users {
+		if user.Handle.Valid && strings.EqualFold(user.Handle.String, handle) {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	if m.emailTaken(arg.Email, arg.ID) {
+		return database.User{}, ErrUniqueViolation
+	}
+	if arg.Handle.Valid && m.handleTaken(arg.Handle.String, arg.ID) {
+		return database.User{}, ErrUniqueViolation
+	}
+
+	user.Email = arg.Email
+	user.HashedPassword = arg.HashedPassword
+	user.Handle = arg.Handle
+	user.DisplayName = arg.DisplayName
+	user.Bio = arg.Bio
+	user.AvatarUrl = arg.AvatarUrl
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[id]
+	if !ok {
+		return nil
+	}
+	user.IsChirpyRed = true
+	user.UpdatedAt = m.now()
+	m.data.users[id] = user
+	return nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.deleteUser(id)
+	return nil
+}
+
+func (m *Memory) ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DeletionScheduledAt = arg.DeletionScheduledAt
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) CancelUserDeletion(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if user, ok := m.data.users[id]; ok {
+		user.DeletionScheduledAt = sql.NullTime{}
+		user.UpdatedAt = m.now()
+		m.data.users[id] = user
+	}
+	return nil
+}
+
+func (m *Memory) DeleteUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var deleted int64
+	for id, user := range m.data.users {
+		if user.DeletionScheduledAt.Valid && deletionScheduledAt.Valid && !user.DeletionScheduledAt.Time.After(deletionScheduledAt.Time) {
+			m.deleteUser(id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+func (m *Memory) SetPendingEmail(ctx context.Context, arg database.SetPendingEmailParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.PendingEmail = arg.PendingEmail
+	user.EmailVerificationToken = arg.EmailVerificationToken
+	user.EmailVerificationExpiresAt = arg.EmailVerificationExpiresAt
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) GetUserByEmailVerificationToken(ctx context.Context, emailVerificationToken sql.NullString) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, user := range m.data.users {
+		if user.EmailVerificationToken.Valid && emailVerificationToken.Valid && user.EmailVerificationToken.String == emailVerificationToken.String {
+			return user, nil
+		}
+	}
+	return database.User{}, sql.ErrNoRows
+}
+
+func (m *Memory) ConfirmPendingEmail(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[id]
+	if !ok || !user.PendingEmail.Valid {
+		return database.User{}, sql.ErrNoRows
+	}
+	if m.emailTaken(user.PendingEmail.String, id) {
+		return database.User{}, ErrUniqueViolation
+	}
+
+	user.Email = user.PendingEmail.String
+	user.PendingEmail = sql.NullString{}
+	user.EmailVerificationToken = sql.NullString{}
+	user.EmailVerificationExpiresAt = sql.NullTime{}
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) SetDMPrivacy(ctx context.Context, arg database.SetDMPrivacyParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.DmPrivacy = arg.DmPrivacy
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.SuspendedUntil = arg.SuspendedUntil
+	user.BanReason = arg.BanReason
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) BanUser(ctx context.Context, arg database.BanUserParams) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[arg.ID]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	now := m.now()
+	user.BannedAt = sql.NullTime{Time: now, Valid: true}
+	user.BanReason = arg.BanReason
+	user.UpdatedAt = now
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) UnsuspendUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	user, ok := m.data.users[id]
+	if !ok {
+		return database.User{}, sql.ErrNoRows
+	}
+	user.SuspendedUntil = sql.NullTime{}
+	user.BannedAt = sql.NullTime{}
+	user.BanReason = ""
+	user.UpdatedAt = m.now()
+	m.data.users[user.ID] = user
+	return user, nil
+}
+
+func (m *Memory) CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Chirp{}, ErrForeignKeyViolation
+	}
+
+	now := m.now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    "published",
+	}
+	m.data.chirps = append(m.data.chirps, chirp)
+	return chirp, nil
+}
+
+func (m *Memory) CreateScheduledChirp(ctx context.Context, arg database.CreateScheduledChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Chirp{}, ErrForeignKeyViolation
+	}
+
+	now := m.now()
+	chirp := database.Chirp{
+		ID:        uuid.New(),
+		Body:      arg.Body,
+		UserID:    arg.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Status:    "scheduled",
+		PublishAt: arg.PublishAt,
+	}
+	m.data.chirps = append(m.data.chirps, chirp)
+	return chirp, nil
+}
+
+func (m *Memory) ListScheduledChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.scheduledChirps(func(c database.Chirp) bool { return c.UserID == userID }, -1), nil
+}
+
+func (m *Memory) RescheduleChirp(ctx context.Context, arg database.RescheduleChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, chirp := range m.data.chirps {
+		if chirp.ID == arg.ID && chirp.UserID == arg.UserID && chirp.Status == "scheduled" {
+			chirp.PublishAt = arg.PublishAt
+			chirp.UpdatedAt = m.now()
+			m.data.chirps[i] = chirp
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) CancelScheduledChirp(ctx context.Context, arg database.CancelScheduledChirpParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.data.chirps)
+	m.data.chirps = slices.DeleteFunc(m.data.chirps, func(c database.Chirp) bool {
+		return c.ID == arg.ID && c.UserID == arg.UserID && c.Status == "scheduled"
+	})
+	m.deleteChirpDependents()
+	return int64(before - len(m.data.chirps)), nil
+}
+
+// ListDueChirps doesn't need to lock rows: Memory runs one transaction at a
+// time.
+func (m *Memory) ListDueChirps(ctx context.Context, arg database.ListDueChirpsParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	return m.scheduledChirps(func(c database.Chirp) bool {
+		return arg.PublishAt.Valid && !c.PublishAt.Time.After(arg.PublishAt.Time) && !m.suspended(c.UserID, now)
+	}, int(arg.Limit)), nil
+}
+
+func (m *Memory) PublishChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, chirp := range m.data.chirps {
+		if chirp.ID == id && chirp.Status == "scheduled" {
+			now := m.now()
+			chirp.Status = "published"
+			chirp.CreatedAt = now
+			chirp.UpdatedAt = now
+			m.data.chirps[i] = chirp
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) SoftDeleteChirp(ctx context.Context, id uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, chirp := range m.data.chirps {
+		if chirp.ID == id && !chirp.DeletedAt.Valid {
+			now := m.now()
+			m.data.chirps[i].DeletedAt = sql.NullTime{Time: now, Valid: true}
+			m.data.chirps[i].UpdatedAt = now
+		}
+	}
+	return nil
+}
+
+func (m *Memory) RestoreChirp(ctx context.Context, arg database.RestoreChirpParams) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for i, chirp := range m.data.chirps {
+		if chirp.ID == arg.ID && chirp.DeletedAt.Valid && arg.DeletedAt.Valid && chirp.DeletedAt.Time.After(arg.DeletedAt.Time) {
+			m.data.chirps[i].DeletedAt = sql.NullTime{}
+			m.data.chirps[i].UpdatedAt = m.now()
+			return m.data.chirps[i], nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.data.chirps)
+	m.data.chirps = slices.DeleteFunc(m.data.chirps, func(c database.Chirp) bool {
+		return c.DeletedAt.Valid && deletedAt.Valid && c.DeletedAt.Time.Before(deletedAt.Time) && !m.hiddenByModerator(c.ID)
+	})
+	m.deleteChirpDependents()
+	return int64(before - len(m.data.chirps)), nil
+}
+
+func (m *Memory) GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, chirp := range m.data.chirps {
+		if chirp.ID == id {
+			return chirp, nil
+		}
+	}
+	return database.Chirp{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.listChirps(func(c database.Chirp) bool { return !m.hidden(viewerID, c.UserID) }), nil
+}
+
+func (m *Memory) ListChirpsByAuthor(ctx context.Context, arg database.ListChirpsByAuthorParams) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.listChirps(func(c database.Chirp) bool {
+		return c.UserID == arg.UserID && !m.hidden(arg.ViewerID, c.UserID)
+	}), nil
+}
+
+func (m *Memory) ListAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Chirp
+	for _, chirp := range m.data.chirps {
+		if chirp.UserID == userID {
+			items = append(items, chirp)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b database.Chirp) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return items, nil
+}
+
+func (m *Memory) CreateDraft(ctx context.Context, arg database.CreateDraftParams) (database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Draft{}, ErrForeignKeyViolation
+	}
+
+	now := m.now()
+	draft := database.Draft{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Body:      arg.Body,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.data.drafts[draft.ID] = draft
+	return draft, nil
+}
+
+func (m *Memory) GetDraft(ctx context.Context, arg database.GetDraftParams) (database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	draft, ok := m.data.drafts[arg.ID]
+	if !ok || draft.UserID != arg.UserID {
+		return database.Draft{}, sql.ErrNoRows
+	}
+	return draft, nil
+}
+
+func (m *Memory) ListDraftsByUser(ctx context.Context, userID uuid.UUID) ([]database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Draft
+	for _, d := range m.data.drafts {
+		if d.UserID == userID {
+			items = append(items, d)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.Draft) int {
+		if c := b.UpdatedAt.Compare(a.UpdatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID.String(), a.ID.String())
+	})
+	return items, nil
+}
+
+func (m *Memory) CountDraftsByUser(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, d := range m.data.drafts {
+		if d.UserID == userID {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) UpdateDraft(ctx context.Context, arg database.UpdateDraftParams) (database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	draft, ok := m.data.drafts[arg.ID]
+	if !ok || draft.UserID != arg.UserID {
+		return database.Draft{}, sql.ErrNoRows
+	}
+	draft.Body = arg.Body
+	draft.UpdatedAt = m.now()
+	m.data.drafts[draft.ID] = draft
+	return draft, nil
+}
+
+func (m *Memory) DeleteDraft(ctx context.Context, arg database.DeleteDraftParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	draft, ok := m.data.drafts[arg.ID]
+	if !ok || draft.UserID != arg.UserID {
+		return 0, nil
+	}
+	delete(m.data.drafts, draft.ID)
+	return 1, nil
+}
+
+func (m *Memory) TakeDraft(ctx context.Context, arg database.TakeDraftParams) (database.Draft, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	draft, ok := m.data.drafts[arg.ID]
+	if !ok || draft.UserID != arg.UserID {
+		return database.Draft{}, sql.ErrNoRows
+	}
+	delete(m.data.drafts, draft.ID)
+	return draft, nil
+}
+
+func (m *Memory) CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Medium, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Medium{}, ErrForeignKeyViolation
+	}
+	if _, ok := m.data.media[arg.ID]; ok {
+		return database.Medium{}, ErrUniqueViolation
+	}
+
+	md := database.Medium{
+		ID:          arg.ID,
+		UserID:      arg.UserID,
+		ContentType: arg.ContentType,
+		Width:       arg.Width,
+		Height:      arg.Height,
+		SizeBytes:   arg.SizeBytes,
+		CreatedAt:   m.now(),
+	}
+	m.data.media[md.ID] = md
+	return md, nil
+}
+
+func (m *Memory) GetMedia(ctx context.Context, id uuid.UUID) (database.Medium, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	md, ok := m.data.media[id]
+	if !ok {
+		return database.Medium{}, sql.ErrNoRows
+	}
+	return md, nil
+}
+
+func (m *Memory) AttachMedia(ctx context.Context, arg database.AttachMediaParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	md, ok := m.data.media[arg.ID]
+	if !ok || md.UserID != arg.UserID || md.ChirpID.Valid {
+		return 0, nil
+	}
+	if arg.ChirpID.Valid && !m.chirpExists(arg.ChirpID.UUID) {
+		return 0, ErrForeignKeyViolation
+	}
+	for _, other := range m.data.media {
+		if other.ChirpID == arg.ChirpID && other.Position == arg.Position {
+			return 0, ErrUniqueViolation
+		}
+	}
+
+	md.ChirpID = arg.ChirpID
+	md.Position = arg.Position
+	m.data.media[md.ID] = md
+	return 1, nil
+}
+
+func (m *Memory) ListMediaByChirps(ctx context.Context, dollar_1 []uuid.UUID) ([]database.Medium, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var media []database.Medium
+	for _, md := range m.data.media {
+		if md.ChirpID.Valid && slices.Contains(dollar_1, md.ChirpID.UUID) {
+			media = append(media, md)
+		}
+	}
+	slices.SortFunc(media, func(a, b database.Medium) int {
+		if c := strings.Compare(a.ChirpID.UUID.String(), b.ChirpID.UUID.String()); c != 0 {
+			return c
+		}
+		return int(a.Position.Int32 - b.Position.Int32)
+	})
+	return media, nil
+}
+
+func (m *Memory) ListMediaByUser(ctx context.Context, userID uuid.UUID) ([]database.Medium, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var media []database.Medium
+	for _, md := range m.data.media {
+		if md.UserID == userID {
+			media = append(media, md)
+		}
+	}
+	slices.SortFunc(media, func(a, b database.Medium) int { return comparePosition(a.CreatedAt, a.ID, b.CreatedAt, b.ID) })
+	return media, nil
+}
+
+func (m *Memory) DeleteMediaOfScheduledChirp(ctx context.Context, arg database.DeleteMediaOfScheduledChirpParams) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteMedia(func(md database.Medium) bool {
+		chirp, ok := m.chirp(md.ChirpID)
+		return ok && chirp.ID == arg.ID && chirp.UserID == arg.UserID && chirp.Status == "scheduled"
+	}), nil
+}
+
+func (m *Memory) DeleteMediaOfDeletedChirps(ctx context.Context, deletedAt sql.NullTime) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteMedia(func(md database.Medium) bool {
+		chirp, ok := m.chirp(md.ChirpID)
+		return ok && deletedAt.Valid && chirp.DeletedAt.Valid && chirp.DeletedAt.Time.Before(deletedAt.Time) && !m.hiddenByModerator(chirp.ID)
+	}), nil
+}
+
+// hiddenByModerator reports whether a report on the chirp was resolved by
+// hiding it. The purges keep such chirps so their reports survive.
+func (m *Memory) hiddenByModerator(chirpID uuid.UUID) bool {
+	for _, report := range m.data.reports {
+		if report.ChirpID == chirpID && report.Resolution.String == "hide" {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *Memory) DeleteMediaByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteMedia(func(md database.Medium) bool { return md.UserID == userID }), nil
+}
+
+func (m *Memory) DeleteMediaOfUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.deleteMedia(func(md database.Medium) bool {
+		user := m.data.users[md.UserID]
+		return deletionScheduledAt.Valid && user.DeletionScheduledAt.Valid && !user.DeletionScheduledAt.Time.After(deletionScheduledAt.Time)
+	}), nil
+}
+
+// deleteMedia removes the media rows that match and returns their IDs.
+func (m *Memory) deleteMedia(match func(database.Medium) bool) []uuid.UUID {
+	var ids []uuid.UUID
+	for id, md := range m.data.media {
+		if match(md) {
+			ids = append(ids, id)
+			delete(m.data.media, id)
+		}
+	}
+	return ids
+}
+
+// chirp returns the chirp with id, if there is one.
+func (m *Memory) chirp(id uuid.NullUUID) (database.Chirp, bool) {
+	if !id.Valid {
+		return database.Chirp{}, false
+	}
+	i := slices.IndexFunc(m.data.chirps, func(c database.Chirp) bool { return c.ID == id.UUID })
+	if i < 0 {
+		return database.Chirp{}, false
+	}
+	return m.data.chirps[i], true
+}
+
+func (m *Memory) CreateLink(ctx context.Context, arg database.CreateLinkParams) (database.Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !m.chirpExists(arg.ChirpID) {
+		return database.Link{}, ErrForeignKeyViolation
+	}
+	for _, l := range m.data.links {
+		if l.Code == arg.Code {
+			return database.Link{}, ErrUniqueViolation
+		}
+	}
+
+	link := database.Link{
+		ID:        uuid.New(),
+		Code:      arg.Code,
+		Url:       arg.Url,
+		ChirpID:   arg.ChirpID,
+		Position:  arg.Position,
+		CreatedAt: m.now(),
+	}
+	m.data.links[link.ID] = link
+	return link, nil
+}
+
+func (m *Memory) FollowLink(ctx context.Context, code string) (database.Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, l := range m.data.links {
+		if l.Code != code {
+			continue
+		}
+		chirp, ok := m.chirp(uuid.NullUUID{UUID: l.ChirpID, Valid: true})
+		if !ok || chirp.DeletedAt.Valid || chirp.Status != "published" {
+			break
+		}
+		l.Clicks++
+		m.data.links[l.ID] = l
+		return l, nil
+	}
+	return database.Link{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListLinksByChirps(ctx context.Context, dollar_1 []uuid.UUID) ([]database.Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var links []database.Link
+	for _, l := range m.data.links {
+		if slices.Contains(dollar_1, l.ChirpID) {
+			links = append(links, l)
+		}
+	}
+	slices.SortFunc(links, func(a, b database.Link) int {
+		if c := strings.Compare(a.ChirpID.String(), b.ChirpID.String()); c != 0 {
+			return c
+		}
+		return int(a.Position - b.Position)
+	})
+	return links, nil
+}
+
+func (m *Memory) ListLinksPendingPreview(ctx context.Context, limit int32) ([]database.Link, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var links []database.Link
+	for _, l := range m.data.links {
+		chirp, ok := m.chirp(uuid.NullUUID{UUID: l.ChirpID, Valid: true})
+		if !l.PreviewFetchedAt.Valid && ok && !chirp.DeletedAt.Valid && chirp.Status == "published" {
+			links = append(links, l)
+		}
+	}
+	slices.SortFunc(links, func(a, b database.Link) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	if len(links) > int(limit) {
+		links = links[:limit]
+	}
+	return links, nil
+}
+
+func (m *Memory) SetLinkPreview(ctx context.Context, arg database.SetLinkPreviewParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	l, ok := m.data.links[arg.ID]
+	if !ok {
+		return nil
+	}
+	l.PreviewTitle = arg.PreviewTitle
+	l.PreviewDescription = arg.PreviewDescription
+	l.PreviewImageUrl = arg.PreviewImageUrl
+	l.PreviewFetchedAt = sql.NullTime{Time: m.now(), Valid: true}
+	m.data.links[l.ID] = l
+	return nil
+}
+
+// CreateNotification folds the actor into the unread notification of the
+// same group if there is one, like the ON CONFLICT clause of the query.
+func (m *Memory) CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.Notification{}, ErrForeignKeyViolation
+	}
+	if arg.ChirpID.Valid && !m.chirpExists(arg.ChirpID.UUID) {
+		return database.Notification{}, ErrForeignKeyViolation
+	}
+
+	now := m.now()
+	for _, n := range m.data.notifications {
+		if n.UserID != arg.UserID || n.Type != arg.Type || n.GroupKey != arg.GroupKey || n.ReadAt.Valid {
+			continue
+		}
+		if !slices.Contains(n.ActorIds, arg.ActorID) {
+			n.ActorIds = append(slices.Clone(n.ActorIds), arg.ActorID)
+		}
+		n.UpdatedAt = now
+		m.data.notifications[n.ID] = n
+		return n, nil
+	}
+
+	n := database.Notification{
+		ID:        uuid.New(),
+		UserID:    arg.UserID,
+		Type:      arg.Type,
+		GroupKey:  arg.GroupKey,
+		ChirpID:   arg.ChirpID,
+		ActorIds:  []uuid.UUID{arg.ActorID},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.data.notifications[n.ID] = n
+	return n, nil
+}
+
+func (m *Memory) ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.Notification, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Notification
+	for _, n := range m.data.notifications {
+		if n.UserID != arg.UserID {
+			continue
+		}
+		if arg.BeforeCreatedAt.Valid && comparePosition(n.CreatedAt, n.ID, arg.BeforeCreatedAt.Time, arg.BeforeID) >= 0 {
+			continue
+		}
+		items = append(items, n)
+	}
+	slices.SortFunc(items, func(a, b database.Notification) int { return comparePosition(b.CreatedAt, b.ID, a.CreatedAt, a.ID) })
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+// comparePosition orders rows by (timestamp, id), like the row comparisons
+// the paginated queries use.
+func comparePosition(at time.Time, id uuid.UUID, otherAt time.Time, otherID uuid.UUID) int {
+	if c := at.Compare(otherAt); c != 0 {
+		return c
+	}
+	return strings.Compare(id.String(), otherID.String())
+}
+
+func (m *Memory) CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, n := range m.data.notifications {
+		if n.UserID == userID && !n.ReadAt.Valid {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) MarkNotificationsRead(ctx context.Context, arg database.MarkNotificationsReadParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.markRead(func(n database.Notification) bool {
+		return n.UserID == arg.UserID && slices.Contains(arg.Ids, n.ID)
+	}), nil
+}
+
+func (m *Memory) MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.markRead(func(n database.Notification) bool { return n.UserID == userID }), nil
+}
+
+func (m *Memory) markRead(match func(database.Notification) bool) int64 {
+	var count int64
+	now := m.now()
+	for _, n := range m.data.notifications {
+		if n.ReadAt.Valid || !match(n) {
+			continue
+		}
+		n.ReadAt = sql.NullTime{Time: now, Valid: true}
+		m.data.notifications[n.ID] = n
+		count++
+	}
+	return count
+}
+
+func (m *Memory) ListNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.NotificationPreference
+	for key, pref := range m.data.preferences {
+		if key.userID == userID {
+			items = append(items, pref)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.NotificationPreference) int { return strings.Compare(a.Type, b.Type) })
+	return items, nil
+}
+
+func (m *Memory) SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return ErrForeignKeyViolation
+	}
+	m.data.preferences[preferenceKey{arg.UserID, arg.Type}] = database.NotificationPreference{
+		UserID:  arg.UserID,
+		Type:    arg.Type,
+		Enabled: arg.Enabled,
+	}
+	return nil
+}
+
+func (m *Memory) BlockUser(ctx context.Context, arg database.BlockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPair(arg.BlockerID, arg.BlockedID); err != nil {
+		return err
+	}
+	key := userPair{arg.BlockerID, arg.BlockedID}
+	if _, ok := m.data.blocks[key]; !ok {
+		m.data.blocks[key] = database.Block{BlockerID: arg.BlockerID, BlockedID: arg.BlockedID, CreatedAt: m.now()}
+	}
+	return nil
+}
+
+func (m *Memory) UnblockUser(ctx context.Context, arg database.UnblockUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.blocks, userPair{arg.BlockerID, arg.BlockedID})
+	return nil
+}
+
+func (m *Memory) IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.blocked(arg.BlockerID, arg.BlockedID), nil
+}
+
+func (m *Memory) MuteUser(ctx context.Context, arg database.MuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err := m.checkPair(arg.MuterID, arg.MutedID); err != nil {
+		return err
+	}
+	key := userPair{arg.MuterID, arg.MutedID}
+	if _, ok := m.data.mutes[key]; !ok {
+		m.data.mutes[key] = database.Mute{MuterID: arg.MuterID, MutedID: arg.MutedID, CreatedAt: m.now()}
+	}
+	return nil
+}
+
+func (m *Memory) UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data.mutes, userPair{arg.MuterID, arg.MutedID})
+	return nil
+}
+
+func (m *Memory) IsMuted(ctx context.Context, arg database.IsMutedParams) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, ok := m.data.mutes[userPair{arg.MuterID, arg.MutedID}]
+	return ok, nil
+}
+
+func (m *Memory) ListHiddenAuthors(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []uuid.UUID
+	for _, user := range m.data.users {
+		if m.hidden(userID, user.ID) {
+			items = append(items, user.ID)
+		}
+	}
+	return items, nil
+}
+
+// checkPair enforces the foreign keys and the CHECK constraint shared by the
+// blocks and mutes tables.
+func (m *Memory) checkPair(from, to uuid.UUID) error {
+	_, okFrom := m.data.users[from]
+	_, okTo := m.data.users[to]
+	if !okFrom || !okTo {
+		return ErrForeignKeyViolation
+	}
+	if from == to {
+		return ErrCheckViolation
+	}
+	return nil
+}
+
+// blocked reports whether either user has blocked the other.
+func (m *Memory) blocked(a, b uuid.UUID) bool {
+	_, ab := m.data.blocks[userPair{a, b}]
+	_, ba := m.data.blocks[userPair{b, a}]
+	return ab || ba
+}
+
+// hidden reports whether author's content is filtered out for viewer, like
+// the NOT EXISTS clauses of the chirp listings.
+func (m *Memory) hidden(viewer, author uuid.UUID) bool {
+	_, muted := m.data.mutes[userPair{viewer, author}]
+	return muted || m.blocked(viewer, author)
+}
+
+func (m *Memory) CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.ReporterID]; !ok || !m.chirpExists(arg.ChirpID) {
+		return database.Report{}, ErrForeignKeyViolation
+	}
+	for _, r := range m.data.reports {
+		if r.ChirpID == arg.ChirpID && r.ReporterID == arg.ReporterID {
+			return database.Report{}, ErrUniqueViolation
+		}
+	}
+
+	now := m.now()
+	report := database.Report{
+		ID:         uuid.New(),
+		ChirpID:    arg.ChirpID,
+		ReporterID: arg.ReporterID,
+		Reason:     arg.Reason,
+		Details:    arg.Details,
+		Status:     "open",
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	m.data.reports[report.ID] = report
+	return report, nil
+}
+
+func (m *Memory) GetReport(ctx context.Context, id uuid.UUID) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report, ok := m.data.reports[id]
+	if !ok {
+		return database.Report{}, sql.ErrNoRows
+	}
+	return report, nil
+}
+
+func (m *Memory) ChirpHiddenByReport(ctx context.Context, chirpID uuid.UUID) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.hiddenByModerator(chirpID), nil
+}
+
+func (m *Memory) ListReports(ctx context.Context, arg database.ListReportsParams) ([]database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Report
+	for _, r := range m.data.reports {
+		if r.Status != arg.Status {
+			continue
+		}
+		if arg.BeforeCreatedAt.Valid && comparePosition(r.CreatedAt, r.ID, arg.BeforeCreatedAt.Time, arg.BeforeID) >= 0 {
+			continue
+		}
+		items = append(items, r)
+	}
+	slices.SortFunc(items, func(a, b database.Report) int { return comparePosition(b.CreatedAt, b.ID, a.CreatedAt, a.ID) })
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+func (m *Memory) ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report, ok := m.data.reports[arg.ID]
+	claimable := report.Status == "open" ||
+		(report.Status == "claimed" && (report.ClaimedBy == arg.ClaimedBy || !report.ClaimedBy.Valid))
+	if !ok || !claimable {
+		return database.Report{}, sql.ErrNoRows
+	}
+	report.Status = "claimed"
+	report.ClaimedBy = arg.ClaimedBy
+	report.UpdatedAt = m.now()
+	m.data.reports[report.ID] = report
+	return report, nil
+}
+
+func (m *Memory) ResolveReport(ctx context.Context, arg database.ResolveReportParams) (database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	report, ok := m.data.reports[arg.ID]
+	if !ok || report.Status != "claimed" || !report.ClaimedBy.Valid || report.ClaimedBy != arg.ClaimedBy {
+		return database.Report{}, sql.ErrNoRows
+	}
+	now := m.now()
+	report.Status = "resolved"
+	report.Resolution = arg.Resolution
+	report.ResolvedAt = sql.NullTime{Time: now, Valid: true}
+	report.UpdatedAt = now
+	m.data.reports[report.ID] = report
+	return report, nil
+}
+
+func (m *Memory) ResolveOpenReportsByChirp(ctx context.Context, arg database.ResolveOpenReportsByChirpParams) ([]database.Report, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Report
+	now := m.now()
+	for _, report := range m.data.reports {
+		if report.ChirpID != arg.ChirpID || report.Status != "open" {
+			continue
+		}
+		report.Status = "resolved"
+		report.ClaimedBy = arg.ClaimedBy
+		report.Resolution = arg.Resolution
+		report.ResolvedAt = sql.NullTime{Time: now, Valid: true}
+		report.UpdatedAt = now
+		m.data.reports[report.ID] = report
+		items = append(items, report)
+	}
+	return items, nil
+}
+
+func (m *Memory) CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry := database.ModerationLog{
+		ID:           uuid.New(),
+		ModeratorID:  arg.ModeratorID,
+		Action:       arg.Action,
+		ReportID:     arg.ReportID,
+		ChirpID:      arg.ChirpID,
+		TargetUserID: arg.TargetUserID,
+		Note:         arg.Note,
+		CreatedAt:    m.now(),
+	}
+	m.data.moderationLog = append(m.data.moderationLog, entry)
+	return entry, nil
+}
+
+func (m *Memory) ListModerationActionsByReport(ctx context.Context, reportID uuid.NullUUID) ([]database.ModerationLog, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.ModerationLog
+	for _, entry := range m.data.moderationLog {
+		if reportID.Valid && entry.ReportID == reportID {
+			items = append(items, entry)
+		}
+	}
+	return items, nil
+}
+
+func (m *Memory) CreateAuditEvent(ctx context.Context, arg database.CreateAuditEventParams) (database.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	event := database.AuditEvent{
+		ID:        uuid.New(),
+		ActorID:   arg.ActorID,
+		Action:    arg.Action,
+		Target:    arg.Target,
+		Ip:        arg.Ip,
+		UserAgent: arg.UserAgent,
+		CreatedAt: m.now(),
+	}
+	m.data.auditEvents = append(m.data.auditEvents, event)
+	return event, nil
+}
+
+func (m *Memory) ListAuditEvents(ctx context.Context, arg database.ListAuditEventsParams) ([]database.AuditEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.AuditEvent
+	for _, e := range m.data.auditEvents {
+		if (arg.ActorID.Valid && e.ActorID != arg.ActorID) ||
+			(arg.Action.Valid && e.Action != arg.Action.String) ||
+			(arg.Target.Valid && e.Target != arg.Target.String) ||
+			(arg.Ip.Valid && e.Ip != arg.Ip.String) ||
+			(arg.Since.Valid && e.CreatedAt.Before(arg.Since.Time)) ||
+			(arg.Until.Valid && !e.CreatedAt.Before(arg.Until.Time)) {
+			continue
+		}
+		if arg.BeforeCreatedAt.Valid && comparePosition(e.CreatedAt, e.ID, arg.BeforeCreatedAt.Time, arg.BeforeID) >= 0 {
+			continue
+		}
+		items = append(items, e)
+	}
+	slices.SortFunc(items, func(a, b database.AuditEvent) int { return comparePosition(b.CreatedAt, b.ID, a.CreatedAt, a.ID) })
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+func (m *Memory) PurgeAuditEvents(ctx context.Context, createdAt time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	before := len(m.data.auditEvents)
+	m.data.auditEvents = slices.DeleteFunc(m.data.auditEvents, func(e database.AuditEvent) bool {
+		return e.CreatedAt.Before(createdAt)
+	})
+	return int64(before - len(m.data.auditEvents)), nil
+}
+
+func (m *Memory) CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, okA := m.data.users[arg.UserA]
+	_, okB := m.data.users[arg.UserB]
+	if !okA || !okB {
+		return database.Conversation{}, ErrForeignKeyViolation
+	}
+	if strings.Compare(arg.UserA.String(), arg.UserB.String()) >= 0 {
+		return database.Conversation{}, ErrCheckViolation
+	}
+	for _, c := range m.data.conversations {
+		if c.UserA == arg.UserA && c.UserB == arg.UserB {
+			return database.Conversation{}, ErrUniqueViolation
+		}
+	}
+
+	now := m.now()
+	c := database.Conversation{
+		ID:        uuid.New(),
+		UserA:     arg.UserA,
+		UserB:     arg.UserB,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.data.conversations[c.ID] = c
+	return c, nil
+}
+
+func (m *Memory) GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data.conversations[id]
+	if !ok {
+		return database.Conversation{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+func (m *Memory) GetConversationByUsers(ctx context.Context, arg database.GetConversationByUsersParams) (database.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range m.data.conversations {
+		if c.UserA == arg.UserA && c.UserB == arg.UserB {
+			return c, nil
+		}
+	}
+	return database.Conversation{}, sql.ErrNoRows
+}
+
+func (m *Memory) ListConversationsByUser(ctx context.Context, userA uuid.UUID) ([]database.Conversation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Conversation
+	for _, c := range m.data.conversations {
+		if c.UserA == userA || c.UserB == userA {
+			items = append(items, c)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.Conversation) int {
+		if c := b.UpdatedAt.Compare(a.UpdatedAt); c != 0 {
+			return c
+		}
+		return strings.Compare(b.ID.String(), a.ID.String())
+	})
+	return items, nil
+}
+
+// CreateMessage also marks the conversation as updated, like the query.
+func (m *Memory) CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	c, ok := m.data.conversations[arg.ConversationID]
+	if !ok {
+		return database.Message{}, ErrForeignKeyViolation
+	}
+	if _, ok := m.data.users[arg.SenderID]; !ok {
+		return database.Message{}, ErrForeignKeyViolation
+	}
+	if _, ok := m.data.messages[arg.ID]; ok {
+		return database.Message{}, ErrUniqueViolation
+	}
+
+	now := m.now()
+	c.UpdatedAt = now
+	m.data.conversations[c.ID] = c
+	msg := database.Message{
+		ID:             arg.ID,
+		ConversationID: arg.ConversationID,
+		SenderID:       arg.SenderID,
+		Body:           slices.Clone(arg.Body),
+		CreatedAt:      now,
+	}
+	m.data.messages[msg.ID] = msg
+	return msg, nil
+}
+
+func (m *Memory) ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := m.conversationMessages(arg.ConversationID)
+	if arg.BeforeCreatedAt.Valid {
+		items = slices.DeleteFunc(items, func(msg database.Message) bool {
+			return comparePosition(msg.CreatedAt, msg.ID, arg.BeforeCreatedAt.Time, arg.BeforeID) >= 0
+		})
+	}
+	if len(items) > int(arg.PageSize) {
+		items = items[:arg.PageSize]
+	}
+	return items, nil
+}
+
+func (m *Memory) ListMessagesByUser(ctx context.Context, userA uuid.UUID) ([]database.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.Message
+	for _, msg := range m.data.messages {
+		c := m.data.conversations[msg.ConversationID]
+		if c.UserA == userA || c.UserB == userA {
+			items = append(items, msg)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.Message) int { return comparePosition(a.CreatedAt, a.ID, b.CreatedAt, b.ID) })
+	return items, nil
+}
+
+func (m *Memory) GetLatestMessage(ctx context.Context, conversationID uuid.UUID) (database.Message, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	items := m.conversationMessages(conversationID)
+	if len(items) == 0 {
+		return database.Message{}, sql.ErrNoRows
+	}
+	return items[0], nil
+}
+
+func (m *Memory) CountUnreadMessages(ctx context.Context, arg database.CountUnreadMessagesParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	for _, msg := range m.data.messages {
+		if msg.ConversationID == arg.ConversationID && msg.SenderID != arg.SenderID && !msg.ReadAt.Valid {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *Memory) MarkMessagesRead(ctx context.Context, arg database.MarkMessagesReadParams) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var count int64
+	now := m.now()
+	for _, msg := range m.data.messages {
+		if msg.ConversationID == arg.ConversationID && msg.SenderID != arg.SenderID && !msg.ReadAt.Valid {
+			msg.ReadAt = sql.NullTime{Time: now, Valid: true}
+			m.data.messages[msg.ID] = msg
+			count++
+		}
+	}
+	return count, nil
+}
+
+// conversationMessages returns the messages in a conversation, newest
+// first.
+func (m *Memory) conversationMessages(conversationID uuid.UUID) []database.Message {
+	var items []database.Message
+	for _, msg := range m.data.messages {
+		if msg.ConversationID == conversationID {
+			items = append(items, msg)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.Message) int { return comparePosition(b.CreatedAt, b.ID, a.CreatedAt, a.ID) })
+	return items
+}
+
+func (m *Memory) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.data.users[arg.UserID]; !ok {
+		return database.RefreshToken{}, ErrForeignKeyViolation
+	}
+	if _, ok := m.data.refreshTokens[arg.Token]; ok {
+		return database.RefreshToken{}, ErrUniqueViolation
+	}
+
+	now := m.now()
+	token := database.RefreshToken{
+		Token:     arg.Token,
+		UserID:    arg.UserID,
+		ExpiresAt: now.Add(refreshTokenLifetime),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	m.data.refreshTokens[token.Token] = token
+	return token, nil
+}
+
+func (m *Memory) DeleteRefreshTokensByUser(ctx context.Context, userID uuid.UUID) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	maps.DeleteFunc(m.data.refreshTokens, func(_ string, t database.RefreshToken) bool { return t.UserID == userID })
+	return nil
+}
+
+func (m *Memory) ListRefreshTokensByUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var items []database.RefreshToken
+	for _, token := range m.data.refreshTokens {
+		if token.UserID == userID {
+			items = append(items, token)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.RefreshToken) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return items, nil
+}
+
+func (m *Memory) GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refreshToken, ok := m.data.refreshTokens[token]
+	if !ok {
+		return database.RefreshToken{}, sql.ErrNoRows
+	}
+	return refreshToken, nil
+}
+
+func (m *Memory) RevokeRefreshToken(ctx context.Context, token string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	refreshToken, ok := m.data.refreshTokens[token]
+	if !ok {
+		return nil
+	}
+	now := m.now()
+	refreshToken.RevokedAt = sql.NullTime{Time: now, Valid: true}
+	refreshToken.UpdatedAt = now
+	m.data.refreshTokens[token] = refreshToken
+	return nil
+}
+
+// deleteUser removes a user along with every row that references it, like
+// the ON DELETE CASCADE foreign keys do.
+func (m *Memory) deleteUser(id uuid.UUID) {
+	delete(m.data.users, id)
+	m.data.chirps = slices.DeleteFunc(m.data.chirps, func(c database.Chirp) bool { return c.UserID == id })
+	maps.DeleteFunc(m.data.drafts, func(_ uuid.UUID, d database.Draft) bool { return d.UserID == id })
+	maps.DeleteFunc(m.data.refreshTokens, func(_ string, t database.RefreshToken) bool { return t.UserID == id })
+	maps.DeleteFunc(m.data.media, func(_ uuid.UUID, md database.Medium) bool { return md.UserID == id })
+	maps.DeleteFunc(m.data.notifications, func(_ uuid.UUID, n database.Notification) bool { return n.UserID == id })
+	maps.DeleteFunc(m.data.preferences, func(k preferenceKey, _ database.NotificationPreference) bool { return k.userID == id })
+	maps.DeleteFunc(m.data.conversations, func(_ uuid.UUID, c database.Conversation) bool { return c.UserA == id || c.UserB == id })
+	maps.DeleteFunc(m.data.messages, func(_ uuid.UUID, msg database.Message) bool {
+		_, ok := m.data.conversations[msg.ConversationID]
+		return !ok || msg.SenderID == id
+	})
+	maps.DeleteFunc(m.data.blocks, func(k userPair, _ database.Block) bool { return k.from == id || k.to == id })
+	maps.DeleteFunc(m.data.mutes, func(k userPair, _ database.Mute) bool { return k.from == id || k.to == id })
+	maps.DeleteFunc(m.data.reports, func(_ uuid.UUID, r database.Report) bool { return r.ReporterID == id })
+	for reportID, r := range m.data.reports {
+		if r.ClaimedBy.Valid && r.ClaimedBy.UUID == id {
+			r.ClaimedBy = uuid.NullUUID{}
+			m.data.reports[reportID] = r
+		}
+	}
+	m.deleteChirpDependents()
+}
+
+// deleteChirpDependents removes media, links, notifications and reports that
+// belong to chirps which no longer exist, like the ON DELETE CASCADE on their
+// chirp_id.
+func (m *Memory) deleteChirpDependents() {
+	maps.DeleteFunc(m.data.media, func(_ uuid.UUID, md database.Medium) bool {
+		return md.ChirpID.Valid && !m.chirpExists(md.ChirpID.UUID)
+	})
+	maps.DeleteFunc(m.data.links, func(_ uuid.UUID, l database.Link) bool {
+		return !m.chirpExists(l.ChirpID)
+	})
+	maps.DeleteFunc(m.data.notifications, func(_ uuid.UUID, n database.Notification) bool {
+		return n.ChirpID.Valid && !m.chirpExists(n.ChirpID.UUID)
+	})
+	maps.DeleteFunc(m.data.reports, func(_ uuid.UUID, r database.Report) bool {
+		return !m.chirpExists(r.ChirpID)
+	})
+}
+
+func (m *Memory) chirpExists(id uuid.UUID) bool {
+	return slices.ContainsFunc(m.data.chirps, func(c database.Chirp) bool { return c.ID == id })
+}
+
+// emailTaken reports whether a user other than except uses email.
+func (m *Memory) emailTaken(email string, except uuid.UUID) bool {
+	for _, user := range m.data.users {
+		if user.Email == email && user.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// handleTaken reports whether a user other than except uses handle, ignoring
+// case.
+func (m *Memory) handleTaken(handle string, except uuid.UUID) bool {
+	for _, user := range m.data.users {
+		if user.Handle.Valid && strings.EqualFold(user.Handle.String, handle) && user.ID != except {
+			return true
+		}
+	}
+	return false
+}
+
+// listChirps returns the chirps that are not deleted, whose author is not
+// suspended or banned, and that match keep, oldest first. Like sqlc it
+// returns nil rather than an empty slice when nothing matches.
+// scheduledChirps returns up to limit scheduled chirps that keep accepts, in
+// the order they are due. A negative limit returns them all.
+func (m *Memory) scheduledChirps(keep func(database.Chirp) bool, limit int) []database.Chirp {
+	var items []database.Chirp
+	for _, chirp := range m.data.chirps {
+		if chirp.Status == "scheduled" && keep(chirp) {
+			items = append(items, chirp)
+		}
+	}
+	slices.SortFunc(items, func(a, b database.Chirp) int { return comparePosition(a.PublishAt.Time, a.ID, b.PublishAt.Time, b.ID) })
+	if limit >= 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	return items
+}
+
+// suspended reports whether the user with id is banned or suspended at now.
+func (m *Memory) suspended(id uuid.UUID, now time.Time) bool {
+	user := m.data.users[id]
+	return user.BannedAt.Valid || (user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(now))
+}
+
+func (m *Memory) listChirps(keep func(database.Chirp) bool) []database.Chirp {
+	now := m.now()
+	var items []database.Chirp
+	for _, chirp := range m.data.chirps {
+		if !chirp.DeletedAt.Valid && chirp.Status == "published" && !m.suspended(chirp.UserID, now) && keep(chirp) {
+			items = append(items, chirp)
+		}
+	}
+	slices.SortStableFunc(items, func(a, b database.Chirp) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	return items
+}
@@ -0,0 +1,534 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func TestMemoryUniqueEmail(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	first, err := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+	second, err := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	if err != nil {
+		t.Fatalf("CreateUser() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		call    func() error
+		wantErr bool
+	}{
+		{
+			name: "Create with taken email",
+			call: func() error {
+				_, err := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Update to taken email",
+			call: func() error {
+				_, err := m.UpdateUser(ctx, database.UpdateUserParams{ID: second.ID, Email: "a@example.com", HashedPassword: "x"})
+				return err
+			},
+			wantErr: true,
+		},
+		{
+			name: "Update keeping own email",
+			call: func() error {
+				_, err := m.UpdateUser(ctx, database.UpdateUserParams{ID: first.ID, Email: "a@example.com", HashedPassword: "y"})
+				return err
+			},
+			wantErr: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.call()
+			if (err != nil) != tt.wantErr {
+				t.Errorf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && !IsUniqueViolation(err) {
+				t.Errorf("IsUniqueViolation(%v) = false", err)
+			}
+		})
+	}
+}
+
+func TestMemoryForeignKeys(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	_, err := m.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: uuid.New()})
+	if !IsForeignKeyViolation(err) {
+		t.Errorf("CreateChirp() for missing user error = %v, want foreign key violation", err)
+	}
+
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	chirp, err := m.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateChirp() error = %v", err)
+	}
+	if _, err := m.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "t", UserID: user.ID}); err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+
+	if err := m.DeleteAllUsers(ctx); err != nil {
+		t.Fatalf("DeleteAllUsers() error = %v", err)
+	}
+
+	if _, err := m.GetChirp(ctx, chirp.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetChirp() after cascade error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := m.GetUserFromRefreshToken(ctx, "t"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetUserFromRefreshToken() after cascade error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestMemoryRefreshTokens(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+
+	token, err := m.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "t", UserID: user.ID})
+	if err != nil {
+		t.Fatalf("CreateRefreshToken() error = %v", err)
+	}
+	if !token.ExpiresAt.After(token.CreatedAt) {
+		t.Errorf("ExpiresAt = %v, want after %v", token.ExpiresAt, token.CreatedAt)
+	}
+
+	if err := m.RevokeRefreshToken(ctx, "t"); err != nil {
+		t.Fatalf("RevokeRefreshToken() error = %v", err)
+	}
+	got, _ := m.GetUserFromRefreshToken(ctx, "t")
+	if !got.RevokedAt.Valid {
+		t.Errorf("RevokedAt not set after revoke")
+	}
+}
+
+func TestMemoryInTx(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	m.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "old", UserID: user.ID})
+
+	errBoom := errors.New("boom")
+	err := m.InTx(ctx, func(tx Store) error {
+		if err := tx.DeleteRefreshTokensByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		if _, err := tx.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: user.ID}); err != nil {
+			return err
+		}
+		return errBoom
+	})
+	if !errors.Is(err, errBoom) {
+		t.Fatalf("InTx() error = %v, want %v", err, errBoom)
+	}
+
+	if _, err := m.GetUserFromRefreshToken(ctx, "old"); err != nil {
+		t.Errorf("refresh token deleted by rolled back transaction")
+	}
+	if chirps, _ := m.ListChirps(ctx, uuid.Nil); len(chirps) != 0 {
+		t.Errorf("chirp created by rolled back transaction")
+	}
+
+	err = m.InTx(ctx, func(tx Store) error {
+		if err := tx.DeleteRefreshTokensByUser(ctx, user.ID); err != nil {
+			return err
+		}
+		_, err := tx.CreateRefreshToken(ctx, database.CreateRefreshTokenParams{Token: "new", UserID: user.ID})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("InTx() error = %v", err)
+	}
+	if _, err := m.GetUserFromRefreshToken(ctx, "new"); err != nil {
+		t.Errorf("committed refresh token missing: %v", err)
+	}
+}
+
+func TestMemoryMediaCascade(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	chirp, _ := m.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: user.ID})
+	attached, _ := m.CreateMedia(ctx, database.CreateMediaParams{ID: uuid.New(), UserID: user.ID, ContentType: "image/png"})
+	loose, _ := m.CreateMedia(ctx, database.CreateMediaParams{ID: uuid.New(), UserID: user.ID, ContentType: "image/png"})
+
+	n, err := m.AttachMedia(ctx, database.AttachMediaParams{
+		ID:       attached.ID,
+		ChirpID:  uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		Position: sql.NullInt32{Valid: true},
+		UserID:   user.ID,
+	})
+	if err != nil || n != 1 {
+		t.Fatalf("AttachMedia() = %d, %v; want 1, nil", n, err)
+	}
+
+	if err := m.SoftDeleteChirp(ctx, chirp.ID); err != nil {
+		t.Fatal(err)
+	}
+	m.now = func() time.Time { return time.Now().UTC().Add(time.Hour) }
+	if _, err := m.PurgeDeletedChirps(ctx, sql.NullTime{Time: m.now(), Valid: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := m.GetMedia(ctx, attached.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetMedia() after purging its chirp error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := m.GetMedia(ctx, loose.ID); err != nil {
+		t.Errorf("GetMedia() for unattached media error = %v", err)
+	}
+
+	if err := m.DeleteUser(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetMedia(ctx, loose.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetMedia() after deleting its owner error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestMemoryNotifications(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	alice, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	bob, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	chirp, _ := m.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: alice.ID})
+
+	like := database.CreateNotificationParams{
+		UserID:   alice.ID,
+		Type:     "like",
+		GroupKey: chirp.ID.String(),
+		ChirpID:  uuid.NullUUID{UUID: chirp.ID, Valid: true},
+		ActorID:  bob.ID,
+	}
+	first, err := m.CreateNotification(ctx, like)
+	if err != nil {
+		t.Fatalf("CreateNotification() error = %v", err)
+	}
+	like.ActorID = uuid.New()
+	second, err := m.CreateNotification(ctx, like)
+	if err != nil || second.ID != first.ID || len(second.ActorIds) != 2 {
+		t.Fatalf("CreateNotification() into an unread group = %+v, %v", second, err)
+	}
+
+	if _, err := m.CreateNotification(ctx, database.CreateNotificationParams{UserID: uuid.New(), Type: "follow", ActorID: bob.ID}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("CreateNotification() for a missing user error = %v, want ErrForeignKeyViolation", err)
+	}
+
+	if err := m.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if notes, _ := m.ListNotifications(ctx, database.ListNotificationsParams{UserID: alice.ID, PageSize: 10}); len(notes) != 0 {
+		t.Errorf("ListNotifications() after deleting the recipient = %v", notes)
+	}
+}
+
+func TestMemoryConversations(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	alice, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	bob, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	low, high := alice.ID, bob.ID
+	if low.String() > high.String() {
+		low, high = high, low
+	}
+
+	if _, err := m.CreateConversation(ctx, database.CreateConversationParams{UserA: high, UserB: low}); !errors.Is(err, ErrCheckViolation) {
+		t.Errorf("CreateConversation() out of order error = %v, want ErrCheckViolation", err)
+	}
+	c, err := m.CreateConversation(ctx, database.CreateConversationParams{UserA: low, UserB: high})
+	if err != nil {
+		t.Fatalf("CreateConversation() error = %v", err)
+	}
+	if _, err := m.CreateConversation(ctx, database.CreateConversationParams{UserA: low, UserB: high}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("CreateConversation() twice error = %v, want ErrUniqueViolation", err)
+	}
+
+	m.now = func() time.Time { return time.Now().UTC().Add(time.Minute) }
+	msg, err := m.CreateMessage(ctx, database.CreateMessageParams{ID: uuid.New(), ConversationID: c.ID, SenderID: alice.ID, Body: []byte{1}})
+	if err != nil {
+		t.Fatalf("CreateMessage() error = %v", err)
+	}
+	if got, _ := m.GetConversation(ctx, c.ID); !got.UpdatedAt.Equal(msg.CreatedAt) {
+		t.Errorf("conversation updated_at = %v, want %v", got.UpdatedAt, msg.CreatedAt)
+	}
+
+	if err := m.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetConversation(ctx, c.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetConversation() after deleting a member error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := m.GetLatestMessage(ctx, c.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetLatestMessage() after deleting a member error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestMemoryBlocks(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	alice, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	bob, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	carol, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "c@example.com", HashedPassword: "x"})
+	for _, u := range []database.User{alice, bob, carol} {
+		m.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: u.ID})
+	}
+
+	if err := m.BlockUser(ctx, database.BlockUserParams{BlockerID: alice.ID, BlockedID: alice.ID}); !errors.Is(err, ErrCheckViolation) {
+		t.Errorf("BlockUser() self error = %v, want ErrCheckViolation", err)
+	}
+	if err := m.MuteUser(ctx, database.MuteUserParams{MuterID: alice.ID, MutedID: uuid.New()}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("MuteUser() unknown user error = %v, want ErrForeignKeyViolation", err)
+	}
+	if err := m.BlockUser(ctx, database.BlockUserParams{BlockerID: alice.ID, BlockedID: bob.ID}); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.MuteUser(ctx, database.MuteUserParams{MuterID: bob.ID, MutedID: carol.ID}); err != nil {
+		t.Fatal(err)
+	}
+
+	if blocked, _ := m.IsBlocked(ctx, database.IsBlockedParams{BlockerID: bob.ID, BlockedID: alice.ID}); !blocked {
+		t.Error("IsBlocked() = false for the blocked side")
+	}
+	if hidden, _ := m.ListHiddenAuthors(ctx, bob.ID); len(hidden) != 2 {
+		t.Errorf("ListHiddenAuthors() = %v, want alice and carol", hidden)
+	}
+	if chirps, _ := m.ListChirps(ctx, bob.ID); len(chirps) != 1 || chirps[0].UserID != bob.ID {
+		t.Errorf("ListChirps() for bob = %v", chirps)
+	}
+	if chirps, _ := m.ListChirps(ctx, carol.ID); len(chirps) != 3 {
+		t.Errorf("ListChirps() for carol = %v", chirps)
+	}
+
+	if err := m.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if hidden, _ := m.ListHiddenAuthors(ctx, bob.ID); len(hidden) != 1 || hidden[0] != carol.ID {
+		t.Errorf("ListHiddenAuthors() after deleting the blocker = %v", hidden)
+	}
+}
+
+func TestMemoryReports(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+
+	alice, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	bob, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	chirp, _ := m.CreateChirp(ctx, database.CreateChirpParams{Body: "hi", UserID: bob.ID})
+
+	r, err := m.CreateReport(ctx, database.CreateReportParams{ChirpID: chirp.ID, ReporterID: alice.ID, Reason: "spam"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.CreateReport(ctx, database.CreateReportParams{ChirpID: chirp.ID, ReporterID: alice.ID, Reason: "hate"}); !errors.Is(err, ErrUniqueViolation) {
+		t.Errorf("CreateReport() twice error = %v, want ErrUniqueViolation", err)
+	}
+
+	moderator := uuid.NullUUID{UUID: bob.ID, Valid: true}
+	if _, err := m.ResolveReport(ctx, database.ResolveReportParams{ID: r.ID, ClaimedBy: moderator}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("ResolveReport() unclaimed error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := m.ClaimReport(ctx, database.ClaimReportParams{ID: r.ID, ClaimedBy: moderator}); err != nil {
+		t.Fatal(err)
+	}
+	m.CreateModerationAction(ctx, database.CreateModerationActionParams{ModeratorID: bob.ID, Action: "claim", ReportID: uuid.NullUUID{UUID: r.ID, Valid: true}})
+
+	// deleting the author takes the chirp and its reports, but not the log
+	if err := m.DeleteUser(ctx, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetReport(ctx, r.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetReport() after deleting the chirp's author error = %v, want sql.ErrNoRows", err)
+	}
+	if log, _ := m.ListModerationActionsByReport(ctx, uuid.NullUUID{UUID: r.ID, Valid: true}); len(log) != 1 {
+		t.Errorf("ListModerationActionsByReport() after deletion = %v", log)
+	}
+}
+
+func TestMemoryAuditEvents(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	m.now = func() time.Time { return now }
+
+	actor := uuid.NullUUID{UUID: uuid.New(), Valid: true}
+	m.CreateAuditEvent(ctx, database.CreateAuditEventParams{ActorID: actor, Action: "login", Ip: "10.0.0.1"})
+	now = now.Add(48 * time.Hour)
+	m.CreateAuditEvent(ctx, database.CreateAuditEventParams{Action: "login_failed", Target: "a@example.com", Ip: "10.0.0.2"})
+	now = now.Add(time.Second)
+	m.CreateAuditEvent(ctx, database.CreateAuditEventParams{ActorID: actor, Action: "password_change", Ip: "10.0.0.1"})
+
+	tests := []struct {
+		name string
+		arg  database.ListAuditEventsParams
+		want []string
+	}{
+		{name: "All", want: []string{"password_change", "login_failed", "login"}},
+		{name: "Actor", arg: database.ListAuditEventsParams{ActorID: actor}, want: []string{"password_change", "login"}},
+		{name: "Action", arg: database.ListAuditEventsParams{Action: sql.NullString{String: "login", Valid: true}}, want: []string{"login"}},
+		{name: "Target", arg: database.ListAuditEventsParams{Target: sql.NullString{String: "a@example.com", Valid: true}}, want: []string{"login_failed"}},
+		{name: "IP", arg: database.ListAuditEventsParams{Ip: sql.NullString{String: "10.0.0.1", Valid: true}}, want: []string{"password_change", "login"}},
+		{name: "Since", arg: database.ListAuditEventsParams{Since: sql.NullTime{Time: now.Add(-time.Second), Valid: true}}, want: []string{"password_change", "login_failed"}},
+		{name: "Until", arg: database.ListAuditEventsParams{Until: sql.NullTime{Time: now.Add(-time.Second), Valid: true}}, want: []string{"login"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.arg.PageSize = 10
+			events, err := m.ListAuditEvents(ctx, tt.arg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, e := range events {
+				got = append(got, e.Action)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("ListAuditEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if err := m.DeleteAllUsers(ctx); err != nil {
+		t.Fatal(err)
+	}
+	purged, err := m.PurgeAuditEvents(ctx, now.Add(-time.Hour))
+	if err != nil || purged != 1 {
+		t.Errorf("PurgeAuditEvents() = %d, %v; want 1", purged, err)
+	}
+	if events, _ := m.ListAuditEvents(ctx, database.ListAuditEventsParams{PageSize: 10}); len(events) != 2 {
+		t.Errorf("ListAuditEvents() after purge = %v", events)
+	}
+}
+
+func TestMemoryScheduledChirps(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := m.now()
+
+	user, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	schedule := func(body string, at time.Time) database.Chirp {
+		chirp, err := m.CreateScheduledChirp(ctx, database.CreateScheduledChirpParams{Body: body, UserID: user.ID, PublishAt: sql.NullTime{Time: at, Valid: true}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return chirp
+	}
+	second := schedule("second", now.Add(-time.Minute))
+	first := schedule("first", now.Add(-time.Hour))
+	schedule("later", now.Add(time.Hour))
+
+	if chirps, _ := m.ListChirps(ctx, uuid.Nil); len(chirps) != 0 {
+		t.Errorf("ListChirps() = %v, want no scheduled chirps", chirps)
+	}
+
+	due, _ := m.ListDueChirps(ctx, database.ListDueChirpsParams{PublishAt: sql.NullTime{Time: now, Valid: true}, Limit: 10})
+	if len(due) != 2 || due[0].ID != first.ID || due[1].ID != second.ID {
+		t.Fatalf("ListDueChirps() = %v, want first and second", due)
+	}
+	if due, _ := m.ListDueChirps(ctx, database.ListDueChirpsParams{PublishAt: sql.NullTime{Time: now, Valid: true}, Limit: 1}); len(due) != 1 {
+		t.Errorf("ListDueChirps() with limit 1 = %v", due)
+	}
+
+	if _, err := m.PublishChirp(ctx, first.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.PublishChirp(ctx, first.ID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("PublishChirp() twice error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := m.RescheduleChirp(ctx, database.RescheduleChirpParams{ID: first.ID, UserID: user.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RescheduleChirp() after publishing error = %v, want sql.ErrNoRows", err)
+	}
+	if n, _ := m.CancelScheduledChirp(ctx, database.CancelScheduledChirpParams{ID: first.ID, UserID: user.ID}); n != 0 {
+		t.Errorf("CancelScheduledChirp() after publishing = %d, want 0", n)
+	}
+	if chirps, _ := m.ListChirps(ctx, uuid.Nil); len(chirps) != 1 || chirps[0].ID != first.ID {
+		t.Errorf("ListChirps() = %v, want the published chirp", chirps)
+	}
+	if scheduled, _ := m.ListScheduledChirpsByAuthor(ctx, user.ID); len(scheduled) != 2 || scheduled[0].ID != second.ID {
+		t.Errorf("ListScheduledChirpsByAuthor() = %v", scheduled)
+	}
+}
+
+func TestMemoryDrafts(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	now := m.now()
+	m.now = func() time.Time { return now }
+
+	alice, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "a@example.com", HashedPassword: "x"})
+	bob, _ := m.CreateUser(ctx, database.CreateUserParams{Email: "b@example.com", HashedPassword: "x"})
+	if _, err := m.CreateDraft(ctx, database.CreateDraftParams{UserID: uuid.New(), Body: "orphan"}); !errors.Is(err, ErrForeignKeyViolation) {
+		t.Errorf("CreateDraft() for a missing user error = %v, want ErrForeignKeyViolation", err)
+	}
+
+	first, _ := m.CreateDraft(ctx, database.CreateDraftParams{UserID: alice.ID, Body: "first"})
+	second, _ := m.CreateDraft(ctx, database.CreateDraftParams{UserID: alice.ID, Body: "second"})
+	m.CreateDraft(ctx, database.CreateDraftParams{UserID: bob.ID, Body: "bob's"})
+
+	now = now.Add(time.Minute)
+	if _, err := m.UpdateDraft(ctx, database.UpdateDraftParams{ID: first.ID, UserID: alice.ID, Body: "edited"}); err != nil {
+		t.Fatal(err)
+	}
+	drafts, _ := m.ListDraftsByUser(ctx, alice.ID)
+	if len(drafts) != 2 || drafts[0].ID != first.ID || drafts[0].Body != "edited" || drafts[1].ID != second.ID {
+		t.Errorf("ListDraftsByUser() = %v, want the edited draft first", drafts)
+	}
+	if count, _ := m.CountDraftsByUser(ctx, alice.ID); count != 2 {
+		t.Errorf("CountDraftsByUser() = %d, want 2", count)
+	}
+
+	if _, err := m.GetDraft(ctx, database.GetDraftParams{ID: first.ID, UserID: bob.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetDraft() by someone else error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := m.UpdateDraft(ctx, database.UpdateDraftParams{ID: first.ID, UserID: bob.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateDraft() by someone else error = %v, want sql.ErrNoRows", err)
+	}
+	if n, _ := m.DeleteDraft(ctx, database.DeleteDraftParams{ID: first.ID, UserID: bob.ID}); n != 0 {
+		t.Errorf("DeleteDraft() by someone else = %d, want 0", n)
+	}
+	if n, _ := m.DeleteDraft(ctx, database.DeleteDraftParams{ID: first.ID, UserID: alice.ID}); n != 1 {
+		t.Errorf("DeleteDraft() = %d, want 1", n)
+	}
+
+	third, _ := m.CreateDraft(ctx, database.CreateDraftParams{UserID: alice.ID, Body: "three"})
+	if _, err := m.TakeDraft(ctx, database.TakeDraftParams{ID: third.ID, UserID: bob.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("TakeDraft() by someone else error = %v, want sql.ErrNoRows", err)
+	}
+	if got, err := m.TakeDraft(ctx, database.TakeDraftParams{ID: third.ID, UserID: alice.ID}); err != nil || got.Body != "three" {
+		t.Errorf("TakeDraft() = %+v, %v, want the draft", got, err)
+	}
+	if _, err := m.TakeDraft(ctx, database.TakeDraftParams{ID: third.ID, UserID: alice.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("TakeDraft() twice error = %v, want sql.ErrNoRows", err)
+	}
+
+	if err := m.DeleteUser(ctx, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := m.GetDraft(ctx, database.GetDraftParams{ID: second.ID, UserID: alice.ID}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetDraft() after deleting the user error = %v, want sql.ErrNoRows", err)
+	}
+	if count, _ := m.CountDraftsByUser(ctx, bob.ID); count != 1 {
+		t.Errorf("CountDraftsByUser() for bob = %d, want 1", count)
+	}
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/lib/pq"
+)
+
+const (
+	maxTxAttempts = 5
+	txRetryDelay  = 20 * time.Millisecond
+)
+
+// Postgres is the production Store, backed by the sqlc queries.
+type Postgres struct {
+	*database.Queries
+	db *sql.DB
+}
+
+var _ Store = (*Postgres)(nil)
+
+// NewPostgres returns a Store whose queries are traced with OpenTelemetry.
+func NewPostgres(db *sql.DB) *Postgres {
+	return &Postgres{
+		Queries: database.New(database.Traced(db)),
+		db:      db,
+	}
+}
+
+// InTx runs fn inside a serializable transaction, committing if it returns
+// nil and rolling back otherwise. Serialization failures and deadlocks are
+// retried with jittered backoff, so fn must be safe to run more than once.
+func (p *Postgres) InTx(ctx context.Context, fn func(Store) error) error {
+	return retryTx(ctx, func() error {
+		tx, err := p.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+		if err != nil {
+			return err
+		}
+
+		if err := fn(pgTx{database.New(database.Traced(tx))}); err != nil {
+			tx.Rollback()
+			return err
+		}
+		return tx.Commit()
+	})
+}
+
+// pgTx is the Store handed to an InTx callback. Nested InTx calls join the
+// surrounding transaction.
+type pgTx struct {
+	*database.Queries
+}
+
+func (t pgTx) InTx(ctx context.Context, fn func(Store) error) error {
+	return fn(t)
+}
+
+func retryTx(ctx context.Context, attempt func() error) error {
+	var err error
+	for i := range maxTxAttempts {
+		err = attempt()
+		if !isRetryable(err) {
+			return err
+		}
+
+		delay := txRetryDelay<<i + rand.N(txRetryDelay)
+		select {
+		case <-ctx.Done():
+			return errors.Join(err, ctx.Err())
+		case <-time.After(delay):
+		}
+	}
+	return err
+}
+
+// isRetryable reports whether err aborted a transaction that may succeed if
+// run again.
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+	return pqErr.Code == "40001" || pqErr.Code == "40P01"
+}
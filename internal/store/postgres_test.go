@@ -0,0 +1,50 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/lib/pq"
+)
+
+func TestRetryTx(t *testing.T) {
+	serialization := &pq.Error{Code: "40001"}
+	deadlock := &pq.Error{Code: "40P01"}
+	uniqueViolation := &pq.Error{Code: "23505"}
+
+	tests := []struct {
+		name         string
+		errs         []error
+		wantErr      error
+		wantAttempts int
+	}{
+		{name: "Success", errs: []error{nil}, wantAttempts: 1},
+		{name: "Retry serialization failure", errs: []error{serialization, nil}, wantAttempts: 2},
+		{name: "Retry deadlock", errs: []error{deadlock, deadlock, nil}, wantAttempts: 3},
+		{name: "Other errors are not retried", errs: []error{uniqueViolation}, wantErr: uniqueViolation, wantAttempts: 1},
+		{
+			name:         "Give up after max attempts",
+			errs:         []error{serialization, serialization, serialization, serialization, serialization},
+			wantErr:      serialization,
+			wantAttempts: maxTxAttempts,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			attempts := 0
+			err := retryTx(context.Background(), func() error {
+				err := tt.errs[attempts]
+				attempts++
+				return err
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("retryTx() error = %v, want %v", err, tt.wantErr)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+		})
+	}
+}
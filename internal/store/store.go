@@ -0,0 +1,127 @@
+// Package store defines the persistence interface the HTTP handlers depend on,
+// along with an in-memory implementation for tests.
+package store
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// Store covers the user, chirp, draft, media, link, notification, direct
+// message, block and mute, report and moderation log, audit log, and refresh
+// token operations.
+// Postgres implements it on top of the sqlc generated queries.
+type Store interface {
+	// InTx runs fn with a Store whose operations all commit or roll back
+	// together, depending on whether fn returns an error.
+	InTx(ctx context.Context, fn func(Store) error) error
+
+	CreateUser(ctx context.Context, arg database.CreateUserParams) (database.User, error)
+	DeleteAllUsers(ctx context.Context) error
+	GetUserByEmail(ctx context.Context, email string) (database.User, error)
+	GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+	GetUserByHandle(ctx context.Context, handle string) (database.User, error)
+	UpdateUser(ctx context.Context, arg database.UpdateUserParams) (database.User, error)
+	UpgradeUserToChirpyRed(ctx context.Context, id uuid.UUID) error
+	DeleteUser(ctx context.Context, id uuid.UUID) error
+	ScheduleUserDeletion(ctx context.Context, arg database.ScheduleUserDeletionParams) (database.User, error)
+	CancelUserDeletion(ctx context.Context, id uuid.UUID) error
+	DeleteUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) (int64, error)
+	SetPendingEmail(ctx context.Context, arg database.SetPendingEmailParams) (database.User, error)
+	GetUserByEmailVerificationToken(ctx context.Context, emailVerificationToken sql.NullString) (database.User, error)
+	ConfirmPendingEmail(ctx context.Context, id uuid.UUID) (database.User, error)
+	SetDMPrivacy(ctx context.Context, arg database.SetDMPrivacyParams) (database.User, error)
+	SuspendUser(ctx context.Context, arg database.SuspendUserParams) (database.User, error)
+	BanUser(ctx context.Context, arg database.BanUserParams) (database.User, error)
+	UnsuspendUser(ctx context.Context, id uuid.UUID) (database.User, error)
+
+	CreateChirp(ctx context.Context, arg database.CreateChirpParams) (database.Chirp, error)
+	GetChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+	ListChirps(ctx context.Context, viewerID uuid.UUID) ([]database.Chirp, error)
+	ListChirpsByAuthor(ctx context.Context, arg database.ListChirpsByAuthorParams) ([]database.Chirp, error)
+	ListAllChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	SoftDeleteChirp(ctx context.Context, id uuid.UUID) error
+	RestoreChirp(ctx context.Context, arg database.RestoreChirpParams) (database.Chirp, error)
+	PurgeDeletedChirps(ctx context.Context, deletedAt sql.NullTime) (int64, error)
+	CreateScheduledChirp(ctx context.Context, arg database.CreateScheduledChirpParams) (database.Chirp, error)
+	ListScheduledChirpsByAuthor(ctx context.Context, userID uuid.UUID) ([]database.Chirp, error)
+	RescheduleChirp(ctx context.Context, arg database.RescheduleChirpParams) (database.Chirp, error)
+	CancelScheduledChirp(ctx context.Context, arg database.CancelScheduledChirpParams) (int64, error)
+	ListDueChirps(ctx context.Context, arg database.ListDueChirpsParams) ([]database.Chirp, error)
+	PublishChirp(ctx context.Context, id uuid.UUID) (database.Chirp, error)
+
+	CreateDraft(ctx context.Context, arg database.CreateDraftParams) (database.Draft, error)
+	GetDraft(ctx context.Context, arg database.GetDraftParams) (database.Draft, error)
+	ListDraftsByUser(ctx context.Context, userID uuid.UUID) ([]database.Draft, error)
+	CountDraftsByUser(ctx context.Context, userID uuid.UUID) (int64, error)
+	UpdateDraft(ctx context.Context, arg database.UpdateDraftParams) (database.Draft, error)
+	DeleteDraft(ctx context.Context, arg database.DeleteDraftParams) (int64, error)
+	TakeDraft(ctx context.Context, arg database.TakeDraftParams) (database.Draft, error)
+
+	CreateMedia(ctx context.Context, arg database.CreateMediaParams) (database.Medium, error)
+	GetMedia(ctx context.Context, id uuid.UUID) (database.Medium, error)
+	AttachMedia(ctx context.Context, arg database.AttachMediaParams) (int64, error)
+	ListMediaByChirps(ctx context.Context, dollar_1 []uuid.UUID) ([]database.Medium, error)
+	ListMediaByUser(ctx context.Context, userID uuid.UUID) ([]database.Medium, error)
+	DeleteMediaOfScheduledChirp(ctx context.Context, arg database.DeleteMediaOfScheduledChirpParams) ([]uuid.UUID, error)
+	DeleteMediaOfDeletedChirps(ctx context.Context, deletedAt sql.NullTime) ([]uuid.UUID, error)
+	DeleteMediaByUser(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+	DeleteMediaOfUsersScheduledBefore(ctx context.Context, deletionScheduledAt sql.NullTime) ([]uuid.UUID, error)
+
+	CreateLink(ctx context.Context, arg database.CreateLinkParams) (database.Link, error)
+	FollowLink(ctx context.Context, code string) (database.Link, error)
+	ListLinksByChirps(ctx context.Context, dollar_1 []uuid.UUID) ([]database.Link, error)
+	ListLinksPendingPreview(ctx context.Context, limit int32) ([]database.Link, error)
+	SetLinkPreview(ctx context.Context, arg database.SetLinkPreviewParams) error
+
+	CreateNotification(ctx context.Context, arg database.CreateNotificationParams) (database.Notification, error)
+	ListNotifications(ctx context.Context, arg database.ListNotificationsParams) ([]database.Notification, error)
+	CountUnreadNotifications(ctx context.Context, userID uuid.UUID) (int64, error)
+	MarkNotificationsRead(ctx context.Context, arg database.MarkNotificationsReadParams) (int64, error)
+	MarkAllNotificationsRead(ctx context.Context, userID uuid.UUID) (int64, error)
+	ListNotificationPreferences(ctx context.Context, userID uuid.UUID) ([]database.NotificationPreference, error)
+	SetNotificationPreference(ctx context.Context, arg database.SetNotificationPreferenceParams) error
+
+	BlockUser(ctx context.Context, arg database.BlockUserParams) error
+	UnblockUser(ctx context.Context, arg database.UnblockUserParams) error
+	IsBlocked(ctx context.Context, arg database.IsBlockedParams) (bool, error)
+	MuteUser(ctx context.Context, arg database.MuteUserParams) error
+	UnmuteUser(ctx context.Context, arg database.UnmuteUserParams) error
+	IsMuted(ctx context.Context, arg database.IsMutedParams) (bool, error)
+	ListHiddenAuthors(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+
+	CreateConversation(ctx context.Context, arg database.CreateConversationParams) (database.Conversation, error)
+	GetConversation(ctx context.Context, id uuid.UUID) (database.Conversation, error)
+	GetConversationByUsers(ctx context.Context, arg database.GetConversationByUsersParams) (database.Conversation, error)
+	ListConversationsByUser(ctx context.Context, userA uuid.UUID) ([]database.Conversation, error)
+	CreateMessage(ctx context.Context, arg database.CreateMessageParams) (database.Message, error)
+	ListMessages(ctx context.Context, arg database.ListMessagesParams) ([]database.Message, error)
+	ListMessagesByUser(ctx context.Context, userA uuid.UUID) ([]database.Message, error)
+	GetLatestMessage(ctx context.Context, conversationID uuid.UUID) (database.Message, error)
+	CountUnreadMessages(ctx context.Context, arg database.CountUnreadMessagesParams) (int64, error)
+	MarkMessagesRead(ctx context.Context, arg database.MarkMessagesReadParams) (int64, error)
+
+	CreateReport(ctx context.Context, arg database.CreateReportParams) (database.Report, error)
+	GetReport(ctx context.Context, id uuid.UUID) (database.Report, error)
+	ChirpHiddenByReport(ctx context.Context, chirpID uuid.UUID) (bool, error)
+	ListReports(ctx context.Context, arg database.ListReportsParams) ([]database.Report, error)
+	ClaimReport(ctx context.Context, arg database.ClaimReportParams) (database.Report, error)
+	ResolveReport(ctx context.Context, arg database.ResolveReportParams) (database.Report, error)
+	ResolveOpenReportsByChirp(ctx context.Context, arg database.ResolveOpenReportsByChirpParams) ([]database.Report, error)
+	CreateModerationAction(ctx context.Context, arg database.CreateModerationActionParams) (database.ModerationLog, error)
+	ListModerationActionsByReport(ctx context.Context, reportID uuid.NullUUID) ([]database.ModerationLog, error)
+
+	CreateAuditEvent(ctx context.Context, arg database.CreateAuditEventParams) (database.AuditEvent, error)
+	ListAuditEvents(ctx context.Context, arg database.ListAuditEventsParams) ([]database.AuditEvent, error)
+	PurgeAuditEvents(ctx context.Context, createdAt time.Time) (int64, error)
+
+	CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+	GetUserFromRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, token string) error
+	DeleteRefreshTokensByUser(ctx context.Context, userID uuid.UUID) error
+	ListRefreshTokensByUser(ctx context.Context, userID uuid.UUID) ([]database.RefreshToken, error)
+}
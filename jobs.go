@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"log/slog"
+	"time"
+
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// runPeriodically calls job every interval until ctx is cancelled. Failures
+// are logged and retried on the next tick.
+func runPeriodically(ctx context.Context, name string, interval time.Duration, job func(context.Context) error) {
+	runPeriodicallyOrOnWake(ctx, name, interval, nil, job)
+}
+
+// runPeriodicallyOrOnWake is runPeriodically, but also calls job as soon as
+// something is sent on wake.
+func runPeriodicallyOrOnWake(ctx context.Context, name string, interval time.Duration, wake <-chan struct{}, job func(context.Context) error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			slog.ErrorContext(ctx, "background job failed", "job", name, "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-wake:
+		}
+	}
+}
+
+// purgeDeletedChirps hard-deletes chirps whose restore window has passed,
+// along with the files of their media. Chirps a moderator hid are kept so
+// their reports aren't lost.
+func (cfg *apiConfig) purgeDeletedChirps(ctx context.Context) error {
+	cutoff := sql.NullTime{Time: time.Now().UTC().Add(-cfg.chirpRestoreWindow), Valid: true}
+	var mediaIDs []uuid.UUID
+	var purged int64
+	err := cfg.db.InTx(ctx, func(tx store.Store) error {
+		var err error
+		mediaIDs, err = tx.DeleteMediaOfDeletedChirps(ctx, cutoff)
+		if err != nil {
+			return err
+		}
+		purged, err = tx.PurgeDeletedChirps(ctx, cutoff)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	cfg.deleteMediaBlobs(ctx, mediaIDs)
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged deleted chirps", "count", purged)
+	}
+	return nil
+}
+
+// purgeScheduledAccounts deletes accounts whose deletion grace period has
+// ended, along with the files of their media.
+func (cfg *apiConfig) purgeScheduledAccounts(ctx context.Context) error {
+	now := sql.NullTime{Time: time.Now().UTC(), Valid: true}
+	var mediaIDs []uuid.UUID
+	var deleted int64
+	err := cfg.db.InTx(ctx, func(tx store.Store) error {
+		var err error
+		mediaIDs, err = tx.DeleteMediaOfUsersScheduledBefore(ctx, now)
+		if err != nil {
+			return err
+		}
+		deleted, err = tx.DeleteUsersScheduledBefore(ctx, now)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	cfg.deleteMediaBlobs(ctx, mediaIDs)
+	if deleted > 0 {
+		slog.InfoContext(ctx, "deleted scheduled accounts", "count", deleted)
+	}
+	return nil
+}
+
+// purgeAuditEvents deletes audit events older than the retention period.
+func (cfg *apiConfig) purgeAuditEvents(ctx context.Context) error {
+	cutoff := time.Now().UTC().Add(-max(cfg.auditRetention, minAuditRetention))
+	purged, err := cfg.db.PurgeAuditEvents(ctx, cutoff)
+	if err != nil {
+		return err
+	}
+	if purged > 0 {
+		slog.InfoContext(ctx, "purged audit events", "count", purged)
+	}
+	return nil
+}
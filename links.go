@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/preview"
+	"github.com/google/uuid"
+)
+
+const (
+	// shortLinkLength is what every URL counts for toward the chirp length
+	// limit, however long it really is.
+	shortLinkLength = 23
+	shortCodeLength = 8
+
+	previewBatchSize    = 20
+	previewFetchTimeout = 15 * time.Second
+	maxPreviewTitle     = 300
+	maxPreviewText      = 500
+)
+
+var urlPattern = regexp.MustCompile(`https?://[^\s<>"]+`)
+
+const shortCodeAlphabet = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// findLinks returns the [start, end) byte offsets of the URLs in body.
+// Punctuation that usually ends a sentence rather than a URL is left out.
+func findLinks(body string) [][2]int {
+	var links [][2]int
+	for _, loc := range urlPattern.FindAllStringIndex(body, -1) {
+		start, end := loc[0], loc[1]
+		for end > start && strings.ContainsRune(".,;:!?'\")]", rune(body[end-1])) {
+			end--
+		}
+		u, err := url.Parse(body[start:end])
+		if err != nil || u.Host == "" {
+			continue
+		}
+		links = append(links, [2]int{start, end})
+	}
+	return links
+}
+
+// shortenLinks replaces each URL in body with a short link under baseURL
+// and returns the rewritten body along with the links to record.
+func shortenLinks(body, baseURL string) (string, []database.CreateLinkParams) {
+	var b strings.Builder
+	var links []database.CreateLinkParams
+	last := 0
+	for i, loc := range findLinks(body) {
+		code := newShortCode()
+		links = append(links, database.CreateLinkParams{
+			Code:     code,
+			Url:      body[loc[0]:loc[1]],
+			Position: int32(i),
+		})
+		b.WriteString(body[last:loc[0]])
+		b.WriteString(shortURL(baseURL, code))
+		last = loc[1]
+	}
+	b.WriteString(body[last:])
+	return b.String(), links
+}
+
+// newShortCode returns a random code, drawing bytes until each one maps
+// evenly onto the alphabet.
+func newShortCode() string {
+	code := make([]byte, 0, shortCodeLength)
+	buf := make([]byte, shortCodeLength)
+	limit := 256 - 256%len(shortCodeAlphabet)
+	for len(code) < shortCodeLength {
+		rand.Read(buf)
+		for _, c := range buf {
+			if int(c) < limit && len(code) < shortCodeLength {
+				code = append(code, shortCodeAlphabet[int(c)%len(shortCodeAlphabet)])
+			}
+		}
+	}
+	return string(code)
+}
+
+func shortURL(baseURL, code string) string {
+	return strings.TrimSuffix(baseURL, "/") + "/l/" + code
+}
+
+// chirpLink is how a link is described in chirp responses.
+type chirpLink struct {
+	URL      string       `json:"url"`
+	ShortURL string       `json:"short_url"`
+	Clicks   int64        `json:"clicks"`
+	Preview  *linkPreview `json:"preview,omitempty"`
+}
+
+type linkPreview struct {
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	ImageURL    string `json:"image_url,omitempty"`
+}
+
+// linksByChirp returns the links in each of the chirps, in body order.
+// Previews appear once the background worker has fetched them.
+func (cfg *apiConfig) linksByChirp(ctx context.Context, chirpIDs []uuid.UUID) (map[uuid.UUID][]chirpLink, error) {
+	byChirp := map[uuid.UUID][]chirpLink{}
+	if len(chirpIDs) == 0 {
+		return byChirp, nil
+	}
+
+	rows, err := cfg.db.ListLinksByChirps(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, l := range rows {
+		link := chirpLink{
+			URL:      l.Url,
+			ShortURL: shortURL(cfg.publicURL, l.Code),
+			Clicks:   l.Clicks,
+		}
+		if l.PreviewTitle != "" || l.PreviewDescription != "" || l.PreviewImageUrl != "" {
+			link.Preview = &linkPreview{
+				Title:       l.PreviewTitle,
+				Description: l.PreviewDescription,
+				ImageURL:    l.PreviewImageUrl,
+			}
+		}
+		byChirp[l.ChirpID] = append(byChirp[l.ChirpID], link)
+	}
+	return byChirp, nil
+}
+
+// followLink counts a click on a short link and redirects to its target.
+// Links only work while their chirp is published: not before a scheduled
+// chirp goes out, and not after it is deleted.
+func (cfg *apiConfig) followLink(w http.ResponseWriter, req *http.Request) {
+	link, err := cfg.db.FollowLink(req.Context(), req.PathValue("code"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, req, link.Url, http.StatusFound)
+}
+
+// wakePreviewFetcher runs fetchLinkPreviews now rather than on its next tick,
+// so cards show up soon after a chirp is published. It never blocks: a
+// wake-up that is already pending covers this one too.
+func (cfg *apiConfig) wakePreviewFetcher() {
+	select {
+	case cfg.previewWake <- struct{}{}:
+	default:
+	}
+}
+
+// fetchLinkPreviews fills in preview cards for links in published chirps
+// that don't have one yet. Links in scheduled chirps wait until they are
+// published, so the linked sites don't hear about them early. A link is only
+// tried once: pages that fail or have no metadata are stored with an empty
+// card.
+func (cfg *apiConfig) fetchLinkPreviews(ctx context.Context) error {
+	links, err := cfg.db.ListLinksPendingPreview(ctx, previewBatchSize)
+	if err != nil {
+		return err
+	}
+
+	for _, link := range links {
+		fetchCtx, cancel := context.WithTimeout(ctx, previewFetchTimeout)
+		card, err := preview.Fetch(fetchCtx, cfg.fetcher, link.Url)
+		cancel()
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			slog.DebugContext(ctx, "fetch link preview", "url", link.Url, "error", err)
+		}
+
+		err = cfg.db.SetLinkPreview(ctx, database.SetLinkPreviewParams{
+			ID:                 link.ID,
+			PreviewTitle:       truncate(card.Title, maxPreviewTitle),
+			PreviewDescription: truncate(card.Description, maxPreviewText),
+			PreviewImageUrl:    card.ImageURL,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// truncate shortens s to at most n runes.
+func truncate(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestChirpLength(t *testing.T) {
+	long := "https://example.com/" + strings.Repeat("a", 200)
+
+	tests := []struct {
+		name      string
+		body      string
+		wantLinks []string
+		wantLen   int
+	}{
+		{name: "No links", body: "hello there", wantLen: 11},
+		{name: "Long link counts as fixed length", body: "see " + long, wantLinks: []string{long}, wantLen: 4 + shortLinkLength},
+		{name: "Trailing punctuation", body: "(see https://example.com/x).", wantLinks: []string{"https://example.com/x"}, wantLen: 7 + shortLinkLength},
+		{name: "Two links", body: "http://a.io and https://b.io/c?d=e", wantLinks: []string{"http://a.io", "https://b.io/c?d=e"}, wantLen: 5 + 2*shortLinkLength},
+		{name: "Scheme without host", body: "http:// is not a link", wantLen: 21},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var links []string
+			for _, loc := range findLinks(tt.body) {
+				links = append(links, tt.body[loc[0]:loc[1]])
+			}
+			if strings.Join(links, " ") != strings.Join(tt.wantLinks, " ") {
+				t.Errorf("findLinks() = %q, want %q", links, tt.wantLinks)
+			}
+			if got := chirpLength(tt.body); got != tt.wantLen {
+				t.Errorf("chirpLength() = %d, want %d", got, tt.wantLen)
+			}
+		})
+	}
+}
+
+// previewFetcher serves the same page for every URL.
+type previewFetcher struct {
+	page string
+}
+
+func (f previewFetcher) Do(req *http.Request) (*http.Response, error) {
+	return &http.Response{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       io.NopCloser(strings.NewReader(f.page)),
+		Request:    req,
+	}, nil
+}
+
+func TestChirpLinks(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.fetcher = previewFetcher{page: `<meta property="og:title" content="Example"><meta property="og:image" content="/card.png">`}
+	user := api.signUp("a@example.com")
+
+	target := "https://example.com/articles/" + strings.Repeat("x", 150)
+	chirp := api.chirp(user, "read this: "+target+"!")
+
+	if !strings.HasPrefix(chirp.Body, "read this: http://chirpy.test/l/") || !strings.HasSuffix(chirp.Body, "!") {
+		t.Fatalf("body = %q, want the URL replaced by a short link", chirp.Body)
+	}
+	shortLink := strings.TrimSuffix(strings.TrimPrefix(chirp.Body, "read this: "), "!")
+
+	// follow the short link without chasing the redirect
+	client := api.srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	for range 2 {
+		resp, err := client.Get(api.srv.URL + strings.TrimPrefix(shortLink, "http://chirpy.test"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusFound || resp.Header.Get("Location") != target {
+			t.Fatalf("redirect = %d to %q, want 302 to %q", resp.StatusCode, resp.Header.Get("Location"), target)
+		}
+	}
+	if code, _ := api.do("GET", "/l/unknown", "", nil); code != http.StatusNotFound {
+		t.Errorf("unknown code: status = %d, want 404", code)
+	}
+
+	if err := api.cfg.fetchLinkPreviews(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	var got struct {
+		Links []chirpLink `json:"links"`
+	}
+	_, body := api.do("GET", "/api/chirps/"+chirp.ID, "", nil)
+	decode(t, body, &got)
+	if len(got.Links) != 1 {
+		t.Fatalf("links = %+v, want one", got.Links)
+	}
+	link := got.Links[0]
+	if link.URL != target || link.ShortURL != shortLink || link.Clicks != 2 {
+		t.Errorf("link = %+v", link)
+	}
+	if link.Preview == nil || link.Preview.Title != "Example" || link.Preview.ImageURL != "https://example.com/card.png" {
+		t.Errorf("preview = %+v", link.Preview)
+	}
+
+	// links in deleted chirps stop redirecting
+	api.do("DELETE", "/api/chirps/"+chirp.ID, user.bearer(), nil)
+	resp, err := client.Get(api.srv.URL + strings.TrimPrefix(shortLink, "http://chirpy.test"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Errorf("link in deleted chirp: status = %d, want 404", resp.StatusCode)
+	}
+}
+
+func TestScheduledChirpLinks(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.fetcher = previewFetcher{page: `<meta property="og:title" content="Example">`}
+	api.cfg.previewWake = make(chan struct{}, 1)
+	user := api.signUp("a@example.com")
+	ctx := context.Background()
+
+	chirp := api.scheduleChirp(user, "soon: https://example.com/launch")
+	shortLink := strings.TrimPrefix(chirp.Body, "soon: http://chirpy.test")
+	preview := func() *linkPreview {
+		t.Helper()
+		_, body := api.do("GET", "/api/chirps/"+chirp.ID, "", nil)
+		var got struct {
+			Links []chirpLink `json:"links"`
+		}
+		decode(t, body, &got)
+		if len(got.Links) != 1 {
+			t.Fatalf("links = %+v, want one", got.Links)
+		}
+		return got.Links[0].Preview
+	}
+
+	// nothing about the link gets out before the chirp does
+	if code, _ := api.do("GET", shortLink, "", nil); code != http.StatusNotFound {
+		t.Errorf("link in scheduled chirp: status = %d, want 404", code)
+	}
+	if err := api.cfg.fetchLinkPreviews(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	api.makeDue(user, chirp.ID)
+	if err := api.cfg.publishScheduledChirps(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p := preview(); p != nil {
+		t.Errorf("preview fetched before publishing: %+v", p)
+	}
+	select {
+	case <-api.cfg.previewWake:
+	default:
+		t.Error("publishing didn't wake the preview job")
+	}
+
+	if err := api.cfg.fetchLinkPreviews(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if p := preview(); p == nil || p.Title != "Example" {
+		t.Errorf("preview = %+v", p)
+	}
+	client := api.srv.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }
+	resp, err := client.Get(api.srv.URL + shortLink)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("link in published chirp: status = %d, want 302", resp.StatusCode)
+	}
+}
@@ -0,0 +1,318 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+const (
+	liveWriteTimeout   = 10 * time.Second
+	liveMaxMessageSize = 4096
+	liveMaxChannels    = 50
+
+	// close codes in the range reserved for applications
+	liveCloseTokenExpired = 4001
+	liveCloseSuspended    = 4003
+	liveCloseTooSlow      = 4008
+
+	// eventAccountSuspended is published to accountTopic when a user is
+	// suspended or banned, to end their live sessions.
+	eventAccountSuspended = "account.suspended"
+)
+
+// liveHeartbeat is how often an idle connection is sent a heartbeat.
+var liveHeartbeat = 30 * time.Second
+
+// liveConn is a message-oriented connection to one client. The WebSocket
+// endpoint adapts a *websocket.Conn; tests use an in-memory pair.
+type liveConn interface {
+	Read(ctx context.Context) ([]byte, error)
+	Write(ctx context.Context, data []byte) error
+	Close(code int, reason string) error
+}
+
+// liveRequest is a message from the client.
+type liveRequest struct {
+	Type    string `json:"type"`
+	Channel string `json:"channel,omitempty"`
+	Token   string `json:"token,omitempty"`
+}
+
+// liveMessage is a message to the client.
+type liveMessage struct {
+	Type      string          `json:"type"`
+	Channel   string          `json:"channel,omitempty"`
+	Channels  []string        `json:"channels,omitempty"`
+	ID        uint64          `json:"id,omitempty"`
+	Event     string          `json:"event,omitempty"`
+	Data      json.RawMessage `json:"data,omitempty"`
+	ExpiresAt string          `json:"expires_at,omitempty"`
+	Error     string          `json:"error,omitempty"`
+}
+
+func chirpTopic(id uuid.UUID) string {
+	return "chirp:" + id.String()
+}
+
+func notificationsTopic(userID uuid.UUID) string {
+	return "notifications:" + userID.String()
+}
+
+// accountTopic carries events about a user's account to their own live
+// sessions. Clients can't subscribe to it; every session listens to it.
+func accountTopic(userID uuid.UUID) string {
+	return "account:" + userID.String()
+}
+
+// liveTopic maps a channel a client asks for to a hub topic:
+//
+//	timeline        every chirp
+//	user:<id>       chirps by one user
+//	chirp:<id>      updates to one chirp
+//	notifications   the caller's own notifications and direct messages
+func liveTopic(channel string, userID uuid.UUID) (string, error) {
+	if channel == "timeline" {
+		return chirpsTopic, nil
+	}
+	if channel == "notifications" {
+		return notificationsTopic(userID), nil
+	}
+
+	kind, id, ok := strings.Cut(channel, ":")
+	parsed, err := uuid.Parse(id)
+	if !ok || err != nil {
+		return "", errors.New("unknown channel")
+	}
+	switch kind {
+	case "user":
+		return userTopic(parsed), nil
+	case "chirp":
+		return chirpTopic(parsed), nil
+	}
+	return "", errors.New("unknown channel")
+}
+
+// liveSocket upgrades to a WebSocket for the authenticated user. Browsers
+// can't set headers on WebSocket requests, so the access token may also be
+// passed in the access_token parameter.
+func (cfg *apiConfig) liveSocket(w http.ResponseWriter, req *http.Request) {
+	token, err := auth.GetBearerToken(req.Header)
+	if err != nil {
+		token = req.URL.Query().Get("access_token")
+	}
+	userID, err := auth.ValidateJWT(token, cfg.authSecret)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if _, err := cfg.activeUser(req.Context(), userID); err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	expiresAt, err := auth.TokenExpiry(token)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	setRequestUserID(req.Context(), userID)
+
+	conn, err := websocket.Accept(w, req, nil)
+	if err != nil {
+		// Accept has already written the error response
+		return
+	}
+	conn.SetReadLimit(liveMaxMessageSize)
+
+	cfg.serveLive(req.Context(), wsConn{conn}, userID, expiresAt)
+}
+
+// serveLive runs a live session until the client leaves, its token expires,
+// its user is suspended or banned, or it can't keep up with its channels.
+//
+// Clients send {"type": "subscribe"|"unsubscribe", "channel": ...} to
+// choose channels, {"type": "ping"} to check the connection, and
+// {"type": "auth", "token": ...} with a fresh access token before the
+// current one expires. The server sends events, acknowledgements, errors
+// and a heartbeat whenever the connection has been idle.
+//
+// Events about users the client has blocked or muted, or who have blocked
+// them, are dropped. The list is read when the session starts and again on
+// every subscribe.
+func (cfg *apiConfig) serveLive(ctx context.Context, conn liveConn, userID uuid.UUID, expiresAt time.Time) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	sub, _, _ := cfg.hub.Subscribe(topicsOf(nil, userID), 0)
+	defer sub.Close()
+	channels := map[string]string{}
+	hidden, err := cfg.hiddenTopics(ctx, userID)
+	if err != nil {
+		slog.ErrorContext(ctx, "list hidden authors", "error", err)
+	}
+
+	requests := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		for {
+			data, err := conn.Read(ctx)
+			if err != nil {
+				readErr <- err
+				return
+			}
+			select {
+			case requests <- data:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	send := func(msg liveMessage) bool {
+		data, _ := json.Marshal(msg)
+		writeCtx, cancel := context.WithTimeout(ctx, liveWriteTimeout)
+		defer cancel()
+		return conn.Write(writeCtx, data) == nil
+	}
+
+	expiry := time.NewTimer(time.Until(expiresAt))
+	defer expiry.Stop()
+	interval := liveHeartbeat
+	heartbeat := time.NewTicker(interval)
+	defer heartbeat.Stop()
+
+	for {
+		var ok bool
+		select {
+		case <-ctx.Done():
+			conn.Close(int(websocket.StatusGoingAway), "")
+			return
+		case <-readErr:
+			return
+		case <-expiry.C:
+			send(liveMessage{Type: "error", Error: "Access token expired"})
+			conn.Close(liveCloseTokenExpired, "token expired")
+			return
+		case <-sub.Done():
+			if errors.Is(sub.Err(), pubsub.ErrSlowConsumer) {
+				conn.Close(liveCloseTooSlow, "too slow")
+			} else {
+				conn.Close(int(websocket.StatusGoingAway), "server shutting down")
+			}
+			return
+		case ev := <-sub.Events():
+			if ev.Type == eventAccountSuspended {
+				send(liveMessage{Type: "error", Error: "Account suspended"})
+				conn.Close(liveCloseSuspended, "account suspended")
+				return
+			}
+			if slices.ContainsFunc(ev.Topics, func(topic string) bool { return hidden[topic] }) {
+				continue
+			}
+			msg := liveMessage{Type: "event", ID: ev.ID, Event: ev.Type, Data: ev.Data}
+			for channel, topic := range channels {
+				if slices.Contains(ev.Topics, topic) {
+					msg.Channels = append(msg.Channels, channel)
+				}
+			}
+			slices.Sort(msg.Channels)
+			ok = send(msg)
+		case <-heartbeat.C:
+			ok = send(liveMessage{Type: "heartbeat"})
+		case data := <-requests:
+			var req liveRequest
+			if err := json.Unmarshal(data, &req); err != nil {
+				ok = send(liveMessage{Type: "error", Error: "Invalid message"})
+				break
+			}
+
+			switch req.Type {
+			case "ping":
+				ok = send(liveMessage{Type: "pong"})
+			case "subscribe":
+				topic, err := liveTopic(req.Channel, userID)
+				if err != nil {
+					ok = send(liveMessage{Type: "error", Channel: req.Channel, Error: "Unknown channel"})
+					break
+				}
+				if _, exists := channels[req.Channel]; !exists && len(channels) >= liveMaxChannels {
+					ok = send(liveMessage{Type: "error", Channel: req.Channel, Error: "Too many channels"})
+					break
+				}
+				if topics, err := cfg.hiddenTopics(ctx, userID); err == nil {
+					hidden = topics
+				} else {
+					slog.ErrorContext(ctx, "list hidden authors", "error", err)
+				}
+				channels[req.Channel] = topic
+				sub.SetTopics(topicsOf(channels, userID))
+				ok = send(liveMessage{Type: "subscribed", Channel: req.Channel})
+			case "unsubscribe":
+				delete(channels, req.Channel)
+				sub.SetTopics(topicsOf(channels, userID))
+				ok = send(liveMessage{Type: "unsubscribed", Channel: req.Channel})
+			case "auth":
+				tokenUser, err := auth.ValidateJWT(req.Token, cfg.authSecret)
+				if err == nil && tokenUser == userID {
+					_, err = cfg.activeUser(ctx, userID)
+				}
+				if err != nil || tokenUser != userID {
+					ok = send(liveMessage{Type: "error", Error: "Invalid token"})
+					break
+				}
+				expiresAt, err = auth.TokenExpiry(req.Token)
+				if err != nil {
+					ok = send(liveMessage{Type: "error", Error: "Invalid token"})
+					break
+				}
+				expiry.Reset(time.Until(expiresAt))
+				ok = send(liveMessage{Type: "authenticated", ExpiresAt: expiresAt.UTC().Format(time.RFC3339)})
+			default:
+				ok = send(liveMessage{Type: "error", Error: "Unknown message type"})
+			}
+		}
+		if !ok {
+			slog.DebugContext(ctx, "live connection write failed")
+			return
+		}
+		heartbeat.Reset(interval)
+	}
+}
+
+// topicsOf returns the hub topics for a session of userID subscribed to
+// channels.
+func topicsOf(channels map[string]string, userID uuid.UUID) []string {
+	topics := []string{accountTopic(userID)}
+	for _, topic := range channels {
+		topics = append(topics, topic)
+	}
+	return topics
+}
+
+// wsConn adapts a WebSocket to liveConn, sending text messages.
+type wsConn struct {
+	*websocket.Conn
+}
+
+func (c wsConn) Read(ctx context.Context) ([]byte, error) {
+	_, data, err := c.Conn.Read(ctx)
+	return data, err
+}
+
+func (c wsConn) Write(ctx context.Context, data []byte) error {
+	return c.Conn.Write(ctx, websocket.MessageText, data)
+}
+
+func (c wsConn) Close(code int, reason string) error {
+	return c.Conn.Close(websocket.StatusCode(code), reason)
+}
@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/coder/websocket"
+	"github.com/google/uuid"
+)
+
+// pipeConn is the server end of an in-memory live connection.
+type pipeConn struct {
+	in     chan []byte
+	out    chan []byte
+	closed chan int
+}
+
+func (c *pipeConn) Read(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-c.in:
+		return data, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *pipeConn) Write(ctx context.Context, data []byte) error {
+	select {
+	case c.out <- data:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *pipeConn) Close(code int, reason string) error {
+	select {
+	case c.closed <- code:
+	default:
+	}
+	return nil
+}
+
+// liveClient drives serveLive over a pipeConn.
+type liveClient struct {
+	t    *testing.T
+	conn *pipeConn
+	done chan struct{}
+}
+
+func (api *testAPI) openLive(user testUser, expiresAt time.Time) *liveClient {
+	api.t.Helper()
+
+	conn := &pipeConn{
+		in:     make(chan []byte),
+		out:    make(chan []byte, 16),
+		closed: make(chan int, 1),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	client := &liveClient{t: api.t, conn: conn, done: make(chan struct{})}
+	go func() {
+		defer close(client.done)
+		api.cfg.serveLive(ctx, conn, uuid.MustParse(user.ID), expiresAt)
+	}()
+	api.t.Cleanup(func() {
+		cancel()
+		<-client.done
+	})
+	return client
+}
+
+func (c *liveClient) send(msg liveRequest) {
+	c.t.Helper()
+	data, _ := json.Marshal(msg)
+	select {
+	case c.conn.in <- data:
+	case <-time.After(2 * time.Second):
+		c.t.Fatal("timed out sending")
+	}
+}
+
+func (c *liveClient) next() liveMessage {
+	c.t.Helper()
+	select {
+	case data := <-c.conn.out:
+		var msg liveMessage
+		decode(c.t, data, &msg)
+		return msg
+	case <-time.After(2 * time.Second):
+		c.t.Fatal("timed out waiting for a message")
+	}
+	return liveMessage{}
+}
+
+func (c *liveClient) expect(msgType string) liveMessage {
+	c.t.Helper()
+	msg := c.next()
+	if msg.Type != msgType {
+		c.t.Fatalf("got %+v, want type %q", msg, msgType)
+	}
+	return msg
+}
+
+func TestLiveChannels(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	client := api.openLive(bob, time.Now().Add(time.Hour))
+
+	client.send(liveRequest{Type: "subscribe", Channel: "user:" + alice.ID})
+	if msg := client.expect("subscribed"); msg.Channel != "user:"+alice.ID {
+		t.Fatalf("subscribed to %q", msg.Channel)
+	}
+	client.send(liveRequest{Type: "subscribe", Channel: "timeline"})
+	client.expect("subscribed")
+
+	chirp := api.chirp(alice, "hello live")
+	msg := client.expect("event")
+	if msg.Event != eventChirpCreated || len(msg.Channels) != 2 || msg.Channels[0] != "timeline" {
+		t.Fatalf("event = %+v", msg)
+	}
+	var got testChirp
+	decode(t, msg.Data, &got)
+	if got.ID != chirp.ID || got.Body != "hello live" {
+		t.Fatalf("data = %s", msg.Data)
+	}
+
+	client.send(liveRequest{Type: "unsubscribe", Channel: "timeline"})
+	client.expect("unsubscribed")
+	client.send(liveRequest{Type: "unsubscribe", Channel: "user:" + alice.ID})
+	client.expect("unsubscribed")
+
+	// nothing arrives for chirps nobody is subscribed to; the pong proves
+	// the event would have been sent before it
+	api.chirp(alice, "unheard")
+	client.send(liveRequest{Type: "ping"})
+	client.expect("pong")
+}
+
+func TestLiveChirpChannel(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	chirp := api.chirp(alice, "watch me")
+
+	client := api.openLive(alice, time.Now().Add(time.Hour))
+	client.send(liveRequest{Type: "subscribe", Channel: "chirp:" + chirp.ID})
+	client.expect("subscribed")
+
+	api.chirp(alice, "a different chirp")
+	if code, body := api.do("DELETE", "/api/chirps/"+chirp.ID, alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("delete: status %d: %s", code, body)
+	}
+	if msg := client.expect("event"); msg.Event != eventChirpDeleted {
+		t.Fatalf("event = %+v", msg)
+	}
+}
+
+func TestLiveInvalidMessages(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	client := api.openLive(alice, time.Now().Add(time.Hour))
+
+	for _, channel := range []string{"", "everything", "user:nope", "chirp:", "user:" + uuid.NewString() + ":x"} {
+		client.send(liveRequest{Type: "subscribe", Channel: channel})
+		if msg := client.expect("error"); msg.Channel != channel {
+			t.Errorf("error for %q = %+v", channel, msg)
+		}
+	}
+
+	client.send(liveRequest{Type: "shout"})
+	client.expect("error")
+
+	client.conn.in <- []byte("not json")
+	client.expect("error")
+}
+
+func TestLiveHeartbeat(t *testing.T) {
+	interval := liveHeartbeat
+	t.Cleanup(func() { liveHeartbeat = interval })
+	liveHeartbeat = 20 * time.Millisecond
+
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	client := api.openLive(alice, time.Now().Add(time.Hour))
+
+	client.expect("heartbeat")
+	client.expect("heartbeat")
+}
+
+func TestLiveTokenExpiry(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	t.Run("expires", func(t *testing.T) {
+		client := api.openLive(alice, time.Now().Add(50*time.Millisecond))
+		client.expect("error")
+		select {
+		case code := <-client.conn.closed:
+			if code != liveCloseTokenExpired {
+				t.Fatalf("close code = %d", code)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("connection not closed")
+		}
+	})
+
+	t.Run("refreshed", func(t *testing.T) {
+		client := api.openLive(alice, time.Now().Add(200*time.Millisecond))
+
+		wrongUser, _ := auth.MakeJWT(uuid.MustParse(bob.ID), testAuthSecret, time.Hour)
+		client.send(liveRequest{Type: "auth", Token: wrongUser})
+		client.expect("error")
+
+		fresh, _ := auth.MakeJWT(uuid.MustParse(alice.ID), testAuthSecret, time.Hour)
+		client.send(liveRequest{Type: "auth", Token: fresh})
+		client.expect("authenticated")
+
+		time.Sleep(300 * time.Millisecond)
+		client.send(liveRequest{Type: "ping"})
+		client.expect("pong")
+	})
+}
+
+func TestLiveSuspended(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	tests := []struct {
+		action string
+		user   testUser
+	}{
+		{action: moderationSuspend, user: alice},
+		{action: moderationBan, user: bob},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			client := api.openLive(tt.user, time.Now().Add(time.Hour))
+			client.send(liveRequest{Type: "ping"})
+			client.expect("pong")
+
+			code, body := api.do("POST", "/admin/users/"+tt.user.ID+"/"+tt.action, admin.bearer(), map[string]any{"days": 1})
+			if code != http.StatusOK {
+				t.Fatalf("%s: status %d: %s", tt.action, code, body)
+			}
+			client.expect("error")
+			select {
+			case code := <-client.conn.closed:
+				if code != liveCloseSuspended {
+					t.Fatalf("close code = %d", code)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("connection not closed")
+			}
+		})
+	}
+}
+
+func TestLiveSocket(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	url := "ws" + strings.TrimPrefix(api.srv.URL, "http") + "/api/live"
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	_, resp, err := websocket.Dial(ctx, url, nil)
+	if err == nil || resp == nil || resp.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("dial without token: %v", err)
+	}
+
+	conn, _, err := websocket.Dial(ctx, url+"?access_token="+alice.Token, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseNow()
+
+	if err := conn.Write(ctx, websocket.MessageText, []byte(`{"type":"subscribe","channel":"timeline"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"subscribed", "event"} {
+		_, data, err := conn.Read(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var msg liveMessage
+		decode(t, data, &msg)
+		if msg.Type != want {
+			t.Fatalf("got %s, want %s", data, want)
+		}
+		if want == "subscribed" {
+			api.chirp(alice, "over the wire")
+		}
+	}
+
+	conn.Close(websocket.StatusNormalClosure, "")
+	if _, _, err := conn.Read(ctx); errors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("server did not close")
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// redactedKeys lists attribute keys whose values must never reach the logs.
+var redactedKeys = map[string]bool{
+	"password":         true,
+	"hashed_password":  true,
+	"token":            true,
+	"access_token":     true,
+	"refresh_token":    true,
+	"api_key":          true,
+	"apikey":           true,
+	"authorization":    true,
+	"secret":           true,
+	"polka_key":        true,
+	"secret_auth_key":  true,
+	"current_password": true,
+	// message and email bodies can carry tokens and private text
+	"body": true,
+}
+
+const redacted = "[REDACTED]"
+
+// newLogger builds the JSON logger used by the server. Sensitive attributes are
+// replaced before they are written, and the request ID, user ID and trace ID
+// of the request being served are attached to every record logged with its
+// context.
+func newLogger(w io.Writer, level slog.Leveler) *slog.Logger {
+	handler := slog.NewJSONHandler(w, &slog.HandlerOptions{
+		Level:       level,
+		ReplaceAttr: redactAttr,
+	})
+	return slog.New(contextHandler{handler})
+}
+
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if redactedKeys[strings.ToLower(a.Key)] {
+		return slog.String(a.Key, redacted)
+	}
+	return a
+}
+
+// parseLogLevel maps LOG_LEVEL values such as "debug" or "warn" to a level,
+// falling back to info.
+func parseLogLevel(s string) slog.Level {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(s)); err != nil {
+		return slog.LevelInfo
+	}
+	return level
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if info := requestInfoFrom(ctx); info != nil {
+		r.AddAttrs(slog.String("request_id", info.ID))
+		if info.UserID != uuid.Nil {
+			r.AddAttrs(slog.String("user_id", info.UserID.String()))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(
+			slog.String("trace_id", sc.TraceID().String()),
+			slog.String("span_id", sc.SpanID().String()),
+		)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h contextHandler) WithGroup(name string) slog.Handler {
+	return contextHandler{h.Handler.WithGroup(name)}
+}
+
+// logRequests assigns every request an ID, echoes it in the X-Request-ID
+// response header and writes one access log line once the request is served.
+// An X-Request-ID sent by the client or an upstream proxy is reused.
+func logRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+
+		req, info := withRequestInfo(req)
+		info.ID = req.Header.Get("X-Request-ID")
+		if !validRequestID(info.ID) {
+			info.ID = uuid.NewString()
+		}
+		w.Header().Set("X-Request-ID", info.ID)
+
+		ctx := req.Context()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, req)
+
+		level := slog.LevelInfo
+		if rec.Status() >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+		slog.LogAttrs(ctx, level, "request",
+			slog.String("method", req.Method),
+			slog.String("route", info.Route),
+			slog.String("path", req.URL.Path),
+			slog.Int("status", rec.Status()),
+			slog.Duration("duration", time.Since(start)),
+		)
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < 0x21 || c > 0x7e {
+			return false
+		}
+	}
+	return true
+}
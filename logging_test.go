@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+)
+
+func TestLoggerRedactsSecrets(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelDebug)
+
+	logger.Info("login",
+		"email", "user@example.com",
+		"password", "hunter2",
+		slog.Group("headers", "Authorization", "Bearer abc"),
+		"refresh_token", "deadbeef",
+		"body", "Use this token: deadbeef",
+	)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+
+	if record["email"] != "user@example.com" {
+		t.Errorf("email = %v, want it untouched", record["email"])
+	}
+	if record["password"] != redacted {
+		t.Errorf("password = %v, want %q", record["password"], redacted)
+	}
+	if record["refresh_token"] != redacted {
+		t.Errorf("refresh_token = %v, want %q", record["refresh_token"], redacted)
+	}
+	if record["body"] != redacted {
+		t.Errorf("body = %v, want %q", record["body"], redacted)
+	}
+	headers, _ := record["headers"].(map[string]any)
+	if headers["Authorization"] != redacted {
+		t.Errorf("headers.Authorization = %v, want %q", headers["Authorization"], redacted)
+	}
+}
+
+func TestLoggerAddsRequestInfo(t *testing.T) {
+	var buf bytes.Buffer
+	logger := newLogger(&buf, slog.LevelInfo)
+
+	userID := uuid.New()
+	ctx := context.WithValue(context.Background(), requestInfoKey{}, &requestInfo{ID: "req-1", UserID: userID})
+	logger.InfoContext(ctx, "hello")
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	if record["request_id"] != "req-1" {
+		t.Errorf("request_id = %v, want req-1", record["request_id"])
+	}
+	if record["user_id"] != userID.String() {
+		t.Errorf("user_id = %v, want %v", record["user_id"], userID)
+	}
+}
+
+func TestAccessLogHasTraceID(t *testing.T) {
+	api := newTestAPI(t)
+
+	var buf bytes.Buffer
+	defaultLogger, propagator := slog.Default(), otel.GetTextMapPropagator()
+	slog.SetDefault(newLogger(&buf, slog.LevelInfo))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		slog.SetDefault(defaultLogger)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest("GET", "/api/healthz", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	api.cfg.routes().ServeHTTP(httptest.NewRecorder(), req)
+
+	var record map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("invalid log line %q: %v", buf.String(), err)
+	}
+	if record["msg"] != "request" || record["route"] != "GET /api/healthz" {
+		t.Fatalf("log line = %v, want the access log", record)
+	}
+	if record["trace_id"] != traceID {
+		t.Errorf("trace_id = %v, want %s", record["trace_id"], traceID)
+	}
+}
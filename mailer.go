@@ -0,0 +1,95 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"time"
+)
+
+// mailer delivers transactional email such as address verification links.
+type mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+// newMailer returns the mailer configured in the environment: SMTP when
+// SMTP_ADDR is set, otherwise the log mailer, which is only allowed with
+// PLATFORM=dev.
+func newMailer() (mailer, error) {
+	addr := os.Getenv("SMTP_ADDR")
+	if addr == "" {
+		if os.Getenv("PLATFORM") != "dev" {
+			return nil, errors.New("SMTP_ADDR must be set outside of PLATFORM=dev")
+		}
+		return logMailer{}, nil
+	}
+
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("SMTP_ADDR: %w", err)
+	}
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		return nil, errors.New("MAIL_FROM must be set with SMTP_ADDR")
+	}
+	m := smtpMailer{addr: addr, from: from}
+	if username := os.Getenv("SMTP_USERNAME"); username != "" {
+		m.auth = smtp.PlainAuth("", username, os.Getenv("SMTP_PASSWORD"), host)
+	}
+	return m, nil
+}
+
+// smtpMailer sends plain text email through an SMTP relay, upgrading to TLS
+// when the server offers STARTTLS.
+type smtpMailer struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+func (m smtpMailer) Send(ctx context.Context, to, subject, body string) error {
+	msg, err := formatEmail(m.from, to, subject, body, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.addr, m.auth, m.from, []string{to}, msg)
+}
+
+// formatEmail builds an RFC 5322 message. Header values containing line
+// breaks are rejected so they can't smuggle in extra headers.
+func formatEmail(from, to, subject, body string, date time.Time) ([]byte, error) {
+	for _, v := range []string{from, to, subject} {
+		if strings.ContainsAny(v, "\r\n") {
+			return nil, errors.New("email header contains a line break")
+		}
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", from)
+	fmt.Fprintf(&msg, "To: %s\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.ReplaceAll(body, "\n", "\r\n"))
+	return msg.Bytes(), nil
+}
+
+// logMailer logs outgoing email instead of sending it, so verification
+// tokens can be picked up from the log during local development. newMailer
+// only uses it with PLATFORM=dev; the content is logged under its own key
+// because "body" is redacted.
+type logMailer struct{}
+
+func (logMailer) Send(ctx context.Context, to, subject, body string) error {
+	slog.InfoContext(ctx, "email", "to", to, "subject", subject, "content", body)
+	return nil
+}
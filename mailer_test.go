@@ -0,0 +1,59 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFormatEmail(t *testing.T) {
+	date := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	msg, err := formatEmail("chirpy@example.com", "a@example.com", "Confirm your email", "line one\nline two", date)
+	if err != nil {
+		t.Fatalf("formatEmail() error = %v", err)
+	}
+	for _, want := range []string{
+		"From: chirpy@example.com\r\n",
+		"To: a@example.com\r\n",
+		"Subject: Confirm your email\r\n",
+		"Date: Fri, 02 Jan 2026 03:04:05 +0000\r\n",
+		"\r\n\r\nline one\r\nline two",
+	} {
+		if !strings.Contains(string(msg), want) {
+			t.Errorf("message %q is missing %q", msg, want)
+		}
+	}
+
+	if _, err := formatEmail("chirpy@example.com", "a@example.com\r\nBcc: b@example.com", "hi", "", date); err == nil {
+		t.Error("formatEmail() accepted a recipient with a line break")
+	}
+}
+
+func TestNewMailer(t *testing.T) {
+	tests := []struct {
+		name     string
+		env      map[string]string
+		wantErr  bool
+		wantSMTP bool
+	}{
+		{name: "dev without SMTP", env: map[string]string{"PLATFORM": "dev"}},
+		{name: "production without SMTP", env: map[string]string{"PLATFORM": "prod"}, wantErr: true},
+		{name: "SMTP without sender", env: map[string]string{"SMTP_ADDR": "smtp.example.com:587"}, wantErr: true},
+		{name: "SMTP without port", env: map[string]string{"SMTP_ADDR": "smtp.example.com", "MAIL_FROM": "chirpy@example.com"}, wantErr: true},
+		{name: "SMTP", env: map[string]string{"SMTP_ADDR": "smtp.example.com:587", "MAIL_FROM": "chirpy@example.com", "SMTP_USERNAME": "chirpy"}, wantSMTP: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, key := range []string{"PLATFORM", "SMTP_ADDR", "MAIL_FROM", "SMTP_USERNAME", "SMTP_PASSWORD"} {
+				t.Setenv(key, tt.env[key])
+			}
+			m, err := newMailer()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("newMailer() error = %v, want error %v", err, tt.wantErr)
+			}
+			if _, ok := m.(smtpMailer); ok != tt.wantSMTP {
+				t.Errorf("newMailer() = %T", m)
+			}
+		})
+	}
+}
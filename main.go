@@ -1,12 +1,23 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"log"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
 
-	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/blob"
+	"github.com/chirpy/internal/preview"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/chirpy/internal/ratelimit"
+	"github.com/chirpy/internal/sealed"
+	"github.com/chirpy/internal/store"
 	"github.com/joho/godotenv"
 	_ "github.com/lib/pq"
 )
@@ -14,25 +25,147 @@ import (
 func main() {
 	godotenv.Load()
 
-	mux := http.NewServeMux()
+	slog.SetDefault(newLogger(os.Stdout, parseLogLevel(os.Getenv("LOG_LEVEL"))))
+
+	shutdownTracing, err := setupTracing(context.Background())
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer shutdownTracing(context.Background())
+
 	cfg := &apiConfig{}
 	cfg.authSecret = os.Getenv("SECRET_AUTH_KEY")
 	cfg.polkaSecret = os.Getenv("POLKA_KEY")
+	cfg.rateLimiter = ratelimit.NewMemoryStore()
+	if os.Getenv("TRUST_PROXY") == "true" {
+		cfg.trustedProxies = intEnv("TRUSTED_PROXY_HOPS", 1)
+	}
+	cfg.mailer, err = newMailer()
+	if err != nil {
+		log.Fatal(err)
+	}
+	cfg.hub = pubsub.NewHub(streamHistorySize, streamBufferSize)
+	cfg.fetcher = preview.NewClient()
+	cfg.previewWake = make(chan struct{}, 1)
+	cfg.publicURL = os.Getenv("PUBLIC_URL")
+	if cfg.publicURL == "" {
+		cfg.publicURL = "http://localhost:8080"
+	}
+	cfg.chirpRestoreWindow = durationEnv("CHIRP_RESTORE_WINDOW", 30*24*time.Hour)
+	cfg.accountDeletionGrace = durationEnv("ACCOUNT_DELETION_GRACE", 0)
+	cfg.auditRetention = durationEnv("AUDIT_RETENTION", 365*24*time.Hour)
+	cfg.chirpLimits = chirpLimits{
+		Default:   intEnv("CHIRP_MAX_LENGTH", defaultChirpLimits.Default),
+		ChirpyRed: intEnv("CHIRP_MAX_LENGTH_RED", defaultChirpLimits.ChirpyRed),
+	}
 	dbURL := os.Getenv("DB_URL")
 
+	messageKey, err := sealed.ParseKey(os.Getenv("MESSAGE_ENCRYPTION_KEY"))
+	if err != nil {
+		log.Fatalf("MESSAGE_ENCRYPTION_KEY: %v", err)
+	}
+	cfg.messageBox, err = sealed.NewBox(messageKey)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	mediaDir := os.Getenv("MEDIA_DIR")
+	if mediaDir == "" {
+		mediaDir = "media"
+	}
+	cfg.blobs, err = blob.NewFS(mediaDir)
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	db, err := sql.Open("postgres", dbURL)
 	if err != nil {
 		log.Fatal(err)
 	}
+	defer db.Close()
+
+	pingCtx, cancelPing := context.WithTimeout(context.Background(), healthCheckTimeout)
+	if err := db.PingContext(pingCtx); err != nil {
+		slog.Warn("database is unreachable", "error", err)
+	}
+	cancelPing()
 
-	cfg.db = database.New(db)
+	cfg.db = store.NewPostgres(db)
+	cfg.metrics = newMetrics(db)
+	cfg.readinessChecks = []healthCheck{
+		databaseCheck(db),
+		migrationsCheck(db),
+	}
+
+	server := http.Server{}
+	server.Addr = ":8080"
+	server.Handler = cfg.routes()
+	// end event streams so Shutdown doesn't wait on them
+	server.RegisterOnShutdown(cfg.hub.Close)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go runPeriodically(ctx, "purge-deleted-chirps", time.Hour, cfg.purgeDeletedChirps)
+	go runPeriodically(ctx, "purge-scheduled-accounts", time.Hour, cfg.purgeScheduledAccounts)
+	go runPeriodically(ctx, "purge-audit-events", time.Hour, cfg.purgeAuditEvents)
+	go runPeriodically(ctx, "publish-scheduled-chirps", 15*time.Second, cfg.publishScheduledChirps)
+	go runPeriodicallyOrOnWake(ctx, "fetch-link-previews", 30*time.Second, cfg.previewWake, cfg.fetchLinkPreviews)
+
+	go func() {
+		slog.Info("starting server", "addr", server.Addr)
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("server stopped", "error", err)
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	stop()
+
+	// Fail readiness first and give the load balancer time to notice before
+	// we stop accepting connections.
+	cfg.shuttingDown.Store(true)
+	drainDelay := durationEnv("SHUTDOWN_DRAIN_DELAY", 0)
+	slog.Info("shutting down", "drain_delay", drainDelay)
+	time.Sleep(drainDelay)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		slog.Error("shutdown", "error", err)
+	}
+}
+
+// durationEnv parses the environment variable key as a time.Duration,
+// returning fallback when it is unset or invalid.
+func durationEnv(key string, fallback time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return fallback
+	}
+	return d
+}
+
+// intEnv parses the environment variable key as a positive integer,
+// returning fallback when it is unset or invalid.
+func intEnv(key string, fallback int) int {
+	n, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
+
+// routes registers every endpoint on a ServeMux and wraps it in the
+// middlewares shared by all requests.
+func (cfg *apiConfig) routes() http.Handler {
+	mux := http.NewServeMux()
 
 	mux.Handle(
 		"/app/",
 		http.StripPrefix("/app/",
-			cfg.middlewareMetricsInc(
-				http.FileServer(http.Dir(".")),
-			),
+			http.FileServer(http.Dir(".")),
 		),
 	)
 
@@ -41,25 +174,75 @@ func main() {
 		w.WriteHeader(http.StatusOK)
 		w.Write([]byte("OK"))
 	})
+	mux.HandleFunc("GET /livez", cfg.livez)
+	mux.HandleFunc("GET /api/config/limits", cfg.getLimits)
+	mux.HandleFunc("GET /readyz", cfg.readyz)
 
-	mux.HandleFunc("GET /admin/metrics", cfg.getNumRequests)
+	mux.Handle("GET /metrics", cfg.metrics.handler())
 	mux.HandleFunc("POST /admin/reset", cfg.resetUsers)
+	mux.HandleFunc("POST /admin/chirps/{chirpID}/restore", cfg.restoreChirp)
+	mux.HandleFunc("POST /admin/users/{userID}/suspend", cfg.sanctionUser(moderationSuspend))
+	mux.HandleFunc("POST /admin/users/{userID}/unsuspend", cfg.sanctionUser(moderationUnsuspend))
+	mux.HandleFunc("POST /admin/users/{userID}/ban", cfg.sanctionUser(moderationBan))
+	mux.HandleFunc("GET /admin/audit", cfg.listAuditEvents)
+	mux.HandleFunc("GET /admin/reports", cfg.listReports)
+	mux.HandleFunc("GET /admin/reports/{reportID}", cfg.getReport)
+	mux.HandleFunc("POST /admin/reports/{reportID}/claim", cfg.claimReport)
+	mux.HandleFunc("POST /admin/reports/{reportID}/resolve", cfg.resolveReport)
 
-	mux.HandleFunc("POST /api/users", cfg.createUser)
-	mux.HandleFunc("PUT /api/users", cfg.updateUser)
-	mux.HandleFunc("POST /api/login", cfg.loginUser)
+	mux.Handle("POST /api/users", cfg.rateLimit(createUserLimit, cfg.createUser))
+	// PUT /api/users predates PATCH /api/users/me and now behaves the same.
+	// That breaks older clients changing a password or email: they don't
+	// send current_password, so they get 403 until they're updated.
+	mux.HandleFunc("PUT /api/users", cfg.patchUser)
+	mux.HandleFunc("PATCH /api/users/me", cfg.patchUser)
+	mux.HandleFunc("POST /api/users/verify-email", cfg.verifyEmail)
+	mux.HandleFunc("DELETE /api/users/me", cfg.deleteAccount)
+	mux.HandleFunc("GET /api/users/me/export", cfg.exportAccount)
+	mux.HandleFunc("GET /api/users/{userID}", cfg.getUserProfile)
+	mux.HandleFunc("GET /api/users/by-handle/{handle}", cfg.getUserProfileByHandle)
+	mux.HandleFunc("POST /api/users/{userID}/block", cfg.changeRelation(blockUser))
+	mux.HandleFunc("DELETE /api/users/{userID}/block", cfg.changeRelation(unblockUser))
+	mux.HandleFunc("POST /api/users/{userID}/mute", cfg.changeRelation(muteUser))
+	mux.HandleFunc("DELETE /api/users/{userID}/mute", cfg.changeRelation(unmuteUser))
+	mux.Handle("POST /api/login", cfg.rateLimit(loginLimit, cfg.loginUser))
 	mux.HandleFunc("POST /api/refresh", cfg.refreshAccessToken)
 	mux.HandleFunc("POST /api/revoke", cfg.revokeAccessToken)
 
 	mux.HandleFunc("GET /api/chirps", cfg.getChirps)
 	mux.HandleFunc("DELETE /api/chirps/{chirpID}", cfg.deleteChirp)
-	mux.HandleFunc("POST /api/chirps", cfg.createChirp)
+	mux.Handle("POST /api/chirps", cfg.rateLimit(createChirpLimit, cfg.createChirp))
 	mux.HandleFunc("GET /api/chirps/{chirpID}", cfg.getChirp)
+	mux.HandleFunc("GET /api/chirps/scheduled", cfg.listScheduledChirps)
+	mux.HandleFunc("PATCH /api/chirps/scheduled/{chirpID}", cfg.rescheduleChirp)
+	mux.HandleFunc("DELETE /api/chirps/scheduled/{chirpID}", cfg.cancelScheduledChirp)
+	mux.HandleFunc("POST /api/chirps/{chirpID}/report", cfg.reportChirp)
+	mux.HandleFunc("POST /api/drafts", cfg.createDraft)
+	mux.HandleFunc("GET /api/drafts", cfg.listDrafts)
+	mux.HandleFunc("GET /api/drafts/{draftID}", cfg.getDraft)
+	mux.HandleFunc("PUT /api/drafts/{draftID}", cfg.updateDraft)
+	mux.HandleFunc("DELETE /api/drafts/{draftID}", cfg.deleteDraft)
+	mux.Handle("POST /api/drafts/{draftID}/publish", cfg.rateLimit(createChirpLimit, cfg.publishDraft))
+	mux.HandleFunc("GET /api/stream", cfg.streamChirps)
+	mux.HandleFunc("GET /api/live", cfg.liveSocket)
+	mux.HandleFunc("GET /api/notifications", cfg.getNotifications)
+	mux.HandleFunc("POST /api/notifications/read", cfg.markNotificationsRead)
+	mux.HandleFunc("GET /api/notifications/preferences", cfg.notificationPreferences)
+	mux.HandleFunc("PUT /api/notifications/preferences", cfg.notificationPreferences)
+	mux.HandleFunc("PUT /api/users/me/privacy", cfg.setPrivacy)
+	mux.HandleFunc("POST /api/conversations", cfg.startConversation)
+	mux.HandleFunc("GET /api/conversations", cfg.getConversations)
+	mux.HandleFunc("GET /api/conversations/{conversationID}/messages", cfg.getMessages)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/messages", cfg.sendMessage)
+	mux.HandleFunc("POST /api/conversations/{conversationID}/read", cfg.markConversationRead)
+
+	mux.HandleFunc("GET /l/{code}", cfg.followLink)
+
+	mux.Handle("POST /api/media", cfg.rateLimit(uploadMediaLimit, cfg.uploadMedia))
+	mux.HandleFunc("GET /media/{mediaID}", cfg.serveMedia(false))
+	mux.HandleFunc("GET /media/{mediaID}/thumbnail", cfg.serveMedia(true))
 
 	mux.HandleFunc("POST /api/polka/webhooks", cfg.upgradeUser)
 
-	server := http.Server{}
-	server.Addr = ":8080"
-	server.Handler = mux
-	server.ListenAndServe()
+	return traceRequests(logRequests(cfg.metrics.middleware(recordRoute(mux))))
 }
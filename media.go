@@ -0,0 +1,286 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/chirpy/internal/blob"
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/media"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	maxUploadBytes = 10 << 20
+	maxChirpMedia  = 4
+)
+
+// errMediaUnavailable is returned from the createChirp transaction when a
+// media ID doesn't exist, belongs to someone else or is already attached.
+var errMediaUnavailable = errors.New("media unavailable")
+
+// chirpMedia is how an image is described in chirp responses.
+type chirpMedia struct {
+	ID           string `json:"id"`
+	URL          string `json:"url"`
+	ThumbnailURL string `json:"thumbnail_url"`
+	ContentType  string `json:"content_type"`
+	Width        int32  `json:"width"`
+	Height       int32  `json:"height"`
+}
+
+func newChirpMedia(md database.Medium) chirpMedia {
+	return chirpMedia{
+		ID:           md.ID.String(),
+		URL:          "/media/" + md.ID.String(),
+		ThumbnailURL: "/media/" + md.ID.String() + "/thumbnail",
+		ContentType:  md.ContentType,
+		Width:        md.Width,
+		Height:       md.Height,
+	}
+}
+
+// mediaByChirp returns the media attached to each of the chirps, in the
+// order they were given when the chirp was created.
+func (cfg *apiConfig) mediaByChirp(ctx context.Context, chirpIDs []uuid.UUID) (map[uuid.UUID][]chirpMedia, error) {
+	byChirp := map[uuid.UUID][]chirpMedia{}
+	if len(chirpIDs) == 0 {
+		return byChirp, nil
+	}
+
+	rows, err := cfg.db.ListMediaByChirps(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, md := range rows {
+		byChirp[md.ChirpID.UUID] = append(byChirp[md.ChirpID.UUID], newChirpMedia(md))
+	}
+	return byChirp, nil
+}
+
+// attachMedia links the uploads in mediaIDs to a new chirp. It must run in
+// the same transaction that creates the chirp.
+func attachMedia(ctx context.Context, tx store.Store, chirp database.Chirp, mediaIDs []uuid.UUID) error {
+	for i, id := range mediaIDs {
+		n, err := tx.AttachMedia(ctx, database.AttachMediaParams{
+			ID:       id,
+			ChirpID:  uuid.NullUUID{UUID: chirp.ID, Valid: true},
+			Position: sql.NullInt32{Int32: int32(i), Valid: true},
+			UserID:   chirp.UserID,
+		})
+		if err != nil {
+			return err
+		}
+		if n == 0 {
+			return errMediaUnavailable
+		}
+	}
+	return nil
+}
+
+// uploadMedia accepts a single image in the "file" field of a multipart
+// form. The image is re-encoded without metadata and stored with a
+// thumbnail; its ID can then be passed to createChirp.
+func (cfg *apiConfig) uploadMedia(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+		chirpMedia
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	// leave room for the multipart framing around the file
+	req.Body = http.MaxBytesReader(w, req.Body, maxUploadBytes+1<<20)
+	file, _, err := req.FormFile("file")
+	if err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			errResponse, _ := json.Marshal(response{
+				Error: "File is too large",
+			})
+			w.WriteHeader(http.StatusRequestEntityTooLarge)
+			w.Write(errResponse)
+			return
+		}
+		errResponse, _ := json.Marshal(response{
+			Error: "Missing file",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, maxUploadBytes+1))
+	if err != nil || len(data) > maxUploadBytes {
+		errResponse, _ := json.Marshal(response{
+			Error: "File is too large",
+		})
+		w.WriteHeader(http.StatusRequestEntityTooLarge)
+		w.Write(errResponse)
+		return
+	}
+
+	img, err := media.Process(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Unsupported image type",
+		})
+		w.WriteHeader(http.StatusUnsupportedMediaType)
+		w.Write(errResponse)
+		return
+	}
+	if errors.Is(err, media.ErrTooManyPixels) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Image is too large",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "process media", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	id := uuid.New()
+	err = cfg.blobs.Put(req.Context(), id.String(), bytes.NewReader(img.Data))
+	if err == nil {
+		err = cfg.blobs.Put(req.Context(), thumbnailKey(id), bytes.NewReader(img.Thumbnail))
+	}
+	var md database.Medium
+	if err == nil {
+		md, err = cfg.db.CreateMedia(req.Context(), database.CreateMediaParams{
+			ID:          id,
+			UserID:      userUUID,
+			ContentType: img.ContentType,
+			Width:       int32(img.Width),
+			Height:      int32(img.Height),
+			SizeBytes:   int64(len(img.Data)),
+		})
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "store media", "error", err)
+		cfg.blobs.Delete(req.Context(), id.String())
+		cfg.blobs.Delete(req.Context(), thumbnailKey(id))
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		chirpMedia: newChirpMedia(md),
+	})
+	w.WriteHeader(http.StatusCreated)
+	w.Write(successResponse)
+}
+
+// deleteMediaBlobs removes the files of media rows that have been deleted.
+// It runs after the rows are gone, so a failure leaves an unreachable file
+// behind rather than a row without one; failures are logged.
+func (cfg *apiConfig) deleteMediaBlobs(ctx context.Context, ids []uuid.UUID) {
+	for _, id := range ids {
+		for _, key := range []string{id.String(), thumbnailKey(id)} {
+			err := cfg.blobs.Delete(ctx, key)
+			if err != nil && !errors.Is(err, blob.ErrNotFound) {
+				slog.ErrorContext(ctx, "delete media blob", "key", key, "error", err)
+			}
+		}
+	}
+}
+
+// serveMedia returns a handler that streams an uploaded image, or its
+// thumbnail. Uploads never change, so clients may cache them, but only for
+// a day since the chirp they're attached to may be deleted.
+//
+// Media on a published chirp is public. Media that isn't attached yet, or
+// is attached to a scheduled chirp, is only served to its uploader, and
+// media on a deleted chirp isn't served at all.
+func (cfg *apiConfig) serveMedia(thumbnail bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		cfg.writeMedia(w, req, thumbnail)
+	}
+}
+
+func (cfg *apiConfig) writeMedia(w http.ResponseWriter, req *http.Request, thumbnail bool) {
+	mediaUUID, err := uuid.Parse(req.PathValue("mediaID"))
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	md, err := cfg.db.GetMedia(req.Context(), mediaUUID)
+	if err != nil {
+		http.NotFound(w, req)
+		return
+	}
+
+	public := false
+	if md.ChirpID.Valid {
+		chirp, err := cfg.db.GetChirp(req.Context(), md.ChirpID.UUID)
+		if err != nil || chirp.DeletedAt.Valid {
+			http.NotFound(w, req)
+			return
+		}
+		public = chirp.Status != chirpScheduled
+	}
+	if !public {
+		userUUID, err := cfg.authenticateUser(req)
+		if err != nil || userUUID != md.UserID {
+			http.NotFound(w, req)
+			return
+		}
+	}
+
+	key := md.ID.String()
+	if thumbnail {
+		key = thumbnailKey(md.ID)
+	}
+
+	r, err := cfg.blobs.Open(req.Context(), key)
+	if errors.Is(err, blob.ErrNotFound) {
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "open media", "error", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	defer r.Close()
+
+	w.Header().Set("Content-Type", md.ContentType)
+	if public {
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-store")
+	}
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(http.StatusOK)
+	io.Copy(w, r)
+}
+
+func thumbnailKey(id uuid.UUID) string {
+	return id.String() + "_thumb"
+}
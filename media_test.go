@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/blob"
+	"github.com/google/uuid"
+)
+
+// upload posts data as the "file" field of a multipart form.
+func (api *testAPI) upload(user testUser, data []byte) (int, []byte) {
+	api.t.Helper()
+
+	var body bytes.Buffer
+	form := multipart.NewWriter(&body)
+	part, err := form.CreateFormFile("file", "upload")
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	part.Write(data)
+	form.Close()
+
+	req, err := http.NewRequest("POST", api.srv.URL+"/api/media", &body)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if user.Token != "" {
+		req.Header.Set("Authorization", user.bearer())
+	}
+
+	resp, err := api.srv.Client().Do(req)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	respBody, _ := io.ReadAll(resp.Body)
+	return resp.StatusCode, respBody
+}
+
+// uploadImage uploads a w x h PNG and returns the media ID.
+func (api *testAPI) uploadImage(user testUser, w, h int) chirpMedia {
+	api.t.Helper()
+
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, w, h)))
+	code, body := api.upload(user, buf.Bytes())
+	if code != http.StatusCreated {
+		api.t.Fatalf("upload: status %d: %s", code, body)
+	}
+	var md chirpMedia
+	decode(api.t, body, &md)
+	return md
+}
+
+func TestUploadMedia(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	if code, _ := api.upload(testUser{}, []byte("x")); code != http.StatusUnauthorized {
+		t.Errorf("anonymous upload: status = %d, want 401", code)
+	}
+	if code, _ := api.upload(user, []byte("<html>not an image</html>")); code != http.StatusUnsupportedMediaType {
+		t.Errorf("html upload: status = %d, want 415", code)
+	}
+	if code, _ := api.upload(user, make([]byte, maxUploadBytes+1)); code != http.StatusRequestEntityTooLarge {
+		t.Errorf("oversized upload: status = %d, want 413", code)
+	}
+	var huge bytes.Buffer
+	png.Encode(&huge, image.NewGray(image.Rect(0, 0, 10000, 5000)))
+	if code, _ := api.upload(user, huge.Bytes()); code != http.StatusBadRequest {
+		t.Errorf("upload over the pixel limit: status = %d, want 400", code)
+	}
+
+	md := api.uploadImage(user, 800, 400)
+	if md.Width != 800 || md.Height != 400 || md.ContentType != "image/png" {
+		t.Errorf("media = %+v", md)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantWidth int
+	}{
+		{name: "Original", path: md.URL, wantWidth: 800},
+		{name: "Thumbnail", path: md.ThumbnailURL, wantWidth: 320},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := api.do("GET", tt.path, "", nil); code != http.StatusNotFound {
+				t.Errorf("anonymous before attaching: status = %d, want 404", code)
+			}
+			code, body := api.do("GET", tt.path, user.bearer(), nil)
+			if code != http.StatusOK {
+				t.Fatalf("status = %d, want 200", code)
+			}
+			cfg, err := png.DecodeConfig(bytes.NewReader(body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if cfg.Width != tt.wantWidth {
+				t.Errorf("width = %d, want %d", cfg.Width, tt.wantWidth)
+			}
+		})
+	}
+
+	if code, _ := api.do("GET", "/media/not-a-uuid", "", nil); code != http.StatusNotFound {
+		t.Errorf("invalid media ID: status = %d, want 404", code)
+	}
+}
+
+func TestChirpWithMedia(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	other := api.signUp("b@example.com")
+
+	var mine []string
+	for range maxChirpMedia + 1 {
+		mine = append(mine, api.uploadImage(user, 10, 10).ID)
+	}
+	theirs := api.uploadImage(other, 10, 10).ID
+
+	tests := []struct {
+		name     string
+		mediaIDs []string
+		wantCode int
+	}{
+		{name: "Too many", mediaIDs: mine, wantCode: http.StatusBadRequest},
+		{name: "Invalid ID", mediaIDs: []string{"nope"}, wantCode: http.StatusBadRequest},
+		{name: "Duplicate ID", mediaIDs: []string{mine[0], mine[0]}, wantCode: http.StatusBadRequest},
+		{name: "Someone else's media", mediaIDs: []string{mine[0], theirs}, wantCode: http.StatusBadRequest},
+		{name: "Valid", mediaIDs: []string{mine[1], mine[0]}, wantCode: http.StatusCreated},
+		{name: "Already attached", mediaIDs: []string{mine[0]}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("POST", "/api/chirps", user.bearer(), map[string]any{"body": "look", "media_ids": tt.mediaIDs})
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	var chirps []struct {
+		ID    string       `json:"id"`
+		Media []chirpMedia `json:"media"`
+	}
+	_, body := api.do("GET", "/api/chirps", "", nil)
+	decode(t, body, &chirps)
+	if len(chirps) != 1 {
+		t.Fatalf("got %d chirps, want 1 (failed attachments must roll back): %s", len(chirps), body)
+	}
+	if len(chirps[0].Media) != 2 || chirps[0].Media[0].ID != mine[1] || chirps[0].Media[1].ID != mine[0] {
+		t.Errorf("media = %+v, want %s then %s", chirps[0].Media, mine[1], mine[0])
+	}
+
+	var chirp struct {
+		Media []chirpMedia `json:"media"`
+	}
+	_, body = api.do("GET", "/api/chirps/"+chirps[0].ID, "", nil)
+	decode(t, body, &chirp)
+	if len(chirp.Media) != 2 {
+		t.Errorf("single chirp media = %+v, want 2 items", chirp.Media)
+	}
+}
+
+// blobExists reports whether the file of the media with id is still stored.
+func (api *testAPI) blobExists(id string) bool {
+	api.t.Helper()
+
+	r, err := api.cfg.blobs.Open(context.Background(), id)
+	if errors.Is(err, blob.ErrNotFound) {
+		return false
+	}
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	r.Close()
+	return true
+}
+
+func TestServeMedia(t *testing.T) {
+	api := newTestAPI(t)
+	api.cfg.chirpRestoreWindow = 0
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	published := api.uploadImage(alice, 10, 10)
+	scheduled := api.uploadImage(alice, 10, 10)
+	unattached := api.uploadImage(alice, 10, 10)
+
+	code, body := api.do("POST", "/api/chirps", alice.bearer(), map[string]any{"body": "now", "media_ids": []string{published.ID}})
+	var chirp testChirp
+	decode(t, body, &chirp)
+	if code != http.StatusCreated {
+		t.Fatalf("create chirp: status %d: %s", code, body)
+	}
+	publishAt := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	code, body = api.do("POST", "/api/chirps", alice.bearer(), map[string]any{"body": "later", "media_ids": []string{scheduled.ID}, "publish_at": publishAt})
+	var later chirpItem
+	decode(t, body, &later)
+	if code != http.StatusCreated {
+		t.Fatalf("schedule chirp: status %d: %s", code, body)
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		want          int
+	}{
+		{name: "published", path: published.URL, want: http.StatusOK},
+		{name: "published thumbnail", path: published.ThumbnailURL, authorization: bob.bearer(), want: http.StatusOK},
+		{name: "scheduled", path: scheduled.URL, authorization: bob.bearer(), want: http.StatusNotFound},
+		{name: "scheduled by the author", path: scheduled.URL, authorization: alice.bearer(), want: http.StatusOK},
+		{name: "unattached", path: unattached.URL, authorization: bob.bearer(), want: http.StatusNotFound},
+		{name: "unattached by the uploader", path: unattached.ThumbnailURL, authorization: alice.bearer(), want: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := api.do("GET", tt.path, tt.authorization, nil); code != tt.want {
+				t.Errorf("status = %d, want %d", code, tt.want)
+			}
+		})
+	}
+
+	if code, body := api.do("DELETE", "/api/chirps/"+chirp.ID, alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("delete chirp: status %d: %s", code, body)
+	}
+	if code, _ := api.do("GET", published.URL, alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("media of a deleted chirp: status = %d, want 404", code)
+	}
+
+	if err := api.cfg.purgeDeletedChirps(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if api.blobExists(published.ID) || api.blobExists(thumbnailKey(uuid.MustParse(published.ID))) {
+		t.Error("media files kept after purging the chirp")
+	}
+
+	if code, body := api.do("DELETE", "/api/chirps/scheduled/"+later.ID, alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("cancel scheduled chirp: status %d: %s", code, body)
+	}
+	if api.blobExists(scheduled.ID) {
+		t.Error("media file kept after cancelling the scheduled chirp")
+	}
+	if !api.blobExists(unattached.ID) {
+		t.Error("unrelated media file deleted")
+	}
+}
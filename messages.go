@@ -0,0 +1,605 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	maxMessageLength   = 2000
+	defaultMessagePage = 50
+	maxMessagePage     = 100
+
+	// dmPrivacyEveryone lets anyone start a conversation with the user;
+	// dmPrivacyNobody only allows conversations that already exist.
+	dmPrivacyEveryone = "everyone"
+	dmPrivacyNobody   = "nobody"
+
+	eventMessageCreated = "message.created"
+	eventMessagesRead   = "message.read"
+)
+
+var (
+	errMessageEmpty   = errors.New("Message must not be empty")
+	errMessageTooLong = errors.New("Message is too long")
+	errDMNotAllowed   = errors.New("This user doesn't accept direct messages")
+)
+
+// conversationPair orders two user IDs the way conversations store them.
+func conversationPair(a, b uuid.UUID) (uuid.UUID, uuid.UUID) {
+	if bytes.Compare(a[:], b[:]) > 0 {
+		return b, a
+	}
+	return a, b
+}
+
+// otherMember returns the member of c who isn't userID.
+func otherMember(c database.Conversation, userID uuid.UUID) uuid.UUID {
+	if c.UserA == userID {
+		return c.UserB
+	}
+	return c.UserA
+}
+
+// canMessage reports errDMNotAllowed if sender may not message recipient,
+// either in a new conversation or, with existing set, in one they share.
+// A block in either direction closes existing conversations too.
+func canMessage(ctx context.Context, tx store.Store, sender uuid.UUID, recipient database.User, existing bool) error {
+	if !existing && recipient.DmPrivacy == dmPrivacyNobody {
+		return errDMNotAllowed
+	}
+	blocked, err := tx.IsBlocked(ctx, database.IsBlockedParams{BlockerID: recipient.ID, BlockedID: sender})
+	if err != nil {
+		return err
+	}
+	if blocked {
+		return errDMNotAllowed
+	}
+	return nil
+}
+
+// prepareMessageBody normalizes and censors a message like a chirp, with a
+// longer limit and no link shortening.
+func prepareMessageBody(body string) (string, error) {
+	body = norm.NFC.String(body)
+	if strings.TrimSpace(body) == "" {
+		return "", errMessageEmpty
+	}
+	if utf8.RuneCountInString(body) > maxMessageLength {
+		return "", errMessageTooLong
+	}
+	return censorProfanity(body), nil
+}
+
+// messageAssociatedData binds a sealed body to the row it was written for.
+func messageAssociatedData(id, conversationID, senderID uuid.UUID) []byte {
+	data := make([]byte, 0, 48)
+	data = append(data, id[:]...)
+	data = append(data, conversationID[:]...)
+	return append(data, senderID[:]...)
+}
+
+// messageItem is how a message is described to the members of its
+// conversation. ReadAt is set once the recipient has read it.
+type messageItem struct {
+	ID             string `json:"id"`
+	ConversationID string `json:"conversation_id"`
+	SenderID       string `json:"sender_id"`
+	Body           string `json:"body"`
+	CreatedAt      string `json:"created_at"`
+	ReadAt         string `json:"read_at,omitempty"`
+}
+
+func (cfg *apiConfig) newMessageItem(msg database.Message) (messageItem, error) {
+	body, err := cfg.messageBox.Open(msg.Body, messageAssociatedData(msg.ID, msg.ConversationID, msg.SenderID))
+	if err != nil {
+		return messageItem{}, err
+	}
+	item := messageItem{
+		ID:             msg.ID.String(),
+		ConversationID: msg.ConversationID.String(),
+		SenderID:       msg.SenderID.String(),
+		Body:           string(body),
+		CreatedAt:      msg.CreatedAt.String(),
+	}
+	if msg.ReadAt.Valid {
+		item.ReadAt = msg.ReadAt.Time.String()
+	}
+	return item, nil
+}
+
+// conversationItem is how a conversation is described to one of its
+// members.
+type conversationItem struct {
+	ID          string       `json:"id"`
+	OtherUserID string       `json:"other_user_id"`
+	LastMessage *messageItem `json:"last_message,omitempty"`
+	UnreadCount int64        `json:"unread_count"`
+	CreatedAt   string       `json:"created_at"`
+	UpdatedAt   string       `json:"updated_at"`
+}
+
+func (cfg *apiConfig) newConversationItem(ctx context.Context, c database.Conversation, userID uuid.UUID) (conversationItem, error) {
+	item := conversationItem{
+		ID:          c.ID.String(),
+		OtherUserID: otherMember(c, userID).String(),
+		CreatedAt:   c.CreatedAt.String(),
+		UpdatedAt:   c.UpdatedAt.String(),
+	}
+
+	latest, err := cfg.db.GetLatestMessage(ctx, c.ID)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return conversationItem{}, err
+	}
+	if err == nil {
+		last, err := cfg.newMessageItem(latest)
+		if err != nil {
+			return conversationItem{}, err
+		}
+		item.LastMessage = &last
+	}
+
+	item.UnreadCount, err = cfg.db.CountUnreadMessages(ctx, database.CountUnreadMessagesParams{
+		ConversationID: c.ID,
+		SenderID:       userID,
+	})
+	if err != nil {
+		return conversationItem{}, err
+	}
+	return item, nil
+}
+
+// memberConversation returns the conversation in the path if userID is one
+// of its members, and sql.ErrNoRows otherwise.
+func (cfg *apiConfig) memberConversation(req *http.Request, userID uuid.UUID) (database.Conversation, error) {
+	id, err := uuid.Parse(req.PathValue("conversationID"))
+	if err != nil {
+		return database.Conversation{}, sql.ErrNoRows
+	}
+	c, err := cfg.db.GetConversation(req.Context(), id)
+	if err != nil {
+		return database.Conversation{}, err
+	}
+	if c.UserA != userID && c.UserB != userID {
+		return database.Conversation{}, sql.ErrNoRows
+	}
+	return c, nil
+}
+
+// startConversation returns the caller's conversation with user_id,
+// creating it if the other user accepts new conversations.
+func (cfg *apiConfig) startConversation(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		UserID string `json:"user_id"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		conversationItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	recipientUUID, err := uuid.Parse(data.UserID)
+	if err != nil || recipientUUID == userUUID {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid user ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	recipient, err := cfg.db.GetUserByID(req.Context(), recipientUUID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "User not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	userA, userB := conversationPair(userUUID, recipientUUID)
+	status := http.StatusOK
+	var conversation database.Conversation
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		var err error
+		conversation, err = tx.GetConversationByUsers(req.Context(), database.GetConversationByUsersParams{UserA: userA, UserB: userB})
+		if !errors.Is(err, sql.ErrNoRows) {
+			status = http.StatusOK
+			return err
+		}
+		err = canMessage(req.Context(), tx, userUUID, recipient, false)
+		if err != nil {
+			return err
+		}
+		status = http.StatusCreated
+		conversation, err = tx.CreateConversation(req.Context(), database.CreateConversationParams{UserA: userA, UserB: userB})
+		return err
+	})
+	if errors.Is(err, errDMNotAllowed) {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(errResponse)
+		return
+	}
+
+	var item conversationItem
+	if err == nil {
+		item, err = cfg.newConversationItem(req.Context(), conversation, userUUID)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "start conversation", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		conversationItem: item,
+	})
+	w.WriteHeader(status)
+	w.Write(successResponse)
+}
+
+// getConversations lists the caller's conversations, most recently active
+// first, with their last message and unread count.
+func (cfg *apiConfig) getConversations(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conversations, err := cfg.db.ListConversationsByUser(req.Context(), userUUID)
+	items := []conversationItem{}
+	for _, c := range conversations {
+		if err != nil {
+			break
+		}
+		var item conversationItem
+		item, err = cfg.newConversationItem(req.Context(), c, userUUID)
+		items = append(items, item)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list conversations", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(items)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// getMessages lists a conversation's messages, newest first, in pages like
+// getNotifications.
+func (cfg *apiConfig) getMessages(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error      string        `json:"error,omitempty"`
+		Messages   []messageItem `json:"messages"`
+		NextCursor string        `json:"next_cursor,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conversation, err := cfg.memberConversation(req, userUUID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Conversation not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	page, err := parsePage(req, defaultMessagePage, maxMessagePage)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	messages, err := cfg.db.ListMessages(req.Context(), database.ListMessagesParams{
+		ConversationID:  conversation.ID,
+		BeforeCreatedAt: page.beforeAt,
+		BeforeID:        page.beforeID,
+		PageSize:        page.size + 1,
+	})
+	resp := response{Messages: []messageItem{}}
+	if len(messages) > int(page.size) {
+		messages = messages[:page.size]
+		last := messages[len(messages)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, msg := range messages {
+		if err != nil {
+			break
+		}
+		var item messageItem
+		item, err = cfg.newMessageItem(msg)
+		resp.Messages = append(resp.Messages, item)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list messages", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// sendMessage adds a message to a conversation. Its body is filtered like a
+// chirp and stored encrypted. Both members' live notifications channels
+// receive it.
+func (cfg *apiConfig) sendMessage(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Body string `json:"body"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		messageItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conversation, err := cfg.memberConversation(req, userUUID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Conversation not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	body, err := prepareMessageBody(data.Body)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	recipientUUID := otherMember(conversation, userUUID)
+	id := uuid.New()
+	sealed := cfg.messageBox.Seal([]byte(body), messageAssociatedData(id, conversation.ID, userUUID))
+	var msg database.Message
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		recipient, err := tx.GetUserByID(req.Context(), recipientUUID)
+		if err != nil {
+			return err
+		}
+		err = canMessage(req.Context(), tx, userUUID, recipient, true)
+		if err != nil {
+			return err
+		}
+		msg, err = tx.CreateMessage(req.Context(), database.CreateMessageParams{
+			ID:             id,
+			ConversationID: conversation.ID,
+			SenderID:       userUUID,
+			Body:           sealed,
+		})
+		return err
+	})
+	if errors.Is(err, errDMNotAllowed) {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusForbidden)
+		w.Write(errResponse)
+		return
+	}
+
+	var item messageItem
+	if err == nil {
+		item, err = cfg.newMessageItem(msg)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "send message", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	cfg.publishConversationEvent(eventMessageCreated, conversation, item)
+
+	successResponse, _ := json.Marshal(response{
+		messageItem: item,
+	})
+	w.WriteHeader(http.StatusCreated)
+	w.Write(successResponse)
+}
+
+// markConversationRead marks every message the caller has received in a
+// conversation as read. The sender sees this as read_at on their messages
+// and as a live event.
+func (cfg *apiConfig) markConversationRead(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	conversation, err := cfg.memberConversation(req, userUUID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Conversation not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	n, err := cfg.db.MarkMessagesRead(req.Context(), database.MarkMessagesReadParams{
+		ConversationID: conversation.ID,
+		SenderID:       userUUID,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "mark messages read", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	if n > 0 {
+		cfg.publishConversationEvent(eventMessagesRead, conversation, map[string]string{
+			"conversation_id": conversation.ID.String(),
+			"reader_id":       userUUID.String(),
+		})
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishConversationEvent sends payload to both members' live
+// notifications channel.
+func (cfg *apiConfig) publishConversationEvent(eventType string, c database.Conversation, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	cfg.hub.Publish(pubsub.Event{
+		Type:   eventType,
+		Topics: []string{notificationsTopic(c.UserA), notificationsTopic(c.UserB)},
+		Data:   data,
+	})
+}
+
+// setPrivacy changes who may start a direct conversation with the caller.
+func (cfg *apiConfig) setPrivacy(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		DMPrivacy string `json:"dm_privacy"`
+	}
+	type response struct {
+		Error     string `json:"error,omitempty"`
+		DMPrivacy string `json:"dm_privacy,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil || (data.DMPrivacy != dmPrivacyEveryone && data.DMPrivacy != dmPrivacyNobody) {
+		errResponse, _ := json.Marshal(response{
+			Error: `dm_privacy must be "everyone" or "nobody"`,
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	user, err := cfg.db.SetDMPrivacy(req.Context(), database.SetDMPrivacyParams{
+		ID:        userUUID,
+		DmPrivacy: data.DMPrivacy,
+	})
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		DMPrivacy: user.DmPrivacy,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
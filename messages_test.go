@@ -0,0 +1,202 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+func (api *testAPI) startConversation(from, to testUser) (int, conversationItem) {
+	api.t.Helper()
+
+	code, body := api.do("POST", "/api/conversations", from.bearer(), map[string]string{"user_id": to.ID})
+	var c conversationItem
+	if code == http.StatusOK || code == http.StatusCreated {
+		decode(api.t, body, &c)
+	}
+	return code, c
+}
+
+func (api *testAPI) sendMessage(from testUser, conversationID, body string) (int, messageItem) {
+	api.t.Helper()
+
+	code, resp := api.do("POST", "/api/conversations/"+conversationID+"/messages", from.bearer(), map[string]string{"body": body})
+	var msg messageItem
+	if code == http.StatusCreated {
+		decode(api.t, resp, &msg)
+	}
+	return code, msg
+}
+
+func (api *testAPI) messages(user testUser, conversationID string) []messageItem {
+	api.t.Helper()
+
+	code, body := api.do("GET", "/api/conversations/"+conversationID+"/messages", user.bearer(), nil)
+	if code != http.StatusOK {
+		api.t.Fatalf("list messages: status %d: %s", code, body)
+	}
+	var page struct {
+		Messages []messageItem `json:"messages"`
+	}
+	decode(api.t, body, &page)
+	return page.Messages
+}
+
+func TestStartConversation(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	code, first := api.startConversation(alice, bob)
+	if code != http.StatusCreated || first.OtherUserID != bob.ID {
+		t.Fatalf("start conversation: status %d, %+v", code, first)
+	}
+	code, again := api.startConversation(bob, alice)
+	if code != http.StatusOK || again.ID != first.ID || again.OtherUserID != alice.ID {
+		t.Errorf("start existing conversation: status %d, %+v", code, again)
+	}
+
+	if code, _ := api.startConversation(alice, alice); code != http.StatusBadRequest {
+		t.Errorf("conversation with yourself: status %d", code)
+	}
+	if code, _ := api.startConversation(alice, testUser{ID: uuid.NewString()}); code != http.StatusNotFound {
+		t.Errorf("conversation with nobody: status %d", code)
+	}
+	if code, _ := api.do("POST", "/api/conversations", "", map[string]string{"user_id": bob.ID}); code != http.StatusUnauthorized {
+		t.Errorf("anonymous: status %d", code)
+	}
+}
+
+func TestSendMessage(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	eve := api.signUp("eve@example.com")
+	_, c := api.startConversation(alice, bob)
+
+	code, msg := api.sendMessage(alice, c.ID, "what the kerfuffle")
+	if code != http.StatusCreated || msg.Body != "what the ****" || msg.SenderID != alice.ID {
+		t.Fatalf("send: status %d, %+v", code, msg)
+	}
+	api.sendMessage(bob, c.ID, "hi alice")
+
+	got := api.messages(bob, c.ID)
+	if len(got) != 2 || got[0].Body != "hi alice" || got[1].ID != msg.ID {
+		t.Errorf("messages = %+v", got)
+	}
+
+	// bodies are encrypted at rest
+	stored, _ := api.store.ListMessages(context.Background(), database.ListMessagesParams{
+		ConversationID: uuid.MustParse(c.ID),
+		PageSize:       10,
+	})
+	for _, m := range stored {
+		if bytes.Contains(m.Body, []byte("alice")) || bytes.Contains(m.Body, []byte("what")) {
+			t.Errorf("stored body is plaintext: %q", m.Body)
+		}
+	}
+
+	for _, body := range []string{"", "   ", strings.Repeat("x", maxMessageLength+1)} {
+		if code, _ := api.sendMessage(alice, c.ID, body); code != http.StatusBadRequest {
+			t.Errorf("send %d chars: status %d", len(body), code)
+		}
+	}
+
+	// only members can see or write to a conversation
+	if code, _ := api.sendMessage(eve, c.ID, "let me in"); code != http.StatusNotFound {
+		t.Errorf("outsider send: status %d", code)
+	}
+	if code, _ := api.do("GET", "/api/conversations/"+c.ID+"/messages", eve.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("outsider list: status %d", code)
+	}
+}
+
+func TestReadReceipts(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	_, c := api.startConversation(alice, bob)
+	api.sendMessage(alice, c.ID, "one")
+	api.sendMessage(alice, c.ID, "two")
+
+	code, body := api.do("GET", "/api/conversations", bob.bearer(), nil)
+	var list []conversationItem
+	decode(t, body, &list)
+	if code != http.StatusOK || len(list) != 1 || list[0].UnreadCount != 2 || list[0].LastMessage == nil || list[0].LastMessage.Body != "two" {
+		t.Fatalf("conversations: status %d: %s", code, body)
+	}
+
+	client := api.openLive(alice, time.Now().Add(time.Hour))
+	client.send(liveRequest{Type: "subscribe", Channel: "notifications"})
+	client.expect("subscribed")
+
+	if code, body := api.do("POST", "/api/conversations/"+c.ID+"/read", bob.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("mark read: status %d: %s", code, body)
+	}
+	if msg := client.expect("event"); msg.Event != eventMessagesRead {
+		t.Errorf("event = %+v", msg)
+	}
+
+	for _, m := range api.messages(alice, c.ID) {
+		if m.ReadAt == "" {
+			t.Errorf("message %q not marked read", m.Body)
+		}
+	}
+	code, body = api.do("GET", "/api/conversations", bob.bearer(), nil)
+	decode(t, body, &list)
+	if list[0].UnreadCount != 0 {
+		t.Errorf("unread after reading = %d", list[0].UnreadCount)
+	}
+}
+
+func TestMessagePrivacy(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	carol := api.signUp("carol@example.com")
+	_, existing := api.startConversation(alice, bob)
+
+	code, body := api.do("PUT", "/api/users/me/privacy", bob.bearer(), map[string]string{"dm_privacy": dmPrivacyNobody})
+	if code != http.StatusOK {
+		t.Fatalf("set privacy: status %d: %s", code, body)
+	}
+	if code, _ := api.do("PUT", "/api/users/me/privacy", bob.bearer(), map[string]string{"dm_privacy": "friends"}); code != http.StatusBadRequest {
+		t.Errorf("invalid privacy: status %d", code)
+	}
+
+	if code, _ := api.startConversation(carol, bob); code != http.StatusForbidden {
+		t.Errorf("new conversation with private user: status %d", code)
+	}
+	if code, _ := api.sendMessage(alice, existing.ID, "still here"); code != http.StatusCreated {
+		t.Errorf("message in existing conversation: status %d", code)
+	}
+	// the setting only limits who can start conversations with bob
+	if code, _ := api.startConversation(bob, carol); code != http.StatusCreated {
+		t.Errorf("private user starting a conversation: status %d", code)
+	}
+}
+
+func TestMessagesLive(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	_, c := api.startConversation(alice, bob)
+
+	client := api.openLive(bob, time.Now().Add(time.Hour))
+	client.send(liveRequest{Type: "subscribe", Channel: "notifications"})
+	client.expect("subscribed")
+
+	api.sendMessage(alice, c.ID, "psst")
+	msg := client.expect("event")
+	var item messageItem
+	decode(t, msg.Data, &item)
+	if msg.Event != eventMessageCreated || item.Body != "psst" || item.ConversationID != c.ID {
+		t.Errorf("event = %+v, data %s", msg, msg.Data)
+	}
+}
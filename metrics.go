@@ -0,0 +1,103 @@
+package main
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds every Prometheus collector exposed on GET /metrics.
+type metrics struct {
+	registry *prometheus.Registry
+
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+
+	chirpsCreated     prometheus.Counter
+	logins            prometheus.Counter
+	failedLogins      prometheus.Counter
+	webhooksProcessed prometheus.Counter
+}
+
+func newMetrics(db *sql.DB) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: "chirpy",
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests by method, route and status code.",
+		}, []string{"method", "route", "code"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: "chirpy",
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		chirpsCreated: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "chirpy",
+			Name:      "chirps_created_total",
+			Help:      "Number of chirps created.",
+		}),
+		logins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "chirpy",
+			Name:      "logins_total",
+			Help:      "Number of successful logins.",
+		}),
+		failedLogins: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "chirpy",
+			Name:      "failed_logins_total",
+			Help:      "Number of logins rejected for a wrong email or password.",
+		}),
+		webhooksProcessed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: "chirpy",
+			Name:      "webhooks_processed_total",
+			Help:      "Number of authenticated Polka webhooks processed.",
+		}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.requests,
+		m.requestDuration,
+		m.chirpsCreated,
+		m.logins,
+		m.failedLogins,
+		m.webhooksProcessed,
+	)
+	if db != nil {
+		m.registry.MustRegister(collectors.NewDBStatsCollector(db, "chirpy"))
+	}
+
+	return m
+}
+
+// handler serves the registry in the Prometheus text exposition format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+// middleware records a request count and latency observation for every
+// request that reaches next. Requests are labelled with the ServeMux pattern
+// that matched them rather than the raw path, so path values such as chirp
+// IDs don't blow up the label cardinality.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, req)
+
+		route := routeOf(req)
+		if route == "" {
+			route = "unmatched"
+		}
+		m.requests.WithLabelValues(req.Method, route, strconv.Itoa(rec.Status())).Inc()
+		m.requestDuration.WithLabelValues(req.Method, route).Observe(time.Since(start).Seconds())
+	})
+}
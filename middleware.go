@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// statusRecorder wraps a ResponseWriter to remember the status code written
+// by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if r.status == 0 {
+		r.status = status
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer, e.g. to
+// flush streamed responses.
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// Status returns the status code sent to the client, defaulting to 200 when
+// the handler never wrote anything.
+func (r *statusRecorder) Status() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// requestInfo carries per-request details shared between the middlewares and
+// the handlers. The outermost middleware that needs it stores it in the
+// request context with withRequestInfo.
+type requestInfo struct {
+	ID     string
+	Route  string
+	UserID uuid.UUID
+}
+
+type requestInfoKey struct{}
+
+func requestInfoFrom(ctx context.Context) *requestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*requestInfo)
+	return info
+}
+
+// withRequestInfo returns req with a requestInfo in its context, reusing the
+// one a middleware further out already added.
+func withRequestInfo(req *http.Request) (*http.Request, *requestInfo) {
+	if info := requestInfoFrom(req.Context()); info != nil {
+		return req, info
+	}
+	info := &requestInfo{}
+	return req.WithContext(context.WithValue(req.Context(), requestInfoKey{}, info)), info
+}
+
+// setRequestUserID records the authenticated user for the access log.
+func setRequestUserID(ctx context.Context, userID uuid.UUID) {
+	if info := requestInfoFrom(ctx); info != nil {
+		info.UserID = userID
+	}
+}
+
+// recordRoute wraps the ServeMux and copies the pattern it matched into the
+// request info, so middlewares that replaced the request further out can
+// still label by route.
+func recordRoute(mux http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		mux.ServeHTTP(w, req)
+
+		if info := requestInfoFrom(req.Context()); info != nil {
+			info.Route = req.Pattern
+		}
+	})
+}
+
+// routeOf returns the ServeMux pattern that handled req.
+func routeOf(req *http.Request) string {
+	if req.Pattern != "" {
+		return req.Pattern
+	}
+	if info := requestInfoFrom(req.Context()); info != nil {
+		return info.Route
+	}
+	return ""
+}
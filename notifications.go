@@ -0,0 +1,487 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	notificationMention = "mention"
+	notificationReply   = "reply"
+	notificationLike    = "like"
+	notificationFollow  = "follow"
+
+	// Moderation outcomes come from the moderators rather than another
+	// user, so they have no actor and can't be turned off.
+	notificationWarning         = "warning"
+	notificationReportActioned  = "report_actioned"
+	notificationReportDismissed = "report_dismissed"
+
+	eventNotification = "notification"
+
+	defaultNotificationPage = 20
+	maxNotificationPage     = 100
+	// maxMentions bounds how many people one chirp can notify.
+	maxMentions = 10
+	// notificationActorsShown is how many of the most recent actors a
+	// coalesced notification lists.
+	notificationActorsShown = 3
+)
+
+// notificationTypes are the types users can turn off, in the order the
+// preferences are listed.
+var notificationTypes = []string{notificationMention, notificationReply, notificationLike, notificationFollow}
+
+var mentionPattern = regexp.MustCompile(`@([A-Za-z0-9_]+)`)
+
+// notification is something that happened to Recipient because of Actor,
+// which is uuid.Nil for moderation outcomes. ChirpID is the chirp it
+// concerns, or uuid.Nil for follows.
+type notification struct {
+	Type      string
+	Recipient uuid.UUID
+	Actor     uuid.UUID
+	ChirpID   uuid.UUID
+}
+
+// notify records n unless the recipient caused it, has turned its type off,
+// has muted the actor or is blocked either way, returning whether it did.
+// Activity on the same chirp (or, for follows, any activity of the type) is
+// folded into the recipient's unread notification for it, so a burst of
+// likes reads "5 people liked your chirp" rather than five separate items.
+//
+// Handlers call notify inside the transaction that makes the change, then
+// pass what it returns to publishNotifications once that has committed.
+func notify(ctx context.Context, tx store.Store, n notification) (database.Notification, bool, error) {
+	if n.Recipient == n.Actor {
+		return database.Notification{}, false, nil
+	}
+
+	blocked, err := tx.IsBlocked(ctx, database.IsBlockedParams{BlockerID: n.Recipient, BlockedID: n.Actor})
+	if err != nil {
+		return database.Notification{}, false, err
+	}
+	muted, err := tx.IsMuted(ctx, database.IsMutedParams{MuterID: n.Recipient, MutedID: n.Actor})
+	if err != nil {
+		return database.Notification{}, false, err
+	}
+	if blocked || muted {
+		return database.Notification{}, false, nil
+	}
+
+	prefs, err := tx.ListNotificationPreferences(ctx, n.Recipient)
+	if err != nil {
+		return database.Notification{}, false, err
+	}
+	for _, pref := range prefs {
+		if pref.Type == n.Type && !pref.Enabled {
+			return database.Notification{}, false, nil
+		}
+	}
+
+	params := database.CreateNotificationParams{
+		UserID:  n.Recipient,
+		Type:    n.Type,
+		ActorID: n.Actor,
+	}
+	if n.ChirpID != uuid.Nil {
+		params.GroupKey = n.ChirpID.String()
+		params.ChirpID = uuid.NullUUID{UUID: n.ChirpID, Valid: true}
+	}
+	created, err := tx.CreateNotification(ctx, params)
+	if err != nil {
+		return database.Notification{}, false, err
+	}
+	return created, true, nil
+}
+
+// findMentions returns the distinct handles mentioned in body, up to
+// maxMentions. An @ inside a word or address, as in an email, is not a
+// mention.
+func findMentions(body string) []string {
+	var handles []string
+	for _, m := range mentionPattern.FindAllStringSubmatchIndex(body, -1) {
+		if m[0] > 0 && inWord(body[m[0]-1]) {
+			continue
+		}
+		handle := body[m[2]:m[3]]
+		if !handlePattern.MatchString(handle) || slices.ContainsFunc(handles, func(h string) bool { return strings.EqualFold(h, handle) }) {
+			continue
+		}
+		handles = append(handles, handle)
+		if len(handles) == maxMentions {
+			break
+		}
+	}
+	return handles
+}
+
+// inWord reports whether an @ after b is part of a word, address or URL.
+func inWord(b byte) bool {
+	return b == '_' || b == '@' || b == '/' || b == '.' || b == ':' ||
+		'a' <= b && b <= 'z' || 'A' <= b && b <= 'Z' || '0' <= b && b <= '9'
+}
+
+// notifyMentions notifies everyone mentioned in a new chirp.
+func notifyMentions(ctx context.Context, tx store.Store, chirp database.Chirp, handles []string) ([]database.Notification, error) {
+	var created []database.Notification
+	for _, handle := range handles {
+		user, err := tx.GetUserByHandle(ctx, handle)
+		if errors.Is(err, sql.ErrNoRows) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		n, ok, err := notify(ctx, tx, notification{
+			Type:      notificationMention,
+			Recipient: user.ID,
+			Actor:     chirp.UserID,
+			ChirpID:   chirp.ID,
+		})
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			created = append(created, n)
+		}
+	}
+	return created, nil
+}
+
+// publishNotifications sends committed notifications to their recipients'
+// live notifications channel.
+func (cfg *apiConfig) publishNotifications(ctx context.Context, notes []database.Notification) {
+	names := map[uuid.UUID]string{}
+	for _, n := range notes {
+		data, err := json.Marshal(cfg.newNotificationItem(ctx, n, names))
+		if err != nil {
+			continue
+		}
+		cfg.hub.Publish(pubsub.Event{
+			Type:   eventNotification,
+			Topics: []string{notificationsTopic(n.UserID)},
+			Data:   data,
+		})
+	}
+}
+
+// notificationItem is how a notification is described to its recipient.
+type notificationItem struct {
+	ID         string   `json:"id"`
+	Type       string   `json:"type"`
+	ChirpID    string   `json:"chirp_id,omitempty"`
+	ActorIDs   []string `json:"actor_ids"`
+	ActorCount int      `json:"actor_count"`
+	Message    string   `json:"message"`
+	Read       bool     `json:"read"`
+	CreatedAt  string   `json:"created_at"`
+	UpdatedAt  string   `json:"updated_at"`
+}
+
+// newNotificationItem describes n, naming its most recent actor. names
+// caches actor names across calls.
+func (cfg *apiConfig) newNotificationItem(ctx context.Context, n database.Notification, names map[uuid.UUID]string) notificationItem {
+	actors := slices.DeleteFunc(slices.Clone(n.ActorIds), func(id uuid.UUID) bool { return id == uuid.Nil })
+	item := notificationItem{
+		ID:         n.ID.String(),
+		Type:       n.Type,
+		ActorIDs:   []string{},
+		ActorCount: len(actors),
+		Read:       n.ReadAt.Valid,
+		CreatedAt:  n.CreatedAt.String(),
+		UpdatedAt:  n.UpdatedAt.String(),
+	}
+	if n.ChirpID.Valid {
+		item.ChirpID = n.ChirpID.UUID.String()
+	}
+	for i := len(actors) - 1; i >= 0 && len(item.ActorIDs) < notificationActorsShown; i-- {
+		item.ActorIDs = append(item.ActorIDs, actors[i].String())
+	}
+
+	who := "Someone"
+	if len(actors) > 1 {
+		who = strconv.Itoa(len(actors)) + " people"
+	} else if len(actors) == 1 {
+		who = cfg.actorName(ctx, actors[0], names)
+	}
+	switch n.Type {
+	case notificationMention:
+		item.Message = who + " mentioned you"
+	case notificationReply:
+		item.Message = who + " replied to your chirp"
+	case notificationLike:
+		item.Message = who + " liked your chirp"
+	case notificationFollow:
+		item.Message = who + " followed you"
+	case notificationWarning:
+		item.Message = "Your chirp was reported and found to break the rules"
+	case notificationReportActioned:
+		item.Message = "We took action on a chirp you reported"
+	case notificationReportDismissed:
+		item.Message = "We reviewed a chirp you reported and it doesn't break the rules"
+	}
+	return item
+}
+
+func (cfg *apiConfig) actorName(ctx context.Context, id uuid.UUID, names map[uuid.UUID]string) string {
+	if name, ok := names[id]; ok {
+		return name
+	}
+	name := "Someone"
+	user, err := cfg.db.GetUserByID(ctx, id)
+	if err == nil && user.Handle.Valid {
+		name = "@" + user.Handle.String
+	} else if err == nil && user.DisplayName != "" {
+		name = user.DisplayName
+	}
+	names[id] = name
+	return name
+}
+
+// getNotifications lists the caller's notifications, newest first, with
+// their unread count. Pass next_cursor back as cursor for the following
+// page; it is empty on the last one. Activity folded into a notification
+// updates it in place rather than moving it, so paging never skips or
+// repeats one.
+func (cfg *apiConfig) getNotifications(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error         string             `json:"error,omitempty"`
+		Notifications []notificationItem `json:"notifications"`
+		UnreadCount   int64              `json:"unread_count"`
+		NextCursor    string             `json:"next_cursor,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	page, err := parsePage(req, defaultNotificationPage, maxNotificationPage)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	// fetch one extra row to learn whether there is another page
+	params := database.ListNotificationsParams{
+		UserID:          userUUID,
+		BeforeCreatedAt: page.beforeAt,
+		BeforeID:        page.beforeID,
+		PageSize:        page.size + 1,
+	}
+	notes, err := cfg.db.ListNotifications(req.Context(), params)
+	if err == nil {
+		var unread int64
+		unread, err = cfg.db.CountUnreadNotifications(req.Context(), userUUID)
+		if err == nil {
+			resp := response{
+				Notifications: []notificationItem{},
+				UnreadCount:   unread,
+			}
+			if len(notes) > int(page.size) {
+				notes = notes[:page.size]
+				last := notes[len(notes)-1]
+				resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+			}
+			names := map[uuid.UUID]string{}
+			for _, n := range notes {
+				resp.Notifications = append(resp.Notifications, cfg.newNotificationItem(req.Context(), n, names))
+			}
+
+			successResponse, _ := json.Marshal(resp)
+			w.WriteHeader(http.StatusOK)
+			w.Write(successResponse)
+			return
+		}
+	}
+
+	slog.ErrorContext(req.Context(), "list notifications", "error", err)
+	errResponse, _ := json.Marshal(response{
+		Error: "Something went wrong",
+	})
+	w.WriteHeader(http.StatusInternalServerError)
+	w.Write(errResponse)
+}
+
+// markNotificationsRead marks the listed notifications, or with "all" every
+// notification, as read and returns the new unread count. IDs that aren't
+// the caller's are ignored.
+func (cfg *apiConfig) markNotificationsRead(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		IDs []string `json:"ids"`
+		All bool     `json:"all"`
+	}
+	type response struct {
+		Error       string `json:"error,omitempty"`
+		UnreadCount int64  `json:"unread_count"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil || (len(data.IDs) == 0 && !data.All) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Provide ids or all",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	ids := make([]uuid.UUID, 0, len(data.IDs))
+	for _, raw := range data.IDs {
+		id, err := uuid.Parse(raw)
+		if err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Invalid notification ID",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		ids = append(ids, id)
+	}
+
+	if data.All {
+		_, err = cfg.db.MarkAllNotificationsRead(req.Context(), userUUID)
+	} else {
+		_, err = cfg.db.MarkNotificationsRead(req.Context(), database.MarkNotificationsReadParams{
+			UserID: userUUID,
+			Ids:    ids,
+		})
+	}
+	var unread int64
+	if err == nil {
+		unread, err = cfg.db.CountUnreadNotifications(req.Context(), userUUID)
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "mark notifications read", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		UnreadCount: unread,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// notificationPreferences handles GET and PUT of the caller's preferences,
+// an object of notification type to whether it is on. Every type is on
+// until turned off; a PUT only changes the types it includes.
+func (cfg *apiConfig) notificationPreferences(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	if req.Method == http.MethodPut {
+		decoder := json.NewDecoder(req.Body)
+		changes := map[string]bool{}
+		err = decoder.Decode(&changes)
+		if err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		for typ := range changes {
+			if !slices.Contains(notificationTypes, typ) {
+				errResponse, _ := json.Marshal(response{
+					Error: "Unknown notification type " + strconv.Quote(typ),
+				})
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(errResponse)
+				return
+			}
+		}
+
+		err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+			for typ, enabled := range changes {
+				err := tx.SetNotificationPreference(req.Context(), database.SetNotificationPreferenceParams{
+					UserID:  userUUID,
+					Type:    typ,
+					Enabled: enabled,
+				})
+				if err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.ErrorContext(req.Context(), "set notification preferences", "error", err)
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+	}
+
+	prefs, err := cfg.db.ListNotificationPreferences(req.Context(), userUUID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list notification preferences", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	enabled := map[string]bool{}
+	for _, typ := range notificationTypes {
+		enabled[typ] = true
+	}
+	for _, pref := range prefs {
+		enabled[pref.Type] = pref.Enabled
+	}
+	successResponse, _ := json.Marshal(enabled)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+type testNotifications struct {
+	Notifications []notificationItem `json:"notifications"`
+	UnreadCount   int64              `json:"unread_count"`
+	NextCursor    string             `json:"next_cursor"`
+}
+
+func (api *testAPI) notifications(user testUser, query string) testNotifications {
+	api.t.Helper()
+
+	code, body := api.do("GET", "/api/notifications"+query, user.bearer(), nil)
+	if code != http.StatusOK {
+		api.t.Fatalf("list notifications: status %d: %s", code, body)
+	}
+	var page testNotifications
+	decode(api.t, body, &page)
+	return page
+}
+
+func (api *testAPI) setHandle(user testUser, handle string) {
+	api.t.Helper()
+
+	code, body := api.do("PATCH", "/api/users/me", user.bearer(), map[string]string{"handle": handle})
+	if code != http.StatusOK {
+		api.t.Fatalf("set handle: status %d: %s", code, body)
+	}
+}
+
+// notifyAll records n for each actor, as the handlers for interactions do.
+func (api *testAPI) notifyAll(n notification, actors ...testUser) {
+	api.t.Helper()
+
+	for _, actor := range actors {
+		n.Actor = uuid.MustParse(actor.ID)
+		err := api.store.InTx(context.Background(), func(tx store.Store) error {
+			_, _, err := notify(context.Background(), tx, n)
+			return err
+		})
+		if err != nil {
+			api.t.Fatal(err)
+		}
+	}
+}
+
+func TestFindMentions(t *testing.T) {
+	tests := []struct {
+		body string
+		want []string
+	}{
+		{body: "hi @alice and @bob_2", want: []string{"alice", "bob_2"}},
+		{body: "@alice @ALICE @alice", want: []string{"alice"}},
+		{body: "mail me@example.com", want: nil},
+		{body: "see https://example.com/@alice", want: nil},
+		{body: "@ab is too short", want: nil},
+		{body: "(@alice), @bob!", want: []string{"alice", "bob"}},
+	}
+	for _, tt := range tests {
+		if got := findMentions(tt.body); !slices.Equal(got, tt.want) {
+			t.Errorf("findMentions(%q) = %q, want %q", tt.body, got, tt.want)
+		}
+	}
+
+	var many string
+	for i := range maxMentions + 5 {
+		many += " @user" + string(rune('a'+i)) + "xx"
+	}
+	if got := findMentions(many); len(got) != maxMentions {
+		t.Errorf("found %d mentions, want %d", len(got), maxMentions)
+	}
+}
+
+func TestMentionNotifications(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(alice, "alice")
+	api.setHandle(bob, "bob")
+
+	chirp := api.chirp(bob, "hey @Alice, and me @bob, and @nobody")
+
+	page := api.notifications(alice, "")
+	if page.UnreadCount != 1 || len(page.Notifications) != 1 {
+		t.Fatalf("notifications = %+v", page)
+	}
+	n := page.Notifications[0]
+	if n.Type != notificationMention || n.ChirpID != chirp.ID || n.Message != "@bob mentioned you" || n.Read {
+		t.Errorf("notification = %+v", n)
+	}
+
+	// mentioning yourself doesn't notify
+	if page := api.notifications(bob, ""); len(page.Notifications) != 0 {
+		t.Errorf("bob has notifications: %+v", page)
+	}
+
+	if code, _ := api.do("GET", "/api/notifications", "", nil); code != http.StatusUnauthorized {
+		t.Errorf("anonymous list: status %d", code)
+	}
+}
+
+func TestNotificationCoalescing(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	chirp := api.chirp(alice, "like this")
+
+	var likers []testUser
+	for _, email := range []string{"a@example.com", "b@example.com", "c@example.com", "d@example.com", "e@example.com"} {
+		likers = append(likers, api.signUp(email))
+	}
+	like := notification{Type: notificationLike, Recipient: uuid.MustParse(alice.ID), ChirpID: uuid.MustParse(chirp.ID)}
+	api.notifyAll(like, likers...)
+	// the same person again doesn't count twice
+	api.notifyAll(like, likers[0])
+
+	page := api.notifications(alice, "")
+	if page.UnreadCount != 1 || len(page.Notifications) != 1 {
+		t.Fatalf("notifications = %+v", page)
+	}
+	n := page.Notifications[0]
+	if n.ActorCount != 5 || n.Message != "5 people liked your chirp" || len(n.ActorIDs) != notificationActorsShown || n.ActorIDs[0] != likers[4].ID {
+		t.Errorf("notification = %+v", n)
+	}
+
+	// once read, new activity starts a new notification
+	code, body := api.do("POST", "/api/notifications/read", alice.bearer(), map[string]any{"ids": []string{n.ID}})
+	if code != http.StatusOK {
+		t.Fatalf("mark read: status %d: %s", code, body)
+	}
+	api.notifyAll(like, api.signUp("f@example.com"))
+
+	page = api.notifications(alice, "")
+	if page.UnreadCount != 1 || len(page.Notifications) != 2 || page.Notifications[0].ActorCount != 1 || !page.Notifications[1].Read {
+		t.Errorf("notifications = %+v", page)
+	}
+}
+
+func TestNotificationPagination(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	var want []string
+	var replies []notification
+	for range 5 {
+		chirp := api.chirp(alice, "chirp")
+		reply := notification{Type: notificationReply, Recipient: uuid.MustParse(alice.ID), ChirpID: uuid.MustParse(chirp.ID)}
+		api.notifyAll(reply, bob)
+		replies = append(replies, reply)
+		time.Sleep(time.Millisecond)
+	}
+	for _, n := range api.notifications(alice, "?limit=100").Notifications {
+		want = append(want, n.ID)
+	}
+	if len(want) != 5 {
+		t.Fatalf("got %d notifications", len(want))
+	}
+
+	var got []string
+	cursor := ""
+	carol := api.signUp("carol@example.com")
+	for pages := 0; ; pages++ {
+		if pages > 3 {
+			t.Fatal("too many pages")
+		}
+		if pages == 1 {
+			// folding activity into the oldest notification mid-way
+			// through doesn't move it onto a page already read
+			api.notifyAll(replies[0], carol)
+		}
+		query := "?limit=2"
+		if cursor != "" {
+			query += "&cursor=" + cursor
+		}
+		page := api.notifications(alice, query)
+		if page.UnreadCount != 5 {
+			t.Errorf("unread = %d", page.UnreadCount)
+		}
+		for _, n := range page.Notifications {
+			got = append(got, n.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("paged %v, want %v", got, want)
+	}
+
+	for _, query := range []string{"?limit=0", "?limit=101", "?cursor=nope"} {
+		if code, _ := api.do("GET", "/api/notifications"+query, alice.bearer(), nil); code != http.StatusBadRequest {
+			t.Errorf("%s: status %d", query, code)
+		}
+	}
+}
+
+func TestMarkNotificationsRead(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.notifyAll(notification{Type: notificationFollow, Recipient: uuid.MustParse(alice.ID)}, bob)
+	chirp := api.chirp(alice, "chirp")
+	api.notifyAll(notification{Type: notificationLike, Recipient: uuid.MustParse(alice.ID), ChirpID: uuid.MustParse(chirp.ID)}, bob)
+
+	page := api.notifications(alice, "")
+	if page.UnreadCount != 2 {
+		t.Fatalf("unread = %d", page.UnreadCount)
+	}
+
+	// someone else can't mark them read
+	code, _ := api.do("POST", "/api/notifications/read", bob.bearer(), map[string]any{"ids": []string{page.Notifications[0].ID}})
+	if code != http.StatusOK || api.notifications(alice, "").UnreadCount != 2 {
+		t.Errorf("bob marked alice's notification read")
+	}
+
+	for _, body := range []any{map[string]any{}, map[string]any{"ids": []string{"nope"}}, "{"} {
+		if code, _ := api.do("POST", "/api/notifications/read", alice.bearer(), body); code != http.StatusBadRequest {
+			t.Errorf("mark read %v: status %d", body, code)
+		}
+	}
+
+	code, body := api.do("POST", "/api/notifications/read", alice.bearer(), map[string]any{"all": true})
+	var resp struct {
+		UnreadCount int64 `json:"unread_count"`
+	}
+	decode(t, body, &resp)
+	if code != http.StatusOK || resp.UnreadCount != 0 {
+		t.Errorf("mark all read: status %d: %s", code, body)
+	}
+}
+
+func TestNotificationPreferences(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(alice, "alice")
+
+	code, body := api.do("GET", "/api/notifications/preferences", alice.bearer(), nil)
+	var prefs map[string]bool
+	decode(t, body, &prefs)
+	if code != http.StatusOK || len(prefs) != len(notificationTypes) || !prefs[notificationMention] {
+		t.Fatalf("preferences: status %d: %s", code, body)
+	}
+
+	code, body = api.do("PUT", "/api/notifications/preferences", alice.bearer(), map[string]bool{notificationMention: false})
+	decode(t, body, &prefs)
+	if code != http.StatusOK || prefs[notificationMention] || !prefs[notificationLike] {
+		t.Fatalf("update preferences: status %d: %s", code, body)
+	}
+
+	api.chirp(bob, "hi @alice")
+	if page := api.notifications(alice, ""); len(page.Notifications) != 0 {
+		t.Errorf("muted mention notified: %+v", page)
+	}
+
+	if code, _ := api.do("PUT", "/api/notifications/preferences", alice.bearer(), map[string]bool{"carrier_pigeon": true}); code != http.StatusBadRequest {
+		t.Errorf("unknown type: status %d", code)
+	}
+}
+
+func TestNotificationsLive(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(alice, "alice")
+
+	client := api.openLive(alice, time.Now().Add(time.Hour))
+	client.send(liveRequest{Type: "subscribe", Channel: "notifications"})
+	client.expect("subscribed")
+
+	api.chirp(bob, "ping @alice")
+	msg := client.expect("event")
+	var n notificationItem
+	decode(t, msg.Data, &n)
+	if msg.Event != eventNotification || n.Type != notificationMention || n.ActorCount != 1 {
+		t.Errorf("event = %+v, data %s", msg, msg.Data)
+	}
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// page is a request for the rows after a cursor, from the limit and cursor
+// query parameters.
+type page struct {
+	size     int32
+	beforeAt sql.NullTime
+	beforeID uuid.UUID
+}
+
+// parsePage reads the limit and cursor parameters. The error is suitable
+// for the client.
+func parsePage(req *http.Request, defaultSize, maxSize int) (page, error) {
+	p := page{size: int32(defaultSize)}
+	if limit := req.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 || n > maxSize {
+			return page{}, fmt.Errorf("limit must be between 1 and %d", maxSize)
+		}
+		p.size = int32(n)
+	}
+	if cursor := req.URL.Query().Get("cursor"); cursor != "" {
+		at, id, err := decodeCursor(cursor)
+		if err != nil {
+			return page{}, errors.New("Invalid cursor")
+		}
+		p.beforeAt = sql.NullTime{Time: at, Valid: true}
+		p.beforeID = id
+	}
+	return p, nil
+}
+
+// encodeCursor and decodeCursor turn the (timestamp, id) position of the
+// last row on a page, newest first, into an opaque cursor for the next.
+func encodeCursor(at time.Time, id uuid.UUID) string {
+	raw := strconv.FormatInt(at.UnixNano(), 10) + ":" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(cursor string) (time.Time, uuid.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return time.Time{}, uuid.Nil, errors.New("malformed cursor")
+	}
+	n, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	parsed, err := uuid.Parse(id)
+	if err != nil {
+		return time.Time{}, uuid.Nil, err
+	}
+	return time.Unix(0, n).UTC(), parsed, nil
+}
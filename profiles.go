@@ -0,0 +1,176 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDisplayNameLength = 50
+	maxBioLength         = 160
+	maxAvatarURLLength   = 2048
+)
+
+var handlePattern = regexp.MustCompile(`^[A-Za-z0-9_]{3,30}$`)
+
+// validateProfile checks the public profile fields. An empty handle means
+// the user has none.
+func validateProfile(handle, displayName, bio, avatarURL string) error {
+	if handle != "" && !handlePattern.MatchString(handle) {
+		return errors.New("Handle must be 3 to 30 letters, digits or underscores")
+	}
+	if utf8.RuneCountInString(displayName) > maxDisplayNameLength {
+		return errors.New("Display name is too long")
+	}
+	if utf8.RuneCountInString(bio) > maxBioLength {
+		return errors.New("Bio is too long")
+	}
+	if avatarURL != "" {
+		u, err := url.Parse(avatarURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || len(avatarURL) > maxAvatarURLLength {
+			return errors.New("Avatar URL must be an absolute http or https URL")
+		}
+	}
+	return nil
+}
+
+// profileUpdate holds the optional profile fields of an update request.
+// Fields left out of the request are nil and keep their current value.
+type profileUpdate struct {
+	Handle      *string `json:"handle"`
+	DisplayName *string `json:"display_name"`
+	Bio         *string `json:"bio"`
+	AvatarURL   *string `json:"avatar_url"`
+}
+
+// apply merges the provided fields into params. An empty handle clears it.
+func (p profileUpdate) apply(params *database.UpdateUserParams) {
+	if p.Handle != nil {
+		params.Handle = sql.NullString{String: *p.Handle, Valid: *p.Handle != ""}
+	}
+	if p.DisplayName != nil {
+		params.DisplayName = *p.DisplayName
+	}
+	if p.Bio != nil {
+		params.Bio = *p.Bio
+	}
+	if p.AvatarURL != nil {
+		params.AvatarUrl = *p.AvatarURL
+	}
+}
+
+// updateUserParams returns UpdateUser parameters that leave user unchanged.
+func updateUserParams(user database.User) database.UpdateUserParams {
+	return database.UpdateUserParams{
+		ID:             user.ID,
+		Email:          user.Email,
+		HashedPassword: user.HashedPassword,
+		Handle:         user.Handle,
+		DisplayName:    user.DisplayName,
+		Bio:            user.Bio,
+		AvatarUrl:      user.AvatarUrl,
+	}
+}
+
+// handleTaken reports whether the handle in params belongs to another user.
+func (cfg *apiConfig) handleTaken(ctx context.Context, params database.UpdateUserParams) bool {
+	if !params.Handle.Valid {
+		return false
+	}
+	owner, err := cfg.db.GetUserByHandle(ctx, params.Handle.String)
+	return err == nil && owner.ID != params.ID
+}
+
+// userProfile is the public view of a user. Email is only filled in when the
+// user is looking at their own profile.
+type userProfile struct {
+	ID          string `json:"id"`
+	Handle      string `json:"handle,omitempty"`
+	DisplayName string `json:"display_name"`
+	Bio         string `json:"bio"`
+	AvatarURL   string `json:"avatar_url"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+	CreatedAt   string `json:"created_at"`
+	Email       string `json:"email,omitempty"`
+}
+
+func (cfg *apiConfig) getUserProfile(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := uuid.Parse(req.PathValue("userID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid user ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), userUUID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "User does not exist",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	cfg.writeUserProfile(w, req, user)
+}
+
+func (cfg *apiConfig) getUserProfileByHandle(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	user, err := cfg.db.GetUserByHandle(req.Context(), req.PathValue("handle"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "User does not exist",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	cfg.writeUserProfile(w, req, user)
+}
+
+func (cfg *apiConfig) writeUserProfile(w http.ResponseWriter, req *http.Request, user database.User) {
+	profile := userProfile{
+		ID:          user.ID.String(),
+		Handle:      user.Handle.String,
+		DisplayName: user.DisplayName,
+		Bio:         user.Bio,
+		AvatarURL:   user.AvatarUrl,
+		IsChirpyRed: user.IsChirpyRed,
+		CreatedAt:   user.CreatedAt.String(),
+	}
+
+	// the access token is optional here; it only decides whether the
+	// caller gets to see their own email
+	if viewerUUID, err := cfg.authenticateUser(req); err == nil && viewerUUID == user.ID {
+		profile.Email = user.Email
+	}
+
+	successResponse, _ := json.Marshal(profile)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
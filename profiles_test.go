@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestUpdateProfile(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	other := api.signUp("b@example.com")
+
+	code, body := api.do("PUT", "/api/users", other.bearer(), map[string]string{"handle": "Taken"})
+	if code != http.StatusOK {
+		t.Fatalf("set handle: status %d: %s", code, body)
+	}
+
+	tests := []struct {
+		name     string
+		body     any
+		wantCode int
+	}{
+		{name: "Handle too short", body: map[string]string{"handle": "ab"}, wantCode: http.StatusBadRequest},
+		{name: "Handle with invalid characters", body: map[string]string{"handle": "not-ok"}, wantCode: http.StatusBadRequest},
+		{name: "Handle taken", body: map[string]string{"handle": "taken"}, wantCode: http.StatusConflict},
+		{name: "Bio too long", body: map[string]string{"bio": strings.Repeat("é", maxBioLength+1)}, wantCode: http.StatusBadRequest},
+		{name: "Relative avatar URL", body: map[string]string{"avatar_url": "/me.png"}, wantCode: http.StatusBadRequest},
+		{name: "FTP avatar URL", body: map[string]string{"avatar_url": "ftp://example.com/me.png"}, wantCode: http.StatusBadRequest},
+		{name: "Valid profile", body: map[string]string{"handle": "alice", "display_name": "Alice", "bio": "héllo", "avatar_url": "https://example.com/a.png"}, wantCode: http.StatusOK},
+		{name: "Partial update", body: map[string]string{"bio": "still me"}, wantCode: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("PUT", "/api/users", user.bearer(), tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	updated, err := api.store.GetUserByID(context.Background(), uuid.MustParse(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Handle.String != "alice" || updated.DisplayName != "Alice" || updated.Bio != "still me" || updated.AvatarUrl != "https://example.com/a.png" {
+		t.Errorf("profile = %+v", updated)
+	}
+	if updated.Email != user.Email {
+		t.Errorf("email = %q, want unchanged %q", updated.Email, user.Email)
+	}
+	if err := auth.CheckPasswordHash(updated.HashedPassword, user.Password); err != nil {
+		t.Errorf("password changed by a profile-only update")
+	}
+
+	// an empty handle clears it
+	code, body = api.do("PUT", "/api/users", user.bearer(), map[string]string{"handle": ""})
+	if code != http.StatusOK {
+		t.Fatalf("clear handle: status %d: %s", code, body)
+	}
+	if code, _ := api.do("GET", "/api/users/by-handle/alice", "", nil); code != http.StatusNotFound {
+		t.Errorf("cleared handle: status = %d, want 404", code)
+	}
+}
+
+func TestGetUserProfile(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	other := api.signUp("b@example.com")
+
+	code, body := api.do("PUT", "/api/users", user.bearer(), map[string]string{"handle": "Alice", "display_name": "Alice"})
+	if code != http.StatusOK {
+		t.Fatalf("set handle: status %d: %s", code, body)
+	}
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		wantCode      int
+		wantEmail     string
+	}{
+		{name: "Anonymous", path: "/api/users/" + user.ID, wantCode: http.StatusOK},
+		{name: "Another user", path: "/api/users/" + user.ID, authorization: other.bearer(), wantCode: http.StatusOK},
+		{name: "Owner", path: "/api/users/" + user.ID, authorization: user.bearer(), wantCode: http.StatusOK, wantEmail: user.Email},
+		{name: "By handle", path: "/api/users/by-handle/Alice", wantCode: http.StatusOK},
+		{name: "By handle, case-insensitive", path: "/api/users/by-handle/aLiCe", wantCode: http.StatusOK},
+		{name: "Owner by handle", path: "/api/users/by-handle/alice", authorization: user.bearer(), wantCode: http.StatusOK, wantEmail: user.Email},
+		{name: "Invalid ID", path: "/api/users/not-a-uuid", wantCode: http.StatusBadRequest},
+		{name: "Unknown ID", path: "/api/users/" + uuid.NewString(), wantCode: http.StatusNotFound},
+		{name: "Unknown handle", path: "/api/users/by-handle/nobody", wantCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("GET", tt.path, tt.authorization, nil)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+			if code != http.StatusOK {
+				return
+			}
+
+			var profile userProfile
+			decode(t, body, &profile)
+			if profile.ID != user.ID || profile.Handle != "Alice" || profile.DisplayName != "Alice" {
+				t.Errorf("profile = %+v", profile)
+			}
+			if profile.Email != tt.wantEmail {
+				t.Errorf("email = %q, want %q", profile.Email, tt.wantEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/ratelimit"
+)
+
+var (
+	createChirpLimit = ratelimit.Policy{Name: "create-chirp", Limit: 30, Window: time.Minute}
+	loginLimit       = ratelimit.Policy{Name: "login", Limit: 10, Window: time.Minute}
+	createUserLimit  = ratelimit.Policy{Name: "create-user", Limit: 5, Window: time.Hour}
+	uploadMediaLimit = ratelimit.Policy{Name: "upload-media", Limit: 30, Window: time.Hour}
+)
+
+// rateLimit takes a token from the caller's bucket for policy before calling
+// next, answering 429 once the bucket is empty. Callers are identified by the
+// user in their access token, or by client IP when they don't send a valid
+// one. The limiter fails open if the store errors.
+func (cfg *apiConfig) rateLimit(policy ratelimit.Policy, next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if cfg.rateLimiter == nil {
+			next(w, req)
+			return
+		}
+
+		key := policy.Name + ":" + cfg.rateLimitKey(req)
+		result, err := cfg.rateLimiter.Take(req.Context(), key, policy)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "rate limiter", "policy", policy.Name, "error", err)
+			next(w, req)
+			return
+		}
+
+		w.Header().Set("RateLimit-Policy", strconv.Itoa(policy.Limit)+";w="+strconv.Itoa(int(policy.Window.Seconds())))
+		w.Header().Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+		w.Header().Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+		w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(result.Reset)))
+
+		if !result.Allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(ceilSeconds(result.RetryAfter)))
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"error":"Too many requests"}`))
+			return
+		}
+
+		next(w, req)
+	})
+}
+
+func (cfg *apiConfig) rateLimitKey(req *http.Request) string {
+	if bearerToken, err := auth.GetBearerToken(req.Header); err == nil {
+		if userUUID, err := auth.ValidateJWT(bearerToken, cfg.authSecret); err == nil {
+			return "user:" + userUUID.String()
+		}
+	}
+	return "ip:" + cfg.clientIP(req)
+}
+
+// clientIP returns the address of the client. X-Forwarded-For is only
+// honoured when the server is configured to run behind trusted proxies, and
+// then only the entry the outermost of them appended: each proxy adds the
+// address it received the request from on the right, and anything further
+// left was sent by the client, which can set it to anything.
+func (cfg *apiConfig) clientIP(req *http.Request) string {
+	if cfg.trustedProxies > 0 {
+		var hops []string
+		for _, header := range req.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+		if len(hops) > 0 {
+			return strings.TrimSpace(hops[max(len(hops)-cfg.trustedProxies, 0)])
+		}
+	}
+
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		return req.RemoteAddr
+	}
+	return host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/ratelimit"
+	"github.com/google/uuid"
+)
+
+func TestRateLimit(t *testing.T) {
+	cfg := &apiConfig{
+		authSecret:  "secret",
+		rateLimiter: ratelimit.NewMemoryStore(),
+	}
+	policy := ratelimit.Policy{Name: "test", Limit: 1, Window: time.Minute}
+	handler := cfg.rateLimit(policy, func(w http.ResponseWriter, req *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	token, _ := auth.MakeJWT(uuid.New(), "secret", time.Hour)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		token      string
+		wantCode   int
+	}{
+		{name: "First request from IP", remoteAddr: "10.0.0.1:1234", wantCode: http.StatusNoContent},
+		{name: "Second request from IP", remoteAddr: "10.0.0.1:4321", wantCode: http.StatusTooManyRequests},
+		{name: "Other IP", remoteAddr: "10.0.0.2:1234", wantCode: http.StatusNoContent},
+		{name: "Authenticated user on limited IP", remoteAddr: "10.0.0.1:1234", token: token, wantCode: http.StatusNoContent},
+		{name: "Authenticated user again", remoteAddr: "10.0.0.3:1234", token: token, wantCode: http.StatusTooManyRequests},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+			rec := httptest.NewRecorder()
+
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantCode {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantCode)
+			}
+			if rec.Header().Get("RateLimit-Limit") != "1" {
+				t.Errorf("RateLimit-Limit = %q, want 1", rec.Header().Get("RateLimit-Limit"))
+			}
+			if tt.wantCode == http.StatusTooManyRequests && rec.Header().Get("Retry-After") != "60" {
+				t.Errorf("Retry-After = %q, want 60", rec.Header().Get("Retry-After"))
+			}
+		})
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name           string
+		trustedProxies int
+		forwardedFor   []string
+		want           string
+	}{
+		{name: "No proxy", forwardedFor: []string{"1.1.1.1"}, want: "10.0.0.1"},
+		{name: "Proxy without header", trustedProxies: 1, want: "10.0.0.1"},
+		{name: "One proxy", trustedProxies: 1, forwardedFor: []string{"1.1.1.1"}, want: "1.1.1.1"},
+		{name: "Spoofed entry", trustedProxies: 1, forwardedFor: []string{"6.6.6.6, 1.1.1.1"}, want: "1.1.1.1"},
+		{name: "Spoofed header", trustedProxies: 1, forwardedFor: []string{"6.6.6.6", "1.1.1.1"}, want: "1.1.1.1"},
+		{name: "Two proxies", trustedProxies: 2, forwardedFor: []string{"6.6.6.6, 1.1.1.1, 10.0.0.9"}, want: "1.1.1.1"},
+		{name: "Fewer entries than proxies", trustedProxies: 2, forwardedFor: []string{"1.1.1.1"}, want: "1.1.1.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &apiConfig{trustedProxies: tt.trustedProxies}
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = "10.0.0.1:1234"
+			for _, v := range tt.forwardedFor {
+				req.Header.Add("X-Forwarded-For", v)
+			}
+			if got := cfg.clientIP(req); got != tt.want {
+				t.Errorf("clientIP() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
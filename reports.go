@@ -0,0 +1,648 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"slices"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+const (
+	// Report statuses, stored in reports.status.
+	reportOpen     = "open"
+	reportClaimed  = "claimed"
+	reportResolved = "resolved"
+
+	// Ways a moderator can resolve a report. Everything but a dismissal
+	// counts as action taken against the chirp's author.
+	resolutionDismiss = "dismiss"
+	resolutionHide    = "hide"
+	resolutionWarn    = "warn"
+	resolutionSuspend = "suspend"
+
+	// moderationClaim is logged when a moderator takes a report and
+	// moderationRestore when staff bring back a deleted chirp; the
+	// resolutions are logged under their own names.
+	moderationClaim   = "claim"
+	moderationRestore = "restore"
+
+	maxReportDetailsLength = 500
+	maxModerationNote      = 1000
+	defaultSuspensionDays  = 7
+	maxSuspensionDays      = 365
+	defaultReportPage      = 20
+	maxReportPage          = 100
+)
+
+// reportReasons are the categories a report must pick from.
+var reportReasons = []string{"spam", "harassment", "hate", "violence", "sexual_content", "misinformation", "other"}
+
+var resolutions = []string{resolutionDismiss, resolutionHide, resolutionWarn, resolutionSuspend}
+
+// reportItem is how a report is described to its reporter and to
+// moderators.
+type reportItem struct {
+	ID         string `json:"id"`
+	ChirpID    string `json:"chirp_id"`
+	ReporterID string `json:"reporter_id"`
+	Reason     string `json:"reason"`
+	Details    string `json:"details,omitempty"`
+	Status     string `json:"status"`
+	ClaimedBy  string `json:"claimed_by,omitempty"`
+	Resolution string `json:"resolution,omitempty"`
+	CreatedAt  string `json:"created_at"`
+	UpdatedAt  string `json:"updated_at"`
+	ResolvedAt string `json:"resolved_at,omitempty"`
+}
+
+func newReportItem(r database.Report) reportItem {
+	item := reportItem{
+		ID:         r.ID.String(),
+		ChirpID:    r.ChirpID.String(),
+		ReporterID: r.ReporterID.String(),
+		Reason:     r.Reason,
+		Details:    r.Details,
+		Status:     r.Status,
+		Resolution: r.Resolution.String,
+		CreatedAt:  r.CreatedAt.String(),
+		UpdatedAt:  r.UpdatedAt.String(),
+	}
+	if r.ClaimedBy.Valid {
+		item.ClaimedBy = r.ClaimedBy.UUID.String()
+	}
+	if r.ResolvedAt.Valid {
+		item.ResolvedAt = r.ResolvedAt.Time.String()
+	}
+	return item
+}
+
+// moderationActionItem is one entry of a report's moderation history.
+type moderationActionItem struct {
+	ID           string `json:"id"`
+	ModeratorID  string `json:"moderator_id"`
+	Action       string `json:"action"`
+	TargetUserID string `json:"target_user_id,omitempty"`
+	Note         string `json:"note,omitempty"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// logModeration appends an entry to the moderation log. The log is never
+// updated or deleted from, so it is written in the same transaction as the
+// action it records.
+func logModeration(ctx context.Context, tx store.Store, moderator uuid.UUID, action string, report database.Report, target uuid.UUID, note string) error {
+	params := database.CreateModerationActionParams{
+		ModeratorID: moderator,
+		Action:      action,
+		ReportID:    uuid.NullUUID{UUID: report.ID, Valid: true},
+		ChirpID:     uuid.NullUUID{UUID: report.ChirpID, Valid: true},
+		Note:        note,
+	}
+	if target != uuid.Nil {
+		params.TargetUserID = uuid.NullUUID{UUID: target, Valid: true}
+	}
+	_, err := tx.CreateModerationAction(ctx, params)
+	return err
+}
+
+// reportChirp files a report against someone else's chirp. Each user can
+// report a chirp once.
+func (cfg *apiConfig) reportChirp(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		reportItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil || !slices.Contains(reportReasons, data.Reason) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid report reason",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if utf8.RuneCountInString(data.Details) > maxReportDetailsLength {
+		errResponse, _ := json.Marshal(response{
+			Error: "Report details are too long",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid chirp ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), chirpUUID)
+	if err != nil || chirp.DeletedAt.Valid || chirp.Status == chirpScheduled {
+		errResponse, _ := json.Marshal(response{
+			Error: "Chirp does not exist",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	if chirp.UserID == userUUID {
+		errResponse, _ := json.Marshal(response{
+			Error: "You can't report your own chirp",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	report, err := cfg.db.CreateReport(req.Context(), database.CreateReportParams{
+		ChirpID:    chirp.ID,
+		ReporterID: userUUID,
+		Reason:     data.Reason,
+		Details:    data.Details,
+	})
+	if store.IsUniqueViolation(err) {
+		errResponse, _ := json.Marshal(response{
+			Error: "You already reported this chirp",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "create report", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		reportItem: newReportItem(report),
+	})
+	w.WriteHeader(http.StatusCreated)
+	w.Write(successResponse)
+}
+
+// listReports is the moderation queue: reports with the given status
+// (open by default), newest first.
+func (cfg *apiConfig) listReports(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error      string       `json:"error,omitempty"`
+		Reports    []reportItem `json:"reports"`
+		NextCursor string       `json:"next_cursor,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := cfg.authenticateStaff(req, roleModerator, roleAdmin)
+	if errors.Is(err, errForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	status := req.URL.Query().Get("status")
+	if status == "" {
+		status = reportOpen
+	}
+	if status != reportOpen && status != reportClaimed && status != reportResolved {
+		errResponse, _ := json.Marshal(response{
+			Error: `status must be "open", "claimed" or "resolved"`,
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	page, err := parsePage(req, defaultReportPage, maxReportPage)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	// fetch one extra row to learn whether there is another page
+	reports, err := cfg.db.ListReports(req.Context(), database.ListReportsParams{
+		Status:          status,
+		BeforeCreatedAt: page.beforeAt,
+		BeforeID:        page.beforeID,
+		PageSize:        page.size + 1,
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list reports", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	resp := response{Reports: []reportItem{}}
+	if len(reports) > int(page.size) {
+		reports = reports[:page.size]
+		last := reports[len(reports)-1]
+		resp.NextCursor = encodeCursor(last.CreatedAt, last.ID)
+	}
+	for _, r := range reports {
+		resp.Reports = append(resp.Reports, newReportItem(r))
+	}
+
+	successResponse, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// getReport shows a report with the reported chirp, even if it has since
+// been deleted, and the moderation history of the report.
+func (cfg *apiConfig) getReport(w http.ResponseWriter, req *http.Request) {
+	type reportedChirp struct {
+		ID        string `json:"id"`
+		Body      string `json:"body"`
+		UserID    string `json:"user_id"`
+		Deleted   bool   `json:"deleted"`
+		CreatedAt string `json:"created_at"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		reportItem
+		Chirp   *reportedChirp         `json:"chirp,omitempty"`
+		Actions []moderationActionItem `json:"actions,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	_, err := cfg.authenticateStaff(req, roleModerator, roleAdmin)
+	if errors.Is(err, errForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	reportUUID, err := uuid.Parse(req.PathValue("reportID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid report ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	report, err := cfg.db.GetReport(req.Context(), reportUUID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Report not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	chirp, err := cfg.db.GetChirp(req.Context(), report.ChirpID)
+	var actions []database.ModerationLog
+	if err == nil {
+		actions, err = cfg.db.ListModerationActionsByReport(req.Context(), uuid.NullUUID{UUID: report.ID, Valid: true})
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "get report", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	resp := response{
+		reportItem: newReportItem(report),
+		Chirp: &reportedChirp{
+			ID:        chirp.ID.String(),
+			Body:      chirp.Body,
+			UserID:    chirp.UserID.String(),
+			Deleted:   chirp.DeletedAt.Valid,
+			CreatedAt: chirp.CreatedAt.String(),
+		},
+		Actions: []moderationActionItem{},
+	}
+	for _, a := range actions {
+		item := moderationActionItem{
+			ID:          a.ID.String(),
+			ModeratorID: a.ModeratorID.String(),
+			Action:      a.Action,
+			Note:        a.Note,
+			CreatedAt:   a.CreatedAt.String(),
+		}
+		if a.TargetUserID.Valid {
+			item.TargetUserID = a.TargetUserID.UUID.String()
+		}
+		resp.Actions = append(resp.Actions, item)
+	}
+
+	successResponse, _ := json.Marshal(resp)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// claimReport assigns a report to the calling moderator so that nobody
+// else works on it. Claiming a report you already hold is a no-op, and a
+// report whose moderator has left can be claimed again.
+func (cfg *apiConfig) claimReport(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+		reportItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	moderator, err := cfg.authenticateStaff(req, roleModerator, roleAdmin)
+	if errors.Is(err, errForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	reportUUID, err := uuid.Parse(req.PathValue("reportID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid report ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	var report database.Report
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		var err error
+		report, err = tx.ClaimReport(req.Context(), database.ClaimReportParams{
+			ID:        reportUUID,
+			ClaimedBy: uuid.NullUUID{UUID: moderator.ID, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		return logModeration(req.Context(), tx, moderator.ID, moderationClaim, report, uuid.Nil, "")
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.writeReportConflict(w, req, reportUUID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "claim report", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		reportItem: newReportItem(report),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// resolveReport closes a report the calling moderator has claimed. Unless
+// it is dismissed, the chirp is hidden, its author is warned, or the author
+// is suspended, with the note as the reason given to them. Other open
+// reports on the chirp are closed with the same outcome, and every reporter
+// is told it either way.
+func (cfg *apiConfig) resolveReport(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Action      string `json:"action"`
+		Note        string `json:"note"`
+		SuspendDays int    `json:"suspend_days"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		reportItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	moderator, err := cfg.authenticateStaff(req, roleModerator, roleAdmin)
+	if errors.Is(err, errForbidden) {
+		w.WriteHeader(http.StatusForbidden)
+		return
+	}
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	reportUUID, err := uuid.Parse(req.PathValue("reportID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid report ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil || !slices.Contains(resolutions, data.Action) {
+		errResponse, _ := json.Marshal(response{
+			Error: `action must be "dismiss", "hide", "warn" or "suspend"`,
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if utf8.RuneCountInString(data.Note) > maxModerationNote {
+		errResponse, _ := json.Marshal(response{
+			Error: "Note is too long",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	if data.SuspendDays == 0 {
+		data.SuspendDays = defaultSuspensionDays
+	}
+	if data.SuspendDays < 1 || data.SuspendDays > maxSuspensionDays {
+		errResponse, _ := json.Marshal(response{
+			Error: "suspend_days must be between 1 and 365",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	var (
+		report database.Report
+		chirp  database.Chirp
+		notes  []database.Notification
+	)
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		notes = nil
+
+		var err error
+		report, err = tx.ResolveReport(req.Context(), database.ResolveReportParams{
+			ID:         reportUUID,
+			ClaimedBy:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+			Resolution: sql.NullString{String: data.Action, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		chirp, err = tx.GetChirp(req.Context(), report.ChirpID)
+		if err != nil {
+			return err
+		}
+
+		target := chirp.UserID
+		outcome := notificationReportActioned
+		switch data.Action {
+		case resolutionDismiss:
+			target = uuid.Nil
+			outcome = notificationReportDismissed
+		case resolutionHide:
+			err = tx.SoftDeleteChirp(req.Context(), chirp.ID)
+		case resolutionWarn:
+			var n database.Notification
+			var ok bool
+			n, ok, err = notify(req.Context(), tx, notification{Type: notificationWarning, Recipient: chirp.UserID, ChirpID: chirp.ID})
+			if ok {
+				notes = append(notes, n)
+			}
+		case resolutionSuspend:
+			reason := data.Note
+			if reason == "" {
+				reason = "Reported for " + report.Reason
+			}
+			until := time.Now().UTC().AddDate(0, 0, data.SuspendDays)
+			_, err = suspendAccount(req.Context(), tx, chirp.UserID, until, reason)
+		}
+		if err != nil {
+			return err
+		}
+
+		others, err := tx.ResolveOpenReportsByChirp(req.Context(), database.ResolveOpenReportsByChirpParams{
+			ChirpID:    chirp.ID,
+			ClaimedBy:  uuid.NullUUID{UUID: moderator.ID, Valid: true},
+			Resolution: sql.NullString{String: data.Action, Valid: true},
+		})
+		if err != nil {
+			return err
+		}
+		for _, r := range append([]database.Report{report}, others...) {
+			err = logModeration(req.Context(), tx, moderator.ID, data.Action, r, target, data.Note)
+			if err != nil {
+				return err
+			}
+			n, ok, err := notify(req.Context(), tx, notification{Type: outcome, Recipient: r.ReporterID, ChirpID: chirp.ID})
+			if err != nil {
+				return err
+			}
+			if ok {
+				notes = append(notes, n)
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		cfg.writeReportConflict(w, req, reportUUID)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "resolve report", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	if data.Action == resolutionHide && !chirp.DeletedAt.Valid {
+		cfg.publishChirpEvent(eventChirpDeleted, chirp, map[string]string{
+			"id":      chirp.ID.String(),
+			"user_id": chirp.UserID.String(),
+		})
+	}
+	cfg.publishNotifications(req.Context(), notes)
+
+	successResponse, _ := json.Marshal(response{
+		reportItem: newReportItem(report),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// writeReportConflict explains why a claim or resolution matched no report:
+// either it doesn't exist, or it isn't in a state the caller can change.
+func (cfg *apiConfig) writeReportConflict(w http.ResponseWriter, req *http.Request, reportID uuid.UUID) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	report, err := cfg.db.GetReport(req.Context(), reportID)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Report not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+
+	message := "Report is claimed by another moderator"
+	switch report.Status {
+	case reportOpen:
+		message = "Claim the report before resolving it"
+	case reportResolved:
+		message = "Report is already resolved"
+	}
+	errResponse, _ := json.Marshal(response{
+		Error: message,
+	})
+	w.WriteHeader(http.StatusConflict)
+	w.Write(errResponse)
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (api *testAPI) report(user testUser, chirpID, reason string) (int, reportItem) {
+	api.t.Helper()
+
+	code, body := api.do("POST", "/api/chirps/"+chirpID+"/report", user.bearer(), map[string]string{"reason": reason})
+	var r reportItem
+	if code == http.StatusCreated {
+		decode(api.t, body, &r)
+	}
+	return code, r
+}
+
+func (api *testAPI) signUpModerator(email string) testUser {
+	api.t.Helper()
+
+	user := api.signUp(email)
+	api.store.SetUserRole(uuid.MustParse(user.ID), roleModerator)
+	return user
+}
+
+func TestReportChirp(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	chirp := api.chirp(bob, "buy my stuff")
+
+	code, r := api.report(alice, chirp.ID, "spam")
+	if code != http.StatusCreated || r.Status != reportOpen || r.ChirpID != chirp.ID || r.ReporterID != alice.ID {
+		t.Fatalf("report: status %d, %+v", code, r)
+	}
+
+	tests := []struct {
+		name    string
+		user    testUser
+		chirpID string
+		reason  string
+		want    int
+	}{
+		{name: "twice", user: alice, chirpID: chirp.ID, reason: "spam", want: http.StatusConflict},
+		{name: "own chirp", user: bob, chirpID: chirp.ID, reason: "spam", want: http.StatusBadRequest},
+		{name: "unknown reason", user: alice, chirpID: chirp.ID, reason: "boring", want: http.StatusBadRequest},
+		{name: "unknown chirp", user: alice, chirpID: uuid.NewString(), reason: "spam", want: http.StatusNotFound},
+		{name: "anonymous", chirpID: chirp.ID, reason: "spam", want: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, _ := api.report(tt.user, tt.chirpID, tt.reason); code != tt.want {
+				t.Errorf("status %d, want %d", code, tt.want)
+			}
+		})
+	}
+}
+
+func TestModerationQueue(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	mod := api.signUpModerator("mod@example.com")
+	other := api.signUpModerator("other@example.com")
+	_, r := api.report(alice, api.chirp(bob, "one").ID, "spam")
+	api.report(alice, api.chirp(bob, "two").ID, "hate")
+
+	if code, _ := api.do("GET", "/admin/reports", alice.bearer(), nil); code != http.StatusForbidden {
+		t.Errorf("queue as a user: status %d", code)
+	}
+	code, body := api.do("GET", "/admin/reports?limit=1", mod.bearer(), nil)
+	var queue struct {
+		Reports    []reportItem `json:"reports"`
+		NextCursor string       `json:"next_cursor"`
+	}
+	decode(t, body, &queue)
+	if code != http.StatusOK || len(queue.Reports) != 1 || queue.NextCursor == "" {
+		t.Fatalf("queue: status %d: %s", code, body)
+	}
+
+	if code, body := api.do("POST", "/admin/reports/"+r.ID+"/resolve", mod.bearer(), map[string]string{"action": "dismiss"}); code != http.StatusConflict {
+		t.Errorf("resolve unclaimed: status %d: %s", code, body)
+	}
+	if code, body := api.do("POST", "/admin/reports/"+r.ID+"/claim", mod.bearer(), nil); code != http.StatusOK {
+		t.Fatalf("claim: status %d: %s", code, body)
+	}
+	if code, _ := api.do("POST", "/admin/reports/"+r.ID+"/claim", mod.bearer(), nil); code != http.StatusOK {
+		t.Errorf("claim again: status %d", code)
+	}
+	if code, _ := api.do("POST", "/admin/reports/"+r.ID+"/claim", other.bearer(), nil); code != http.StatusConflict {
+		t.Errorf("claim someone else's: status %d", code)
+	}
+	if code, _ := api.do("POST", "/admin/reports/"+r.ID+"/resolve", other.bearer(), map[string]string{"action": "dismiss"}); code != http.StatusConflict {
+		t.Errorf("resolve someone else's: status %d", code)
+	}
+	if code, _ := api.do("POST", "/admin/reports/"+uuid.NewString()+"/claim", mod.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("claim unknown: status %d", code)
+	}
+
+	code, body = api.do("GET", "/admin/reports?status=claimed", mod.bearer(), nil)
+	decode(t, body, &queue)
+	if code != http.StatusOK || len(queue.Reports) != 1 || queue.Reports[0].ClaimedBy != mod.ID {
+		t.Errorf("claimed queue: status %d: %s", code, body)
+	}
+	if code, _ := api.do("GET", "/admin/reports?status=lost", mod.bearer(), nil); code != http.StatusBadRequest {
+		t.Errorf("unknown status: status %d", code)
+	}
+}
+
+func TestResolveReport(t *testing.T) {
+	tests := []struct {
+		action  string
+		outcome string
+		check   func(t *testing.T, api *testAPI, author testUser, chirp testChirp)
+	}{
+		{
+			action:  resolutionDismiss,
+			outcome: notificationReportDismissed,
+			check: func(t *testing.T, api *testAPI, author testUser, chirp testChirp) {
+				if code, _ := api.do("GET", "/api/chirps/"+chirp.ID, "", nil); code != http.StatusOK {
+					t.Errorf("dismissed chirp: status %d", code)
+				}
+			},
+		},
+		{
+			action:  resolutionHide,
+			outcome: notificationReportActioned,
+			check: func(t *testing.T, api *testAPI, author testUser, chirp testChirp) {
+				if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 0 {
+					t.Errorf("hidden chirp still listed")
+				}
+			},
+		},
+		{
+			action:  resolutionWarn,
+			outcome: notificationReportActioned,
+			check: func(t *testing.T, api *testAPI, author testUser, chirp testChirp) {
+				page := api.notifications(author, "")
+				if len(page.Notifications) != 1 || page.Notifications[0].Type != notificationWarning || page.Notifications[0].ActorCount != 0 {
+					t.Errorf("author notifications = %+v", page)
+				}
+			},
+		},
+		{
+			action:  resolutionSuspend,
+			outcome: notificationReportActioned,
+			check: func(t *testing.T, api *testAPI, author testUser, chirp testChirp) {
+				user, _ := api.store.GetUserByID(context.Background(), uuid.MustParse(author.ID))
+				if !user.SuspendedUntil.Valid {
+					t.Error("author not suspended")
+				}
+				if code, _ := api.do("POST", "/api/refresh", "Bearer "+author.RefreshToken, nil); code != http.StatusUnauthorized {
+					t.Errorf("refresh after suspension: status %d", code)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			api := newTestAPI(t)
+			alice := api.signUp("alice@example.com")
+			bob := api.signUp("bob@example.com")
+			mod := api.signUpModerator("mod@example.com")
+			chirp := api.chirp(bob, "something awful")
+			_, r := api.report(alice, chirp.ID, "harassment")
+
+			api.do("POST", "/admin/reports/"+r.ID+"/claim", mod.bearer(), nil)
+			code, body := api.do("POST", "/admin/reports/"+r.ID+"/resolve", mod.bearer(), map[string]string{"action": tt.action, "note": "reviewed"})
+			var resolved reportItem
+			decode(t, body, &resolved)
+			if code != http.StatusOK || resolved.Status != reportResolved || resolved.Resolution != tt.action {
+				t.Fatalf("resolve: status %d: %s", code, body)
+			}
+			if code, _ := api.do("POST", "/admin/reports/"+r.ID+"/resolve", mod.bearer(), map[string]string{"action": tt.action}); code != http.StatusConflict {
+				t.Errorf("resolve twice: status %d", code)
+			}
+
+			page := api.notifications(alice, "")
+			if len(page.Notifications) != 1 || page.Notifications[0].Type != tt.outcome || page.Notifications[0].ChirpID != chirp.ID {
+				t.Errorf("reporter notifications = %+v", page)
+			}
+			tt.check(t, api, bob, chirp)
+
+			code, body = api.do("GET", "/admin/reports/"+r.ID, mod.bearer(), nil)
+			var detail struct {
+				Chirp struct {
+					Body string `json:"body"`
+				} `json:"chirp"`
+				Actions []moderationActionItem `json:"actions"`
+			}
+			decode(t, body, &detail)
+			if code != http.StatusOK || detail.Chirp.Body != chirp.Body || len(detail.Actions) != 2 {
+				t.Fatalf("report detail: status %d: %s", code, body)
+			}
+			if a := detail.Actions[1]; a.Action != tt.action || a.ModeratorID != mod.ID || a.Note != "reviewed" {
+				t.Errorf("logged action = %+v", a)
+			}
+		})
+	}
+}
+
+func TestResolveReportClosesOthers(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	carol := api.signUp("carol@example.com")
+	mod := api.signUpModerator("mod@example.com")
+	chirp := api.chirp(bob, "something awful")
+	_, first := api.report(alice, chirp.ID, "harassment")
+	_, second := api.report(carol, chirp.ID, "spam")
+
+	api.do("POST", "/admin/reports/"+first.ID+"/claim", mod.bearer(), nil)
+	if code, body := api.do("POST", "/admin/reports/"+first.ID+"/resolve", mod.bearer(), map[string]string{"action": resolutionHide}); code != http.StatusOK {
+		t.Fatalf("resolve: status %d: %s", code, body)
+	}
+
+	code, body := api.do("GET", "/admin/reports/"+second.ID, mod.bearer(), nil)
+	var detail struct {
+		reportItem
+		Actions []moderationActionItem `json:"actions"`
+	}
+	decode(t, body, &detail)
+	if code != http.StatusOK || detail.Status != reportResolved || detail.Resolution != resolutionHide || len(detail.Actions) != 1 {
+		t.Errorf("other report: status %d: %s", code, body)
+	}
+	if page := api.notifications(carol, ""); len(page.Notifications) != 1 || page.Notifications[0].Type != notificationReportActioned {
+		t.Errorf("other reporter notifications = %+v", page)
+	}
+
+	// the hidden chirp outlives the restore window so its reports are kept
+	api.cfg.chirpRestoreWindow = -time.Minute
+	if err := api.cfg.purgeDeletedChirps(context.Background()); err != nil {
+		t.Fatalf("purgeDeletedChirps() error = %v", err)
+	}
+	for _, r := range []reportItem{first, second} {
+		if code, _ := api.do("GET", "/admin/reports/"+r.ID, mod.bearer(), nil); code != http.StatusOK {
+			t.Errorf("report after purge: status %d", code)
+		}
+	}
+}
+
+func TestResolveReportValidation(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	mod := api.signUpModerator("mod@example.com")
+	_, r := api.report(alice, api.chirp(bob, "meh").ID, "other")
+	api.do("POST", "/admin/reports/"+r.ID+"/claim", mod.bearer(), nil)
+
+	for _, body := range []any{
+		map[string]any{"action": "ban"},
+		map[string]any{"action": "suspend", "suspend_days": 1000},
+		"{",
+	} {
+		if code, _ := api.do("POST", "/admin/reports/"+r.ID+"/resolve", mod.bearer(), body); code != http.StatusBadRequest {
+			t.Errorf("resolve %v: status %d", body, code)
+		}
+	}
+	if code, _ := api.do("POST", "/admin/reports/"+r.ID+"/resolve", alice.bearer(), map[string]string{"action": "dismiss"}); code != http.StatusForbidden {
+		t.Errorf("resolve as a user: status %d", code)
+	}
+}
@@ -0,0 +1,344 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// chirpScheduled is the status of chirps that are hidden from everyone but
+// their author until the scheduler publishes them. Every other chirp is
+// "published".
+const chirpScheduled = "scheduled"
+
+const (
+	// maxScheduleAhead is how far in the future a chirp can be scheduled.
+	maxScheduleAhead = 365 * 24 * time.Hour
+	// scheduledBatchSize is how many due chirps one transaction publishes.
+	scheduledBatchSize = 100
+)
+
+// parsePublishAt parses a publish_at timestamp in RFC 3339 and checks that
+// it's in the future, but not too far. The error is suitable for the client.
+func parsePublishAt(value string, now time.Time) (time.Time, error) {
+	publishAt, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, errors.New("publish_at must be an RFC 3339 timestamp")
+	}
+	if !publishAt.After(now) {
+		return time.Time{}, errors.New("publish_at must be in the future")
+	}
+	if publishAt.Sub(now) > maxScheduleAhead {
+		return time.Time{}, errors.New("publish_at must be within 365 days")
+	}
+	return publishAt.UTC(), nil
+}
+
+// chirpItem is a chirp with its media and links, as the scheduled chirp
+// endpoints return it and as its chirp.created event carries it when the
+// scheduler publishes it.
+type chirpItem struct {
+	ID        string       `json:"id"`
+	Body      string       `json:"body"`
+	UserID    string       `json:"user_id"`
+	Status    string       `json:"status"`
+	Media     []chirpMedia `json:"media,omitempty"`
+	Links     []chirpLink  `json:"links,omitempty"`
+	PublishAt string       `json:"publish_at,omitempty"`
+	CreatedAt string       `json:"created_at"`
+	UpdatedAt string       `json:"updated_at"`
+}
+
+// chirpItems loads the media and links of chirps.
+func (cfg *apiConfig) chirpItems(ctx context.Context, chirps []database.Chirp) ([]chirpItem, error) {
+	chirpIDs := make([]uuid.UUID, 0, len(chirps))
+	for _, chirp := range chirps {
+		chirpIDs = append(chirpIDs, chirp.ID)
+	}
+	media, err := cfg.mediaByChirp(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+	links, err := cfg.linksByChirp(ctx, chirpIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	items := []chirpItem{}
+	for _, chirp := range chirps {
+		item := chirpItem{
+			ID:        chirp.ID.String(),
+			Body:      chirp.Body,
+			UserID:    chirp.UserID.String(),
+			Status:    chirp.Status,
+			Media:     media[chirp.ID],
+			Links:     links[chirp.ID],
+			CreatedAt: chirp.CreatedAt.String(),
+			UpdatedAt: chirp.UpdatedAt.String(),
+		}
+		if chirp.PublishAt.Valid {
+			item.PublishAt = chirp.PublishAt.Time.Format(time.RFC3339)
+		}
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+// listScheduledChirps returns the caller's scheduled chirps, soonest first.
+func (cfg *apiConfig) listScheduledChirps(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	chirps, err := cfg.db.ListScheduledChirpsByAuthor(req.Context(), userUUID)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "list scheduled chirps", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+	items, err := cfg.chirpItems(req.Context(), chirps)
+	if err != nil {
+		slog.ErrorContext(req.Context(), "load scheduled chirps", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(items)
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// rescheduleChirp moves one of the caller's scheduled chirps to a new
+// publish_at. Chirps that have already been published can't be moved.
+func (cfg *apiConfig) rescheduleChirp(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		PublishAt string `json:"publish_at"`
+	}
+	type response struct {
+		Error string `json:"error,omitempty"`
+		chirpItem
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid chirp ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	data := requestData{}
+	err = decoder.Decode(&data)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+	publishAt, err := parsePublishAt(data.PublishAt, time.Now().UTC())
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	chirp, err := cfg.db.RescheduleChirp(req.Context(), database.RescheduleChirpParams{
+		ID:        chirpUUID,
+		UserID:    userUUID,
+		PublishAt: sql.NullTime{Time: publishAt, Valid: true},
+	})
+	if errors.Is(err, sql.ErrNoRows) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Scheduled chirp not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "reschedule chirp", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+	items, err := cfg.chirpItems(req.Context(), []database.Chirp{chirp})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "load scheduled chirp", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		chirpItem: items[0],
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// cancelScheduledChirp deletes one of the caller's scheduled chirps and its
+// media for good. Nobody else has seen it, so there's nothing to restore.
+func (cfg *apiConfig) cancelScheduledChirp(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	chirpUUID, err := uuid.Parse(req.PathValue("chirpID"))
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid chirp ID",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	var mediaIDs []uuid.UUID
+	var cancelled int64
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		var err error
+		mediaIDs, err = tx.DeleteMediaOfScheduledChirp(req.Context(), database.DeleteMediaOfScheduledChirpParams{
+			ID:     chirpUUID,
+			UserID: userUUID,
+		})
+		if err != nil {
+			return err
+		}
+		cancelled, err = tx.CancelScheduledChirp(req.Context(), database.CancelScheduledChirpParams{
+			ID:     chirpUUID,
+			UserID: userUUID,
+		})
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(req.Context(), "cancel scheduled chirp", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+	if cancelled == 0 {
+		errResponse, _ := json.Marshal(response{
+			Error: "Scheduled chirp not found",
+		})
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(errResponse)
+		return
+	}
+	cfg.deleteMediaBlobs(req.Context(), mediaIDs)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishScheduledChirps publishes every scheduled chirp that is due, in
+// batches. ListDueChirps locks the rows it returns and skips rows another
+// replica has locked, so each chirp is published exactly once. Mentions are
+// notified at publish time, not when the chirp was scheduled. Chirps whose
+// author is suspended or banned are held until the suspension ends.
+func (cfg *apiConfig) publishScheduledChirps(ctx context.Context) error {
+	for {
+		var due, published []database.Chirp
+		var notes []database.Notification
+		err := cfg.db.InTx(ctx, func(tx store.Store) error {
+			published, notes = nil, nil
+			var err error
+			due, err = tx.ListDueChirps(ctx, database.ListDueChirpsParams{
+				PublishAt: sql.NullTime{Time: time.Now().UTC(), Valid: true},
+				Limit:     scheduledBatchSize,
+			})
+			if err != nil {
+				return err
+			}
+			for _, c := range due {
+				chirp, err := tx.PublishChirp(ctx, c.ID)
+				if err != nil {
+					return err
+				}
+				n, err := notifyMentions(ctx, tx, chirp, findMentions(chirp.Body))
+				if err != nil {
+					return err
+				}
+				published = append(published, chirp)
+				notes = append(notes, n...)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if len(published) == 0 {
+			return nil
+		}
+		slog.InfoContext(ctx, "published scheduled chirps", "count", len(published))
+		items, err := cfg.chirpItems(ctx, published)
+		if err != nil {
+			slog.ErrorContext(ctx, "load published chirps", "error", err)
+		}
+		for i, item := range items {
+			cfg.publishChirpEvent(eventChirpCreated, published[i], item)
+		}
+		cfg.publishNotifications(ctx, notes)
+		cfg.wakePreviewFetcher()
+
+		if len(due) < scheduledBatchSize {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/google/uuid"
+)
+
+// scheduleChirp schedules body to be published by user an hour from now.
+func (api *testAPI) scheduleChirp(user testUser, body string) chirpItem {
+	api.t.Helper()
+
+	publishAt := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	code, resp := api.do("POST", "/api/chirps", user.bearer(), map[string]string{"body": body, "publish_at": publishAt})
+	var chirp chirpItem
+	decode(api.t, resp, &chirp)
+	if code != http.StatusCreated || chirp.Status != chirpScheduled || chirp.PublishAt != publishAt {
+		api.t.Fatalf("schedule chirp: status %d: %s", code, resp)
+	}
+	return chirp
+}
+
+// makeDue moves a scheduled chirp into the past, which the API refuses to.
+func (api *testAPI) makeDue(user testUser, chirpID string) {
+	api.t.Helper()
+
+	_, err := api.store.RescheduleChirp(context.Background(), database.RescheduleChirpParams{
+		ID:        uuid.MustParse(chirpID),
+		UserID:    uuid.MustParse(user.ID),
+		PublishAt: sql.NullTime{Time: time.Now().UTC().Add(-time.Minute), Valid: true},
+	})
+	if err != nil {
+		api.t.Fatal(err)
+	}
+}
+
+func TestScheduleChirp(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(bob, "bob")
+	chirp := api.scheduleChirp(alice, "see you later @bob")
+
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 0 {
+		t.Errorf("scheduled chirp listed: %v", got)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+chirp.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("get scheduled chirp: status %d", code)
+	}
+	if code, _ := api.do("DELETE", "/api/chirps/"+chirp.ID, alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("delete scheduled chirp: status %d", code)
+	}
+	if page := api.notifications(bob, ""); len(page.Notifications) != 0 {
+		t.Errorf("mention notified before publishing: %+v", page)
+	}
+
+	code, body := api.do("GET", "/api/chirps/scheduled", alice.bearer(), nil)
+	var scheduled []chirpItem
+	decode(t, body, &scheduled)
+	if code != http.StatusOK || len(scheduled) != 1 || scheduled[0].ID != chirp.ID {
+		t.Fatalf("list scheduled: status %d: %s", code, body)
+	}
+	code, body = api.do("GET", "/api/chirps/scheduled", bob.bearer(), nil)
+	if code != http.StatusOK || string(body) != "[]" {
+		t.Errorf("someone else's scheduled chirps: status %d: %s", code, body)
+	}
+}
+
+func TestPublishScheduledChirps(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(bob, "bob")
+	due := api.scheduleChirp(alice, "good morning @bob")
+	later := api.scheduleChirp(alice, "good night")
+	api.makeDue(alice, due.ID)
+
+	client := api.openLive(bob, time.Now().Add(time.Hour))
+	client.send(liveRequest{Type: "subscribe", Channel: "timeline"})
+	client.expect("subscribed")
+
+	ctx := context.Background()
+	if err := api.cfg.publishScheduledChirps(ctx); err != nil {
+		t.Fatalf("publishScheduledChirps() error = %v", err)
+	}
+	// running again, as another replica would, publishes nothing twice
+	if err := api.cfg.publishScheduledChirps(ctx); err != nil {
+		t.Fatalf("publishScheduledChirps() error = %v", err)
+	}
+
+	msg := client.expect("event")
+	var event testChirp
+	decode(t, msg.Data, &event)
+	if msg.Event != eventChirpCreated || event.ID != due.ID {
+		t.Errorf("event %s for %+v", msg.Event, event)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+due.ID, "", nil); code != http.StatusOK {
+		t.Errorf("get published chirp: status %d", code)
+	}
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 1 {
+		t.Errorf("chirps listed after publishing: %v", got)
+	}
+	if page := api.notifications(bob, ""); len(page.Notifications) != 1 || page.Notifications[0].ChirpID != due.ID {
+		t.Errorf("mention notifications after publishing: %+v", page)
+	}
+
+	code, body := api.do("GET", "/api/chirps/scheduled", alice.bearer(), nil)
+	var scheduled []chirpItem
+	decode(t, body, &scheduled)
+	if code != http.StatusOK || len(scheduled) != 1 || scheduled[0].ID != later.ID {
+		t.Errorf("still scheduled: status %d: %s", code, body)
+	}
+}
+
+func TestPublishScheduledChirpsHoldsSuspended(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	api.setHandle(bob, "bob")
+	chirp := api.scheduleChirp(alice, "hello @bob")
+	api.makeDue(alice, chirp.ID)
+
+	if code, body := api.do("POST", "/admin/users/"+alice.ID+"/suspend", admin.bearer(), map[string]any{"days": 1}); code != http.StatusOK {
+		t.Fatalf("suspend: status %d: %s", code, body)
+	}
+	ctx := context.Background()
+	if err := api.cfg.publishScheduledChirps(ctx); err != nil {
+		t.Fatalf("publishScheduledChirps() error = %v", err)
+	}
+	if stored, _ := api.store.GetChirp(ctx, uuid.MustParse(chirp.ID)); stored.Status != chirpScheduled {
+		t.Errorf("status while suspended = %q, want %q", stored.Status, chirpScheduled)
+	}
+	if page := api.notifications(bob, ""); len(page.Notifications) != 0 {
+		t.Errorf("mention notified while suspended: %+v", page)
+	}
+
+	if code, body := api.do("POST", "/admin/users/"+alice.ID+"/unsuspend", admin.bearer(), nil); code != http.StatusOK {
+		t.Fatalf("unsuspend: status %d: %s", code, body)
+	}
+	if err := api.cfg.publishScheduledChirps(ctx); err != nil {
+		t.Fatalf("publishScheduledChirps() error = %v", err)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+chirp.ID, "", nil); code != http.StatusOK {
+		t.Errorf("get after unsuspending: status %d", code)
+	}
+}
+
+func TestRescheduleChirp(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	chirp := api.scheduleChirp(alice, "soon")
+	published := api.chirp(alice, "now")
+
+	publishAt := time.Now().Add(48 * time.Hour).UTC().Format(time.RFC3339)
+	code, body := api.do("PATCH", "/api/chirps/scheduled/"+chirp.ID, alice.bearer(), map[string]string{"publish_at": publishAt})
+	var moved chirpItem
+	decode(t, body, &moved)
+	if code != http.StatusOK || moved.PublishAt != publishAt {
+		t.Fatalf("reschedule: status %d: %s", code, body)
+	}
+
+	tests := []struct {
+		name      string
+		user      testUser
+		chirpID   string
+		publishAt string
+		want      int
+	}{
+		{name: "someone else's", user: bob, chirpID: chirp.ID, publishAt: publishAt, want: http.StatusNotFound},
+		{name: "published", user: alice, chirpID: published.ID, publishAt: publishAt, want: http.StatusNotFound},
+		{name: "past", user: alice, chirpID: chirp.ID, publishAt: "2020-01-01T00:00:00Z", want: http.StatusBadRequest},
+		{name: "too far", user: alice, chirpID: chirp.ID, publishAt: time.Now().AddDate(2, 0, 0).Format(time.RFC3339), want: http.StatusBadRequest},
+		{name: "not a time", user: alice, chirpID: chirp.ID, publishAt: "tomorrow", want: http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("PATCH", "/api/chirps/scheduled/"+tt.chirpID, tt.user.bearer(), map[string]string{"publish_at": tt.publishAt})
+			if code != tt.want {
+				t.Errorf("status %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestCancelScheduledChirp(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	chirp := api.scheduleChirp(alice, "never mind")
+	published := api.chirp(alice, "already out")
+
+	if code, _ := api.do("DELETE", "/api/chirps/scheduled/"+chirp.ID, bob.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("cancel someone else's: status %d", code)
+	}
+	if code, _ := api.do("DELETE", "/api/chirps/scheduled/"+published.ID, alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("cancel a published chirp: status %d", code)
+	}
+	if code, body := api.do("DELETE", "/api/chirps/scheduled/"+chirp.ID, alice.bearer(), nil); code != http.StatusNoContent {
+		t.Fatalf("cancel: status %d: %s", code, body)
+	}
+	if code, _ := api.do("DELETE", "/api/chirps/scheduled/"+chirp.ID, alice.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("cancel twice: status %d", code)
+	}
+	if _, err := api.store.GetChirp(context.Background(), uuid.MustParse(chirp.ID)); err == nil {
+		t.Error("cancelled chirp still stored")
+	}
+}
+
+func TestScheduleChirpValidation(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+
+	for _, publishAt := range []string{
+		"2020-01-01T00:00:00Z",
+		time.Now().AddDate(2, 0, 0).Format(time.RFC3339),
+		"next week",
+	} {
+		code, body := api.do("POST", "/api/chirps", alice.bearer(), map[string]string{"body": "hi", "publish_at": publishAt})
+		if code != http.StatusBadRequest {
+			t.Errorf("publish_at %q: status %d: %s", publishAt, code, body)
+		}
+	}
+}
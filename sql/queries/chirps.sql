@@ -9,14 +9,111 @@ VALUES (
 )
 RETURNING *;
 
+-- name: CreateScheduledChirp :one
+INSERT INTO chirps (id, body, user_id, created_at, updated_at, status, publish_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW(),
+    NOW(),
+    'scheduled',
+    $3
+)
+RETURNING *;
+
 -- name: ListChirps :many
-SELECT * FROM chirps ORDER BY created_at;
+SELECT * FROM chirps
+WHERE deleted_at IS NULL AND status = 'published'
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg(viewer_id) AND blocked_id = chirps.user_id)
+       OR (blocker_id = chirps.user_id AND blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE muter_id = sqlc.arg(viewer_id) AND muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+      AND (users.banned_at IS NOT NULL OR users.suspended_until > NOW())
+)
+ORDER BY created_at;
 
 -- name: ListChirpsByAuthor :many
-SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at;
+SELECT * FROM chirps
+WHERE user_id = $1 AND deleted_at IS NULL AND status = 'published'
+AND NOT EXISTS (
+    SELECT 1 FROM blocks
+    WHERE (blocker_id = sqlc.arg(viewer_id) AND blocked_id = chirps.user_id)
+       OR (blocker_id = chirps.user_id AND blocked_id = sqlc.arg(viewer_id))
+)
+AND NOT EXISTS (
+    SELECT 1 FROM mutes
+    WHERE muter_id = sqlc.arg(viewer_id) AND muted_id = chirps.user_id
+)
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+      AND (users.banned_at IS NOT NULL OR users.suspended_until > NOW())
+)
+ORDER BY created_at;
 
 -- name: GetChirp :one
 SELECT * FROM chirps WHERE id = $1;
 
--- name: DeleteChirp :exec
-DELETE FROM chirps WHERE id = $1;
+-- name: SoftDeleteChirp :exec
+UPDATE chirps
+SET deleted_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND deleted_at IS NULL;
+
+-- name: RestoreChirp :one
+UPDATE chirps
+SET deleted_at = NULL, updated_at = NOW()
+WHERE id = $1 AND deleted_at > $2
+RETURNING *;
+
+-- name: PurgeDeletedChirps :execrows
+DELETE FROM chirps
+WHERE deleted_at < $1
+AND NOT EXISTS (
+    SELECT 1 FROM reports
+    WHERE reports.chirp_id = chirps.id AND reports.resolution = 'hide'
+);
+
+-- name: ListAllChirpsByAuthor :many
+SELECT * FROM chirps WHERE user_id = $1 ORDER BY created_at;
+
+-- name: ListScheduledChirpsByAuthor :many
+SELECT * FROM chirps
+WHERE user_id = $1 AND status = 'scheduled'
+ORDER BY publish_at, id;
+
+-- name: RescheduleChirp :one
+UPDATE chirps
+SET publish_at = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled'
+RETURNING *;
+
+-- name: CancelScheduledChirp :execrows
+DELETE FROM chirps
+WHERE id = $1 AND user_id = $2 AND status = 'scheduled';
+
+-- name: ListDueChirps :many
+SELECT * FROM chirps
+WHERE status = 'scheduled' AND publish_at <= $1
+AND NOT EXISTS (
+    SELECT 1 FROM users
+    WHERE users.id = chirps.user_id
+      AND (users.banned_at IS NOT NULL OR users.suspended_until > NOW())
+)
+ORDER BY publish_at, id
+LIMIT $2
+FOR UPDATE SKIP LOCKED;
+
+-- name: PublishChirp :one
+UPDATE chirps
+SET status = 'published', created_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'scheduled'
+RETURNING *;
@@ -0,0 +1,66 @@
+-- name: CreateConversation :one
+INSERT INTO conversations (id, user_a, user_b, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: GetConversation :one
+SELECT * FROM conversations WHERE id = $1;
+
+-- name: GetConversationByUsers :one
+SELECT * FROM conversations WHERE user_a = $1 AND user_b = $2;
+
+-- name: ListConversationsByUser :many
+SELECT * FROM conversations
+WHERE user_a = $1 OR user_b = $1
+ORDER BY updated_at DESC, id DESC;
+
+-- name: CreateMessage :one
+WITH touched AS (
+    UPDATE conversations SET updated_at = NOW() WHERE conversations.id = $2
+)
+INSERT INTO messages (id, conversation_id, sender_id, body, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: ListMessages :many
+SELECT * FROM messages
+WHERE conversation_id = $1
+  AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.arg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ListMessagesByUser :many
+SELECT messages.* FROM messages
+JOIN conversations ON conversations.id = messages.conversation_id
+WHERE conversations.user_a = $1 OR conversations.user_b = $1
+ORDER BY messages.created_at, messages.id;
+
+-- name: GetLatestMessage :one
+SELECT * FROM messages
+WHERE conversation_id = $1
+ORDER BY created_at DESC, id DESC
+LIMIT 1;
+
+-- name: CountUnreadMessages :one
+SELECT COUNT(*) FROM messages
+WHERE conversation_id = $1 AND sender_id <> $2 AND read_at IS NULL;
+
+-- name: MarkMessagesRead :execrows
+UPDATE messages
+SET read_at = NOW()
+WHERE conversation_id = $1 AND sender_id <> $2 AND read_at IS NULL;
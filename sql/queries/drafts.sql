@@ -0,0 +1,34 @@
+-- name: CreateDraft :one
+INSERT INTO drafts (id, user_id, body, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: GetDraft :one
+SELECT * FROM drafts WHERE id = $1 AND user_id = $2;
+
+-- name: ListDraftsByUser :many
+SELECT * FROM drafts
+WHERE user_id = $1
+ORDER BY updated_at DESC, id DESC;
+
+-- name: CountDraftsByUser :one
+SELECT COUNT(*) FROM drafts WHERE user_id = $1;
+
+-- name: UpdateDraft :one
+UPDATE drafts
+SET body = $3, updated_at = NOW()
+WHERE id = $1 AND user_id = $2
+RETURNING *;
+
+-- name: DeleteDraft :execrows
+DELETE FROM drafts WHERE id = $1 AND user_id = $2;
+
+-- name: TakeDraft :one
+DELETE FROM drafts WHERE id = $1 AND user_id = $2
+RETURNING *;
@@ -0,0 +1,38 @@
+-- name: CreateLink :one
+INSERT INTO links (id, code, url, chirp_id, position, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    NOW()
+)
+RETURNING *;
+
+-- name: FollowLink :one
+UPDATE links
+SET clicks = clicks + 1
+WHERE code = $1
+  AND chirp_id IN (SELECT id FROM chirps WHERE deleted_at IS NULL AND status = 'published')
+RETURNING *;
+
+-- name: ListLinksByChirps :many
+SELECT * FROM links WHERE chirp_id = ANY($1::uuid[]) ORDER BY chirp_id, position;
+
+-- name: ListLinksPendingPreview :many
+SELECT links.* FROM links
+JOIN chirps ON chirps.id = links.chirp_id
+WHERE links.preview_fetched_at IS NULL
+  AND chirps.deleted_at IS NULL
+  AND chirps.status = 'published'
+ORDER BY links.created_at
+LIMIT $1;
+
+-- name: SetLinkPreview :exec
+UPDATE links
+SET preview_title = $2,
+    preview_description = $3,
+    preview_image_url = $4,
+    preview_fetched_at = NOW()
+WHERE id = $1;
@@ -0,0 +1,53 @@
+-- name: CreateMedia :one
+INSERT INTO media (id, user_id, content_type, width, height, size_bytes, created_at)
+VALUES (
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
+)
+RETURNING *;
+
+-- name: GetMedia :one
+SELECT * FROM media WHERE id = $1;
+
+-- name: AttachMedia :execrows
+UPDATE media
+SET chirp_id = $2, position = $3
+WHERE id = $1 AND user_id = $4 AND chirp_id IS NULL;
+
+-- name: ListMediaByChirps :many
+SELECT * FROM media WHERE chirp_id = ANY($1::uuid[]) ORDER BY chirp_id, position;
+
+-- name: ListMediaByUser :many
+SELECT * FROM media WHERE user_id = $1 ORDER BY created_at, id;
+
+-- name: DeleteMediaOfScheduledChirp :many
+DELETE FROM media
+USING chirps
+WHERE media.chirp_id = chirps.id
+  AND chirps.id = $1 AND chirps.user_id = $2 AND chirps.status = 'scheduled'
+RETURNING media.id;
+
+-- name: DeleteMediaOfDeletedChirps :many
+DELETE FROM media
+USING chirps
+WHERE media.chirp_id = chirps.id AND chirps.deleted_at < $1
+AND NOT EXISTS (
+    SELECT 1 FROM reports
+    WHERE reports.chirp_id = chirps.id AND reports.resolution = 'hide'
+)
+RETURNING media.id;
+
+-- name: DeleteMediaByUser :many
+DELETE FROM media WHERE user_id = $1
+RETURNING id;
+
+-- name: DeleteMediaOfUsersScheduledBefore :many
+DELETE FROM media
+USING users
+WHERE media.user_id = users.id AND users.deletion_scheduled_at <= $1
+RETURNING media.id;
@@ -0,0 +1,50 @@
+-- name: CreateNotification :one
+INSERT INTO notifications (id, user_id, type, group_key, chirp_id, actor_ids, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    ARRAY[sqlc.arg(actor_id)::uuid],
+    NOW(),
+    NOW()
+)
+ON CONFLICT (user_id, type, group_key) WHERE read_at IS NULL DO UPDATE
+SET actor_ids = CASE
+        WHEN sqlc.arg(actor_id)::uuid = ANY(notifications.actor_ids) THEN notifications.actor_ids
+        ELSE notifications.actor_ids || sqlc.arg(actor_id)::uuid
+    END,
+    updated_at = NOW()
+RETURNING *;
+
+-- name: ListNotifications :many
+SELECT * FROM notifications
+WHERE user_id = $1
+  AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.arg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: CountUnreadNotifications :one
+SELECT COUNT(*) FROM notifications WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: MarkNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND id = ANY(sqlc.arg(ids)::uuid[]) AND read_at IS NULL;
+
+-- name: MarkAllNotificationsRead :execrows
+UPDATE notifications
+SET read_at = NOW()
+WHERE user_id = $1 AND read_at IS NULL;
+
+-- name: ListNotificationPreferences :many
+SELECT * FROM notification_preferences WHERE user_id = $1 ORDER BY type;
+
+-- name: SetNotificationPreference :exec
+INSERT INTO notification_preferences (user_id, type, enabled)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id, type) DO UPDATE SET enabled = EXCLUDED.enabled;
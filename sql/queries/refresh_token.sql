@@ -18,3 +18,9 @@ SELECT * FROM refresh_tokens WHERE token = $1;
 UPDATE refresh_tokens
 SET revoked_at = NOW(), updated_at = NOW()
 WHERE token = $1;
+
+-- name: DeleteRefreshTokensByUser :exec
+DELETE FROM refresh_tokens WHERE user_id = $1;
+
+-- name: ListRefreshTokensByUser :many
+SELECT * FROM refresh_tokens WHERE user_id = $1 ORDER BY created_at;
@@ -0,0 +1,67 @@
+-- name: CreateReport :one
+INSERT INTO reports (id, chirp_id, reporter_id, reason, details, status, created_at, updated_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    'open',
+    NOW(),
+    NOW()
+)
+RETURNING *;
+
+-- name: GetReport :one
+SELECT * FROM reports WHERE id = $1;
+
+-- name: ChirpHiddenByReport :one
+SELECT EXISTS (
+    SELECT 1 FROM reports WHERE chirp_id = $1 AND resolution = 'hide'
+);
+
+-- name: ListReports :many
+SELECT * FROM reports
+WHERE status = $1
+  AND (
+    sqlc.narg(before_created_at)::timestamp IS NULL
+    OR (created_at, id) < (sqlc.narg(before_created_at), sqlc.arg(before_id)::uuid)
+  )
+ORDER BY created_at DESC, id DESC
+LIMIT sqlc.arg(page_size);
+
+-- name: ClaimReport :one
+UPDATE reports
+SET status = 'claimed', claimed_by = $2, updated_at = NOW()
+WHERE id = $1
+  AND (status = 'open' OR (status = 'claimed' AND (claimed_by = $2 OR claimed_by IS NULL)))
+RETURNING *;
+
+-- name: ResolveReport :one
+UPDATE reports
+SET status = 'resolved', resolution = $3, resolved_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND status = 'claimed' AND claimed_by = $2
+RETURNING *;
+
+-- name: ResolveOpenReportsByChirp :many
+UPDATE reports
+SET status = 'resolved', claimed_by = $2, resolution = $3, resolved_at = NOW(), updated_at = NOW()
+WHERE chirp_id = $1 AND status = 'open'
+RETURNING *;
+
+-- name: CreateModerationAction :one
+INSERT INTO moderation_log (id, moderator_id, action, report_id, chirp_id, target_user_id, note, created_at)
+VALUES (
+    gen_random_uuid(),
+    $1,
+    $2,
+    $3,
+    $4,
+    $5,
+    $6,
+    NOW()
+)
+RETURNING *;
+
+-- name: ListModerationActionsByReport :many
+SELECT * FROM moderation_log WHERE report_id = $1 ORDER BY created_at, id;
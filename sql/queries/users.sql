@@ -15,10 +15,21 @@ DELETE FROM users;
 -- name: GetUserByEmail :one
 SELECT * FROM users WHERE email = $1;
 
+-- name: GetUserByID :one
+SELECT * FROM users WHERE id = $1;
+
+-- name: GetUserByHandle :one
+SELECT * FROM users WHERE LOWER(handle) = LOWER(sqlc.arg(handle));
+
 -- name: UpdateUser :one
 UPDATE users
 SET email = $2,
-    hashed_password = $3
+    hashed_password = $3,
+    handle = $4,
+    display_name = $5,
+    bio = $6,
+    avatar_url = $7,
+    updated_at = NOW()
 WHERE id = $1
 RETURNING *;
 
@@ -27,3 +38,68 @@ UPDATE users
 SET is_chirpy_red = true,
     updated_at = NOW()
 WHERE id = $1;
+
+-- name: DeleteUser :exec
+DELETE FROM users WHERE id = $1;
+
+-- name: ScheduleUserDeletion :one
+UPDATE users
+SET deletion_scheduled_at = $2,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: CancelUserDeletion :exec
+UPDATE users
+SET deletion_scheduled_at = NULL,
+    updated_at = NOW()
+WHERE id = $1;
+
+-- name: DeleteUsersScheduledBefore :execrows
+DELETE FROM users WHERE deletion_scheduled_at <= $1;
+
+-- name: SetPendingEmail :one
+UPDATE users
+SET pending_email = $2,
+    email_verification_token = $3,
+    email_verification_expires_at = $4,
+    updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: GetUserByEmailVerificationToken :one
+SELECT * FROM users WHERE email_verification_token = $1;
+
+-- name: ConfirmPendingEmail :one
+UPDATE users
+SET email = pending_email,
+    pending_email = NULL,
+    email_verification_token = NULL,
+    email_verification_expires_at = NULL,
+    updated_at = NOW()
+WHERE id = $1 AND pending_email IS NOT NULL
+RETURNING *;
+
+-- name: SetDMPrivacy :one
+UPDATE users
+SET dm_privacy = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: SuspendUser :one
+UPDATE users
+SET suspended_until = $2, ban_reason = $3, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: BanUser :one
+UPDATE users
+SET banned_at = NOW(), ban_reason = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING *;
+
+-- name: UnsuspendUser :one
+UPDATE users
+SET suspended_until = NULL, banned_at = NULL, ban_reason = '', updated_at = NOW()
+WHERE id = $1
+RETURNING *;
@@ -0,0 +1,11 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN pending_email TEXT,
+ADD COLUMN email_verification_token TEXT UNIQUE,
+ADD COLUMN email_verification_expires_at TIMESTAMP;
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN pending_email,
+DROP COLUMN email_verification_token,
+DROP COLUMN email_verification_expires_at;
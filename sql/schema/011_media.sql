@@ -0,0 +1,18 @@
+-- +goose Up
+CREATE TABLE media (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    chirp_id uuid,
+    position INTEGER,
+    content_type TEXT NOT NULL,
+    width INTEGER NOT NULL,
+    height INTEGER NOT NULL,
+    size_bytes BIGINT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+UNIQUE (chirp_id, position)
+);
+
+-- +goose Down
+DROP TABLE media;
@@ -0,0 +1,21 @@
+-- +goose Up
+CREATE TABLE links (
+    id uuid PRIMARY KEY,
+    code TEXT NOT NULL UNIQUE,
+    url TEXT NOT NULL,
+    chirp_id uuid NOT NULL,
+    position INTEGER NOT NULL,
+    clicks BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP NOT NULL,
+    preview_title TEXT NOT NULL DEFAULT '',
+    preview_description TEXT NOT NULL DEFAULT '',
+    preview_image_url TEXT NOT NULL DEFAULT '',
+    preview_fetched_at TIMESTAMP,
+FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX links_chirp_id_idx ON links (chirp_id);
+CREATE INDEX links_preview_pending_idx ON links (created_at) WHERE preview_fetched_at IS NULL;
+
+-- +goose Down
+DROP TABLE links;
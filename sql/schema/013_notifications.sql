@@ -0,0 +1,30 @@
+-- +goose Up
+CREATE TABLE notifications (
+    id uuid PRIMARY KEY,
+    user_id uuid NOT NULL,
+    type TEXT NOT NULL,
+    group_key TEXT NOT NULL,
+    chirp_id uuid,
+    actor_ids uuid[] NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE
+);
+
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, updated_at DESC, id DESC);
+-- at most one unread notification per group, which new activity is folded into
+CREATE UNIQUE INDEX notifications_unread_group_idx ON notifications (user_id, type, group_key) WHERE read_at IS NULL;
+
+CREATE TABLE notification_preferences (
+    user_id uuid NOT NULL,
+    type TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL,
+PRIMARY KEY (user_id, type),
+FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+DROP TABLE notification_preferences;
+DROP TABLE notifications;
@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN dm_privacy TEXT NOT NULL DEFAULT 'everyone';
+
+CREATE TABLE conversations (
+    id uuid PRIMARY KEY,
+    user_a uuid NOT NULL,
+    user_b uuid NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+FOREIGN KEY (user_a) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (user_b) REFERENCES users(id) ON DELETE CASCADE,
+-- each pair of users has one conversation, stored in a fixed order
+CHECK (user_a < user_b),
+UNIQUE (user_a, user_b)
+);
+
+CREATE INDEX conversations_user_b_idx ON conversations (user_b);
+
+CREATE TABLE messages (
+    id uuid PRIMARY KEY,
+    conversation_id uuid NOT NULL,
+    sender_id uuid NOT NULL,
+    -- encrypted with MESSAGE_ENCRYPTION_KEY
+    body BYTEA NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    read_at TIMESTAMP,
+FOREIGN KEY (conversation_id) REFERENCES conversations(id) ON DELETE CASCADE,
+FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX messages_conversation_id_idx ON messages (conversation_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP TABLE messages;
+DROP TABLE conversations;
+ALTER TABLE users
+DROP COLUMN dm_privacy;
@@ -0,0 +1,27 @@
+-- +goose Up
+CREATE TABLE blocks (
+    blocker_id uuid NOT NULL,
+    blocked_id uuid NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+PRIMARY KEY (blocker_id, blocked_id),
+FOREIGN KEY (blocker_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (blocked_id) REFERENCES users(id) ON DELETE CASCADE,
+CHECK (blocker_id <> blocked_id)
+);
+
+-- blocks apply in both directions, so look them up from either side
+CREATE INDEX blocks_blocked_id_idx ON blocks (blocked_id);
+
+CREATE TABLE mutes (
+    muter_id uuid NOT NULL,
+    muted_id uuid NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+PRIMARY KEY (muter_id, muted_id),
+FOREIGN KEY (muter_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (muted_id) REFERENCES users(id) ON DELETE CASCADE,
+CHECK (muter_id <> muted_id)
+);
+
+-- +goose Down
+DROP TABLE mutes;
+DROP TABLE blocks;
@@ -0,0 +1,62 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN suspended_until TIMESTAMP;
+
+CREATE TABLE reports (
+    id uuid PRIMARY KEY,
+    chirp_id uuid NOT NULL,
+    reporter_id uuid NOT NULL,
+    reason TEXT NOT NULL,
+    details TEXT NOT NULL,
+    -- open, then claimed by a moderator, then resolved
+    status TEXT NOT NULL,
+    claimed_by uuid,
+    resolution TEXT,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP,
+FOREIGN KEY (chirp_id) REFERENCES chirps(id) ON DELETE CASCADE,
+FOREIGN KEY (reporter_id) REFERENCES users(id) ON DELETE CASCADE,
+FOREIGN KEY (claimed_by) REFERENCES users(id) ON DELETE SET NULL,
+UNIQUE (chirp_id, reporter_id)
+);
+
+CREATE INDEX reports_status_idx ON reports (status, created_at DESC, id DESC);
+
+-- moderation_log records every moderator action. It has no foreign keys so
+-- that entries outlive the reports, chirps and users they mention.
+CREATE TABLE moderation_log (
+    id uuid PRIMARY KEY,
+    moderator_id uuid NOT NULL,
+    action TEXT NOT NULL,
+    report_id uuid,
+    chirp_id uuid,
+    target_user_id uuid,
+    note TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX moderation_log_report_id_idx ON moderation_log (report_id, created_at);
+
+-- +goose StatementBegin
+CREATE FUNCTION moderation_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'moderation_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER moderation_log_no_update
+BEFORE UPDATE OR DELETE ON moderation_log
+FOR EACH ROW EXECUTE FUNCTION moderation_log_append_only();
+
+CREATE TRIGGER moderation_log_no_truncate
+BEFORE TRUNCATE ON moderation_log
+FOR EACH STATEMENT EXECUTE FUNCTION moderation_log_append_only();
+
+-- +goose Down
+DROP TABLE moderation_log;
+DROP FUNCTION moderation_log_append_only();
+DROP TABLE reports;
+ALTER TABLE users
+DROP COLUMN suspended_until;
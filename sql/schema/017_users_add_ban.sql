@@ -0,0 +1,10 @@
+-- +goose Up
+ALTER TABLE users
+ADD COLUMN banned_at TIMESTAMP,
+-- why the account is suspended or banned, shown to the user at login
+ADD COLUMN ban_reason TEXT NOT NULL DEFAULT '';
+
+-- +goose Down
+ALTER TABLE users
+DROP COLUMN ban_reason,
+DROP COLUMN banned_at;
@@ -0,0 +1,9 @@
+-- +goose Up
+-- notifications are paged by when they were created: updated_at moves as
+-- activity is folded in, which would shift rows across page boundaries
+DROP INDEX notifications_user_id_idx;
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, created_at DESC, id DESC);
+
+-- +goose Down
+DROP INDEX notifications_user_id_idx;
+CREATE INDEX notifications_user_id_idx ON notifications (user_id, updated_at DESC, id DESC);
@@ -0,0 +1,18 @@
+-- +goose Up
+-- a user can be signed in on several devices, each with its own token
+ALTER TABLE refresh_tokens
+DROP CONSTRAINT refresh_tokens_user_id_key;
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX refresh_tokens_user_id_idx;
+
+-- keep only each user's newest token
+DELETE FROM refresh_tokens older
+USING refresh_tokens newer
+WHERE older.user_id = newer.user_id
+  AND (older.created_at, older.token) < (newer.created_at, newer.token);
+
+ALTER TABLE refresh_tokens
+ADD CONSTRAINT refresh_tokens_user_id_key UNIQUE (user_id);
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/google/uuid"
+)
+
+const (
+	streamHistorySize = 1024
+	streamBufferSize  = 64
+	streamHeartbeat   = 15 * time.Second
+
+	chirpsTopic = "chirps"
+
+	eventChirpCreated = "chirp.created"
+	eventChirpDeleted = "chirp.deleted"
+	// eventResync tells a client that events were missed, so it should
+	// refetch whatever it is showing.
+	eventResync = "resync"
+)
+
+func userTopic(id uuid.UUID) string {
+	return "user:" + id.String()
+}
+
+// publishChirpEvent sends payload to everyone following all chirps, the
+// chirps of its author or the chirp itself.
+func (cfg *apiConfig) publishChirpEvent(eventType string, chirp database.Chirp, payload any) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	cfg.hub.Publish(pubsub.Event{
+		Type:   eventType,
+		Topics: []string{chirpsTopic, userTopic(chirp.UserID), chirpTopic(chirp.ID)},
+		Data:   data,
+	})
+}
+
+// streamChirps pushes chirp.created and chirp.deleted events as
+// Server-Sent Events, optionally only for one author_id. Clients resume
+// with the Last-Event-ID header (or last_event_id parameter); if the events
+// they missed are no longer buffered they get a resync event instead.
+// Slow clients are disconnected and expected to reconnect and resume. The
+// access token is optional; with one, events about authors the viewer has
+// blocked or muted, or who have blocked them, are left out as in serveLive.
+func (cfg *apiConfig) streamChirps(w http.ResponseWriter, req *http.Request) {
+	type response struct {
+		Error string `json:"error,omitempty"`
+	}
+
+	topic := chirpsTopic
+	if authorID := req.URL.Query().Get("author_id"); authorID != "" {
+		authorUUID, err := uuid.Parse(authorID)
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+			errResponse, _ := json.Marshal(response{
+				Error: "Invalid author ID",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		topic = userTopic(authorUUID)
+	}
+
+	hidden := map[string]bool{}
+	if viewerUUID, err := cfg.authenticateUser(req); err == nil {
+		hidden, err = cfg.hiddenTopics(req.Context(), viewerUUID)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "list hidden authors", "error", err)
+			w.Header().Set("Content-Type", "application/json")
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+	}
+	visible := func(ev pubsub.Event) bool {
+		return !slices.ContainsFunc(ev.Topics, func(topic string) bool { return hidden[topic] })
+	}
+
+	lastEventID := req.Header.Get("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = req.URL.Query().Get("last_event_id")
+	}
+	lastID, _ := strconv.ParseUint(lastEventID, 10, 64)
+
+	sub, replay, complete := cfg.hub.Subscribe([]string{topic}, lastID)
+	defer sub.Close()
+
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventResync)
+	}
+	for _, ev := range replay {
+		if visible(ev) {
+			writeServerSentEvent(w, ev)
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(streamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-req.Context().Done():
+			return
+		case <-sub.Done():
+			if errors.Is(sub.Err(), pubsub.ErrSlowConsumer) {
+				fmt.Fprintf(w, ": too slow, reconnect to resume\n\n")
+				rc.Flush()
+			}
+			return
+		case ev := <-sub.Events():
+			if !visible(ev) {
+				continue
+			}
+			writeServerSentEvent(w, ev)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+func writeServerSentEvent(w http.ResponseWriter, ev pubsub.Event) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, ev.Data)
+}
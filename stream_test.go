@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type serverSentEvent struct {
+	ID   string
+	Type string
+	Data string
+}
+
+// openStream connects to path and returns a channel of parsed events.
+func (api *testAPI) openStream(path, authorization, lastEventID string) <-chan serverSentEvent {
+	api.t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	api.t.Cleanup(cancel)
+
+	req, err := http.NewRequestWithContext(ctx, "GET", api.srv.URL+path, nil)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	resp, err := api.srv.Client().Do(req)
+	if err != nil {
+		api.t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusOK || resp.Header.Get("Content-Type") != "text/event-stream" {
+		api.t.Fatalf("stream: status %d, content type %q", resp.StatusCode, resp.Header.Get("Content-Type"))
+	}
+
+	events := make(chan serverSentEvent, 16)
+	go func() {
+		defer resp.Body.Close()
+		defer close(events)
+		var ev serverSentEvent
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case line == "":
+				if ev.Type != "" {
+					events <- ev
+				}
+				ev = serverSentEvent{}
+			case strings.HasPrefix(line, "id: "):
+				ev.ID = strings.TrimPrefix(line, "id: ")
+			case strings.HasPrefix(line, "event: "):
+				ev.Type = strings.TrimPrefix(line, "event: ")
+			case strings.HasPrefix(line, "data: "):
+				ev.Data = strings.TrimPrefix(line, "data: ")
+			}
+		}
+	}()
+	return events
+}
+
+func nextEvent(t *testing.T, events <-chan serverSentEvent) serverSentEvent {
+	t.Helper()
+	select {
+	case ev, ok := <-events:
+		if !ok {
+			t.Fatal("stream closed")
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return serverSentEvent{}
+}
+
+func TestStreamChirps(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+
+	all := api.openStream("/api/stream", "", "")
+	onlyBob := api.openStream("/api/stream?author_id="+bob.ID, "", "")
+
+	first := api.chirp(alice, "from alice")
+	second := api.chirp(bob, "from bob")
+	api.do("DELETE", "/api/chirps/"+first.ID, alice.bearer(), nil)
+
+	var got []string
+	for range 3 {
+		ev := nextEvent(t, all)
+		var data struct {
+			ID string `json:"id"`
+		}
+		json.Unmarshal([]byte(ev.Data), &data)
+		got = append(got, ev.Type+" "+data.ID)
+	}
+	want := []string{eventChirpCreated + " " + first.ID, eventChirpCreated + " " + second.ID, eventChirpDeleted + " " + first.ID}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("events = %v, want %v", got, want)
+	}
+
+	ev := nextEvent(t, onlyBob)
+	if ev.Type != eventChirpCreated || !strings.Contains(ev.Data, second.ID) {
+		t.Errorf("author stream got %+v, want only bob's chirp", ev)
+	}
+
+	// resuming after the first event replays the rest
+	resumed := api.openStream("/api/stream", "", "1")
+	if ev := nextEvent(t, resumed); ev.ID != "2" {
+		t.Errorf("first replayed event ID = %s, want 2", ev.ID)
+	}
+	if ev := nextEvent(t, resumed); ev.ID != "3" {
+		t.Errorf("second replayed event ID = %s, want 3", ev.ID)
+	}
+
+	// an ID the hub never issued means the client missed events
+	stale := api.openStream("/api/stream", "", "999")
+	if ev := nextEvent(t, stale); ev.Type != eventResync {
+		t.Errorf("stale resume got %+v, want a resync event", ev)
+	}
+
+	if code, _ := api.do("GET", "/api/stream?author_id=nope", "", nil); code != http.StatusBadRequest {
+		t.Errorf("invalid author: status = %d, want 400", code)
+	}
+}
+
+func TestStreamHidesBlockedAuthors(t *testing.T) {
+	api := newTestAPI(t)
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	carol := api.signUp("carol@example.com")
+	dave := api.signUp("dave@example.com")
+	api.do("POST", "/api/users/"+bob.ID+"/block", alice.bearer(), nil)
+	api.do("POST", "/api/users/"+carol.ID+"/mute", alice.bearer(), nil)
+
+	aliceStream := api.openStream("/api/stream", alice.bearer(), "")
+	bobStream := api.openStream("/api/stream", bob.bearer(), "")
+	anonymous := api.openStream("/api/stream", "", "")
+
+	fromAlice := api.chirp(alice, "from alice")
+	fromBob := api.chirp(bob, "from bob")
+	fromCarol := api.chirp(carol, "from carol")
+	fromDave := api.chirp(dave, "from dave")
+
+	tests := []struct {
+		name   string
+		events <-chan serverSentEvent
+		want   []testChirp
+	}{
+		{name: "blocker and muter", events: aliceStream, want: []testChirp{fromAlice, fromDave}},
+		{name: "blocked", events: bobStream, want: []testChirp{fromBob, fromCarol, fromDave}},
+		{name: "anonymous", events: anonymous, want: []testChirp{fromAlice, fromBob, fromCarol, fromDave}},
+	}
+	for _, tt := range tests {
+		for _, want := range tt.want {
+			if ev := nextEvent(t, tt.events); !strings.Contains(ev.Data, want.ID) {
+				t.Errorf("%s: got %+v, want %q", tt.name, ev, want.Body)
+			}
+		}
+	}
+}
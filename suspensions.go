@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+	"unicode/utf8"
+
+	"github.com/chirpy/internal/audit"
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/pubsub"
+	"github.com/chirpy/internal/store"
+	"github.com/google/uuid"
+)
+
+// Moderation log actions for account sanctions an admin applies directly.
+// Suspensions from a report are logged as resolutionSuspend.
+const (
+	moderationSuspend   = "suspend"
+	moderationUnsuspend = "unsuspend"
+	moderationBan       = "ban"
+)
+
+// sanctionAuditActions maps each sanction to the audit log action recorded
+// alongside it.
+var sanctionAuditActions = map[string]string{
+	moderationSuspend:   audit.ActionUserSuspend,
+	moderationUnsuspend: audit.ActionUserUnsuspend,
+	moderationBan:       audit.ActionUserBan,
+}
+
+var errSuspended = errors.New("account is suspended")
+
+// isSuspended reports whether user is banned, or suspended at now.
+func isSuspended(user database.User, now time.Time) bool {
+	return user.BannedAt.Valid || (user.SuspendedUntil.Valid && user.SuspendedUntil.Time.After(now))
+}
+
+// activeUser returns the user with id, or errSuspended if they may not use
+// their account right now.
+func (cfg *apiConfig) activeUser(ctx context.Context, id uuid.UUID) (database.User, error) {
+	user, err := cfg.db.GetUserByID(ctx, id)
+	if err != nil {
+		return database.User{}, err
+	}
+	if isSuspended(user, time.Now().UTC()) {
+		return database.User{}, errSuspended
+	}
+	return user, nil
+}
+
+// suspendAccount suspends a user until the given time and signs them out
+// everywhere. Access tokens they still hold are rejected by
+// authenticateUser.
+func suspendAccount(ctx context.Context, tx store.Store, userID uuid.UUID, until time.Time, reason string) (database.User, error) {
+	user, err := tx.SuspendUser(ctx, database.SuspendUserParams{
+		ID:             userID,
+		SuspendedUntil: sql.NullTime{Time: until, Valid: true},
+		BanReason:      reason,
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+	return user, tx.DeleteRefreshTokensByUser(ctx, userID)
+}
+
+// accountStatus describes a user's sanctions to admins.
+type accountStatus struct {
+	ID             string `json:"id"`
+	SuspendedUntil string `json:"suspended_until,omitempty"`
+	Banned         bool   `json:"banned"`
+	BanReason      string `json:"ban_reason,omitempty"`
+}
+
+func newAccountStatus(user database.User) accountStatus {
+	status := accountStatus{
+		ID:        user.ID.String(),
+		Banned:    user.BannedAt.Valid,
+		BanReason: user.BanReason,
+	}
+	if user.SuspendedUntil.Valid {
+		status.SuspendedUntil = user.SuspendedUntil.Time.Format(time.RFC3339)
+	}
+	return status
+}
+
+// sanctionUser returns an admin-only handler that suspends the user in the
+// path for a number of days, bans them, or lifts either, depending on
+// action, and records it in the moderation log. Admins can't sanction
+// themselves.
+func (cfg *apiConfig) sanctionUser(action string) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		type requestData struct {
+			Days   int    `json:"days"`
+			Reason string `json:"reason"`
+		}
+		type response struct {
+			Error string `json:"error,omitempty"`
+			accountStatus
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+
+		admin, err := cfg.authenticateStaff(req, roleAdmin)
+		if errors.Is(err, errForbidden) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		if err != nil {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		userUUID, err := uuid.Parse(req.PathValue("userID"))
+		if err != nil || userUUID == admin.ID {
+			errResponse, _ := json.Marshal(response{
+				Error: "Invalid user ID",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+
+		data := requestData{}
+		if action != moderationUnsuspend {
+			decoder := json.NewDecoder(req.Body)
+			err = decoder.Decode(&data)
+			if err != nil || utf8.RuneCountInString(data.Reason) > maxModerationNote {
+				errResponse, _ := json.Marshal(response{
+					Error: "Invalid reason",
+				})
+				w.WriteHeader(http.StatusBadRequest)
+				w.Write(errResponse)
+				return
+			}
+		}
+		if action == moderationSuspend && (data.Days < 1 || data.Days > maxSuspensionDays) {
+			errResponse, _ := json.Marshal(response{
+				Error: "days must be between 1 and 365",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+
+		var user database.User
+		err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+			var err error
+			switch action {
+			case moderationSuspend:
+				until := time.Now().UTC().AddDate(0, 0, data.Days)
+				user, err = suspendAccount(req.Context(), tx, userUUID, until, data.Reason)
+			case moderationBan:
+				user, err = tx.BanUser(req.Context(), database.BanUserParams{ID: userUUID, BanReason: data.Reason})
+				if err == nil {
+					err = tx.DeleteRefreshTokensByUser(req.Context(), userUUID)
+				}
+			case moderationUnsuspend:
+				user, err = tx.UnsuspendUser(req.Context(), userUUID)
+			}
+			if err != nil {
+				return err
+			}
+			_, err = tx.CreateModerationAction(req.Context(), database.CreateModerationActionParams{
+				ModeratorID:  admin.ID,
+				Action:       action,
+				TargetUserID: uuid.NullUUID{UUID: userUUID, Valid: true},
+				Note:         data.Reason,
+			})
+			if err != nil {
+				return err
+			}
+			return audit.Record(req.Context(), tx, cfg.auditEvent(req, admin.ID, sanctionAuditActions[action], userUUID.String()))
+		})
+		if errors.Is(err, sql.ErrNoRows) {
+			errResponse, _ := json.Marshal(response{
+				Error: "User not found",
+			})
+			w.WriteHeader(http.StatusNotFound)
+			w.Write(errResponse)
+			return
+		}
+		if err != nil {
+			slog.ErrorContext(req.Context(), "sanction user", "action", action, "error", err)
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+
+		if action != moderationUnsuspend {
+			cfg.hub.Publish(pubsub.Event{
+				Type:   eventAccountSuspended,
+				Topics: []string{accountTopic(userUUID)},
+			})
+		}
+
+		successResponse, _ := json.Marshal(response{
+			accountStatus: newAccountStatus(user),
+		})
+		w.WriteHeader(http.StatusOK)
+		w.Write(successResponse)
+	}
+}
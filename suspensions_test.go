@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func (api *testAPI) signUpAdmin(email string) testUser {
+	api.t.Helper()
+
+	user := api.signUp(email)
+	api.store.SetUserRole(uuid.MustParse(user.ID), roleAdmin)
+	return user
+}
+
+func TestSuspendUser(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+	bob := api.signUp("bob@example.com")
+	hello := api.chirp(alice, "hello")
+	api.chirp(bob, "hi")
+
+	code, body := api.do("POST", "/admin/users/"+alice.ID+"/suspend", admin.bearer(), map[string]any{"days": 3, "reason": "spamming"})
+	var status accountStatus
+	decode(t, body, &status)
+	if code != http.StatusOK || status.SuspendedUntil == "" || status.BanReason != "spamming" || status.Banned {
+		t.Fatalf("suspend: status %d: %s", code, body)
+	}
+
+	// the access token alice already holds stops working
+	if code, _ := api.do("PATCH", "/api/users/me", alice.bearer(), map[string]string{"bio": "still here"}); code != http.StatusUnauthorized {
+		t.Errorf("suspended user's token: status %d", code)
+	}
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+alice.RefreshToken, nil); code != http.StatusUnauthorized {
+		t.Errorf("suspended user's refresh token: status %d", code)
+	}
+
+	code, body = api.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": alice.Password})
+	var login struct {
+		Error          string `json:"error"`
+		SuspendedUntil string `json:"suspended_until"`
+		Reason         string `json:"reason"`
+	}
+	decode(t, body, &login)
+	if code != http.StatusForbidden || login.SuspendedUntil != status.SuspendedUntil || login.Reason != "spamming" {
+		t.Errorf("login while suspended: status %d: %s", code, body)
+	}
+	// a wrong password doesn't reveal the suspension
+	code, body = api.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": "wrong"})
+	if code != http.StatusUnauthorized {
+		t.Errorf("wrong password while suspended: status %d: %s", code, body)
+	}
+
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 1 || got[0] != bob.ID {
+		t.Errorf("chirps listed during suspension by %v", got)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+hello.ID, bob.bearer(), nil); code != http.StatusNotFound {
+		t.Errorf("get chirp during suspension: status %d", code)
+	}
+
+	if code, body := api.do("POST", "/admin/users/"+alice.ID+"/unsuspend", admin.bearer(), nil); code != http.StatusOK {
+		t.Fatalf("unsuspend: status %d: %s", code, body)
+	}
+	if code, _ := api.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": alice.Password}); code != http.StatusOK {
+		t.Errorf("login after unsuspending: status %d", code)
+	}
+	if got := api.chirpAuthors(testUser{}, "/api/chirps"); len(got) != 2 {
+		t.Errorf("chirps listed after suspension by %v", got)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+hello.ID, "", nil); code != http.StatusOK {
+		t.Errorf("get chirp after suspension: status %d", code)
+	}
+}
+
+func TestBanUser(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+	chirp := api.chirp(alice, "hello")
+
+	code, body := api.do("POST", "/admin/users/"+alice.ID+"/ban", admin.bearer(), map[string]string{"reason": "fraud"})
+	var status accountStatus
+	decode(t, body, &status)
+	if code != http.StatusOK || !status.Banned || status.BanReason != "fraud" {
+		t.Fatalf("ban: status %d: %s", code, body)
+	}
+
+	code, body = api.do("POST", "/api/login", "", map[string]string{"email": alice.Email, "password": alice.Password})
+	var login struct {
+		Error          string `json:"error"`
+		SuspendedUntil string `json:"suspended_until"`
+	}
+	decode(t, body, &login)
+	if code != http.StatusForbidden || login.Error != "Account banned" || login.SuspendedUntil != "" {
+		t.Errorf("login while banned: status %d: %s", code, body)
+	}
+
+	if code, _ := api.do("GET", "/api/live", alice.bearer(), nil); code != http.StatusUnauthorized {
+		t.Errorf("live socket while banned: status %d", code)
+	}
+	if code, _ := api.do("GET", "/api/chirps/"+chirp.ID, "", nil); code != http.StatusNotFound {
+		t.Errorf("get chirp while banned: status %d", code)
+	}
+}
+
+func TestSanctionUserErrors(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	mod := api.signUpModerator("mod@example.com")
+	alice := api.signUp("alice@example.com")
+
+	tests := []struct {
+		name          string
+		path          string
+		authorization string
+		body          any
+		want          int
+	}{
+		{name: "moderator", path: "/admin/users/" + alice.ID + "/ban", authorization: mod.bearer(), body: map[string]string{}, want: http.StatusForbidden},
+		{name: "anonymous", path: "/admin/users/" + alice.ID + "/ban", body: map[string]string{}, want: http.StatusUnauthorized},
+		{name: "self", path: "/admin/users/" + admin.ID + "/ban", authorization: admin.bearer(), body: map[string]string{}, want: http.StatusBadRequest},
+		{name: "no days", path: "/admin/users/" + alice.ID + "/suspend", authorization: admin.bearer(), body: map[string]string{}, want: http.StatusBadRequest},
+		{name: "too many days", path: "/admin/users/" + alice.ID + "/suspend", authorization: admin.bearer(), body: map[string]int{"days": 366}, want: http.StatusBadRequest},
+		{name: "unknown user", path: "/admin/users/" + uuid.NewString() + "/suspend", authorization: admin.bearer(), body: map[string]int{"days": 1}, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code, body := api.do("POST", tt.path, tt.authorization, tt.body); code != tt.want {
+				t.Errorf("status %d, want %d: %s", code, tt.want, body)
+			}
+		})
+	}
+}
+
+func TestSuspensionExpires(t *testing.T) {
+	api := newTestAPI(t)
+	admin := api.signUpAdmin("admin@example.com")
+	alice := api.signUp("alice@example.com")
+	api.do("POST", "/admin/users/"+alice.ID+"/suspend", admin.bearer(), map[string]any{"days": 1})
+
+	user, _ := api.store.GetUserByID(context.Background(), uuid.MustParse(alice.ID))
+	if !isSuspended(user, time.Now()) || isSuspended(user, time.Now().Add(25*time.Hour)) {
+		t.Errorf("suspended until %v", user.SuspendedUntil)
+	}
+}
@@ -0,0 +1,316 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/chirpy/internal/audit"
+	"github.com/chirpy/internal/auth"
+	"github.com/chirpy/internal/database"
+	"github.com/chirpy/internal/store"
+)
+
+// emailVerificationTTL is how long a verification token for a new email
+// address stays valid.
+const emailVerificationTTL = 24 * time.Hour
+
+// patchUser updates only the fields present in the request.
+//
+// A password change must include the current password. It revokes every
+// refresh token and returns a fresh token pair, so other devices are signed
+// out once their access token expires.
+//
+// A new email address is not applied straight away: it is stored as pending
+// and a verification token is mailed to it, and the change takes effect
+// through verifyEmail.
+func (cfg *apiConfig) patchUser(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Email           *string `json:"email"`
+		Password        *string `json:"password"`
+		CurrentPassword *string `json:"current_password"`
+		profileUpdate
+	}
+
+	type response struct {
+		Error        string `json:"error,omitempty"`
+		ID           string `json:"id,omitempty"`
+		Email        string `json:"email,omitempty"`
+		PendingEmail string `json:"pending_email,omitempty"`
+		IsChirpyRed  bool   `json:"is_chirpy_red,omitempty"`
+		Handle       string `json:"handle,omitempty"`
+		DisplayName  string `json:"display_name,omitempty"`
+		Bio          string `json:"bio,omitempty"`
+		AvatarURL    string `json:"avatar_url,omitempty"`
+		Token        string `json:"token,omitempty"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+		UpdatedAt    string `json:"updated_at,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	userUUID, err := cfg.authenticateUser(req)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	decoder := json.NewDecoder(req.Body)
+	userData := requestData{}
+
+	err = decoder.Decode(&userData)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	user, err := cfg.db.GetUserByID(req.Context(), userUUID)
+	if err != nil {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	params := updateUserParams(user)
+	userData.apply(&params)
+
+	err = validateProfile(params.Handle.String, params.DisplayName, params.Bio, params.AvatarUrl)
+	if err != nil {
+		errResponse, _ := json.Marshal(response{
+			Error: err.Error(),
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	if cfg.handleTaken(req.Context(), params) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Handle is already taken",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+
+	changePassword := userData.Password != nil
+	if changePassword {
+		if *userData.Password == "" {
+			errResponse, _ := json.Marshal(response{
+				Error: "Password must not be empty",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		if userData.CurrentPassword == nil || auth.CheckPasswordHash(user.HashedPassword, *userData.CurrentPassword) != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Incorrect current password",
+			})
+			w.WriteHeader(http.StatusForbidden)
+			w.Write(errResponse)
+			return
+		}
+
+		params.HashedPassword, err = auth.HashPassword(*userData.Password)
+		if err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+	}
+
+	changeEmail := userData.Email != nil && *userData.Email != user.Email
+	if changeEmail {
+		if *userData.Email == "" {
+			errResponse, _ := json.Marshal(response{
+				Error: "Email must not be empty",
+			})
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(errResponse)
+			return
+		}
+		_, err = cfg.db.GetUserByEmail(req.Context(), *userData.Email)
+		if err == nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Email is already in use",
+			})
+			w.WriteHeader(http.StatusConflict)
+			w.Write(errResponse)
+			return
+		}
+	}
+
+	verificationToken, _ := auth.MakeRefreshToken()
+	refreshTokenString, _ := auth.MakeRefreshToken()
+	var refresh database.RefreshToken
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		var err error
+		user, err = tx.UpdateUser(req.Context(), params)
+		if err != nil {
+			return err
+		}
+		if changePassword {
+			err = tx.DeleteRefreshTokensByUser(req.Context(), user.ID)
+			if err != nil {
+				return err
+			}
+			refresh, err = tx.CreateRefreshToken(req.Context(), database.CreateRefreshTokenParams{Token: refreshTokenString, UserID: user.ID})
+			if err != nil {
+				return err
+			}
+			err = audit.Record(req.Context(), tx, cfg.auditEvent(req, user.ID, audit.ActionPasswordChange, user.ID.String()))
+			if err != nil {
+				return err
+			}
+		}
+		if changeEmail {
+			user, err = tx.SetPendingEmail(req.Context(), database.SetPendingEmailParams{
+				ID:                         user.ID,
+				PendingEmail:               sql.NullString{String: *userData.Email, Valid: true},
+				EmailVerificationToken:     sql.NullString{String: auth.HashToken(verificationToken), Valid: true},
+				EmailVerificationExpiresAt: sql.NullTime{Time: time.Now().UTC().Add(emailVerificationTTL), Valid: true},
+			})
+			if err != nil {
+				return err
+			}
+			err = audit.Record(req.Context(), tx, cfg.auditEvent(req, user.ID, audit.ActionEmailChangeRequest, user.ID.String()))
+		}
+		return err
+	})
+	if store.IsUniqueViolation(err) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Email or handle is already in use",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "patch user", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	if changeEmail {
+		err = cfg.mailer.Send(req.Context(), *userData.Email, "Confirm your new Chirpy email",
+			"Use this token to confirm your new email address: "+verificationToken)
+		if err != nil {
+			slog.ErrorContext(req.Context(), "send verification email", "error", err)
+		}
+	}
+
+	var accessToken string
+	if changePassword {
+		expiry, _ := time.ParseDuration("3600s")
+		accessToken, err = auth.MakeJWT(user.ID, cfg.authSecret, expiry)
+		if err != nil {
+			errResponse, _ := json.Marshal(response{
+				Error: "Something went wrong",
+			})
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write(errResponse)
+			return
+		}
+	}
+
+	successResponse, _ := json.Marshal(response{
+		ID:           user.ID.String(),
+		Email:        user.Email,
+		PendingEmail: user.PendingEmail.String,
+		IsChirpyRed:  user.IsChirpyRed,
+		Handle:       user.Handle.String,
+		DisplayName:  user.DisplayName,
+		Bio:          user.Bio,
+		AvatarURL:    user.AvatarUrl,
+		Token:        accessToken,
+		RefreshToken: refresh.Token,
+		UpdatedAt:    user.UpdatedAt.String(),
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
+
+// verifyEmail swaps in a pending email address once its owner presents the
+// token that was mailed to it.
+func (cfg *apiConfig) verifyEmail(w http.ResponseWriter, req *http.Request) {
+	type requestData struct {
+		Token string `json:"token"`
+	}
+
+	type response struct {
+		Error string `json:"error,omitempty"`
+		ID    string `json:"id,omitempty"`
+		Email string `json:"email,omitempty"`
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+
+	decoder := json.NewDecoder(req.Body)
+	reqData := requestData{}
+
+	err := decoder.Decode(&reqData)
+	if err != nil || reqData.Token == "" {
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	user, err := cfg.db.GetUserByEmailVerificationToken(req.Context(), sql.NullString{String: auth.HashToken(reqData.Token), Valid: true})
+	if err != nil || time.Now().After(user.EmailVerificationExpiresAt.Time) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Invalid or expired verification token",
+		})
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(errResponse)
+		return
+	}
+
+	err = cfg.db.InTx(req.Context(), func(tx store.Store) error {
+		var err error
+		user, err = tx.ConfirmPendingEmail(req.Context(), user.ID)
+		if err != nil {
+			return err
+		}
+		return audit.Record(req.Context(), tx, cfg.auditEvent(req, user.ID, audit.ActionEmailChange, user.ID.String()))
+	})
+	if store.IsUniqueViolation(err) {
+		errResponse, _ := json.Marshal(response{
+			Error: "Email is already in use",
+		})
+		w.WriteHeader(http.StatusConflict)
+		w.Write(errResponse)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(req.Context(), "confirm pending email", "error", err)
+		errResponse, _ := json.Marshal(response{
+			Error: "Something went wrong",
+		})
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(errResponse)
+		return
+	}
+
+	successResponse, _ := json.Marshal(response{
+		ID:    user.ID.String(),
+		Email: user.Email,
+	})
+	w.WriteHeader(http.StatusOK)
+	w.Write(successResponse)
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/chirpy/internal/auth"
+	"github.com/google/uuid"
+)
+
+func TestPatchUser(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+	api.signUp("taken@example.com")
+
+	tests := []struct {
+		name          string
+		authorization string
+		body          any
+		wantCode      int
+	}{
+		{name: "Missing token", body: map[string]string{"bio": "hi"}, wantCode: http.StatusUnauthorized},
+		{name: "Malformed JSON", authorization: user.bearer(), body: "{", wantCode: http.StatusBadRequest},
+		{name: "Empty body", authorization: user.bearer(), body: map[string]string{}, wantCode: http.StatusOK},
+		{name: "Profile only", authorization: user.bearer(), body: map[string]string{"display_name": "Alice"}, wantCode: http.StatusOK},
+		{name: "Invalid handle", authorization: user.bearer(), body: map[string]string{"handle": "a"}, wantCode: http.StatusBadRequest},
+		{name: "Password without current password", authorization: user.bearer(), body: map[string]string{"password": "new"}, wantCode: http.StatusForbidden},
+		{name: "Password with wrong current password", authorization: user.bearer(), body: map[string]string{"password": "new", "current_password": "wrong"}, wantCode: http.StatusForbidden},
+		{name: "Email taken", authorization: user.bearer(), body: map[string]string{"email": "taken@example.com"}, wantCode: http.StatusConflict},
+		{name: "Empty email", authorization: user.bearer(), body: map[string]string{"email": ""}, wantCode: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, body := api.do("PATCH", "/api/users/me", tt.authorization, tt.body)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d: %s", code, tt.wantCode, body)
+			}
+		})
+	}
+
+	stored, err := api.store.GetUserByID(context.Background(), uuid.MustParse(user.ID))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.DisplayName != "Alice" || stored.Email != user.Email {
+		t.Errorf("user = %+v", stored)
+	}
+	if err := auth.CheckPasswordHash(stored.HashedPassword, user.Password); err != nil {
+		t.Errorf("password changed without the current password")
+	}
+}
+
+func TestPatchUserPassword(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	code, body := api.do("PATCH", "/api/users/me", user.bearer(), map[string]string{"password": "new", "current_password": user.Password})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %s", code, body)
+	}
+	var resp struct {
+		Token        string `json:"token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	decode(t, body, &resp)
+	if resp.Token == "" || resp.RefreshToken == "" {
+		t.Fatalf("password change did not return a new token pair: %s", body)
+	}
+
+	// the old session is revoked and the new one works
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+user.RefreshToken, nil); code != http.StatusUnauthorized {
+		t.Errorf("old refresh token: status = %d, want 401", code)
+	}
+	if code, _ := api.do("POST", "/api/refresh", "Bearer "+resp.RefreshToken, nil); code != http.StatusOK {
+		t.Errorf("new refresh token: status = %d, want 200", code)
+	}
+
+	if code, _ := api.do("POST", "/api/login", "", map[string]string{"email": user.Email, "password": "new"}); code != http.StatusOK {
+		t.Errorf("login with new password: status = %d, want 200", code)
+	}
+}
+
+func TestPatchUserEmail(t *testing.T) {
+	api := newTestAPI(t)
+	user := api.signUp("a@example.com")
+
+	code, body := api.do("PATCH", "/api/users/me", user.bearer(), map[string]string{"email": "new@example.com"})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %s", code, body)
+	}
+	var resp struct {
+		Email        string `json:"email"`
+		PendingEmail string `json:"pending_email"`
+	}
+	decode(t, body, &resp)
+	if resp.Email != user.Email || resp.PendingEmail != "new@example.com" {
+		t.Errorf("email = %q, pending = %q; want the change to wait for verification", resp.Email, resp.PendingEmail)
+	}
+
+	mail, ok := api.mail.last()
+	if !ok || mail.To != "new@example.com" {
+		t.Fatalf("verification email = %+v, want one to new@example.com", mail)
+	}
+	token := mail.Body[strings.LastIndex(mail.Body, " ")+1:]
+
+	if code, _ := api.do("POST", "/api/users/verify-email", "", map[string]string{"token": "wrong"}); code != http.StatusBadRequest {
+		t.Errorf("wrong token: status = %d, want 400", code)
+	}
+
+	// someone else claims the address before it is verified
+	api.signUp("new@example.com")
+	if code, _ := api.do("POST", "/api/users/verify-email", "", map[string]string{"token": token}); code != http.StatusConflict {
+		t.Errorf("claimed address: status = %d, want 409", code)
+	}
+
+	code, body = api.do("PATCH", "/api/users/me", user.bearer(), map[string]string{"email": "newer@example.com"})
+	if code != http.StatusOK {
+		t.Fatalf("status = %d: %s", code, body)
+	}
+	mail, _ = api.mail.last()
+	token = mail.Body[strings.LastIndex(mail.Body, " ")+1:]
+
+	code, body = api.do("POST", "/api/users/verify-email", "", map[string]string{"token": token})
+	if code != http.StatusOK {
+		t.Fatalf("verify: status = %d: %s", code, body)
+	}
+	if code, _ := api.do("POST", "/api/users/verify-email", "", map[string]string{"token": token}); code != http.StatusBadRequest {
+		t.Errorf("reused token: status = %d, want 400", code)
+	}
+	if code, _ := api.do("POST", "/api/login", "", map[string]string{"email": "newer@example.com", "password": user.Password}); code != http.StatusOK {
+		t.Errorf("login with verified email: status = %d, want 200", code)
+	}
+}